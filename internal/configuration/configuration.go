@@ -7,6 +7,8 @@ import (
 
 	"github.com/Aloe-Corporation/logs"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
+	"github.com/FloRichardAloeCorp/gateway/internal/server"
 	"github.com/FloRichardAloeCorp/gateway/internal/service"
 	"github.com/spf13/viper"
 )
@@ -23,8 +25,20 @@ type Config struct {
 }
 
 type ServerConfig struct {
-	Port int        `mapstructure:"port"`
-	Cors CorsConfig `mapstructure:"cors"`
+	Port int              `mapstructure:"port"`
+	TLS  server.TLSConfig `mapstructure:"tls"`
+	Cors CorsConfig       `mapstructure:"cors"`
+	// Time allowed to read the request headers, on the plain and TLS
+	// listeners. 10 seconds by default.
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// Path serving the health of every service targets. Disabled when empty.
+	HealthPath string `mapstructure:"health_path"`
+	// Path responding 503 until the auth providers of every service are
+	// discovered. Disabled when empty.
+	ReadinessPath string `mapstructure:"readiness_path"`
+	// Forwarding headers sent to the upstreams of services that don't
+	// configure their own.
+	ForwardedHeaders proxy.ForwardedHeadersConfig `mapstructure:"forwarded_headers"`
 }
 
 type CorsConfig struct {
@@ -63,6 +77,7 @@ func LoadConf(path, prefix string) (*Config, error) {
 	}
 
 	mergeAuthMiddlewareConfig(conf)
+	mergeForwardedHeadersConfig(conf)
 	return conf, nil
 }
 
@@ -70,8 +85,15 @@ func mergeAuthMiddlewareConfig(conf *Config) {
 	globalMiddlewareConfig := conf.Middlewares.Auth
 
 	for i := 0; i < len(conf.Services); i++ {
-		for j := 0; j < len(conf.Services[i].Endpoints); j++ {
-			conf.Services[i].Middlewares.Auth.AuthMiddlewareConfig = globalMiddlewareConfig
+		conf.Services[i].Middlewares.Auth.AuthMiddlewareConfig = globalMiddlewareConfig
+	}
+}
+
+func mergeForwardedHeadersConfig(conf *Config) {
+	for i := 0; i < len(conf.Services); i++ {
+		if conf.Services[i].ForwardedHeaders == nil {
+			globalConfig := conf.Server.ForwardedHeaders
+			conf.Services[i].ForwardedHeaders = &globalConfig
 		}
 	}
 }
@@ -0,0 +1,116 @@
+package configuration
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/service"
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const serviceIsolationConfig = `
+middlewares:
+  auth:
+    provider_url: %s
+    client_id: gateway
+services:
+  - name: orders
+    path_prefix: /orders
+    base_url: %s
+    middlewares:
+      auth:
+        enabled: true
+        audiences:
+          - orders
+    endpoints:
+      - method: GET
+        path: /items
+  - name: billing
+    path_prefix: /billing
+    base_url: %s
+    middlewares:
+      auth:
+        enabled: true
+        audiences:
+          - billing
+    endpoints:
+      - method: GET
+        path: /items
+`
+
+func TestLoadConfServiceAudiences(t *testing.T) {
+	type testData struct {
+		name               string
+		path               string
+		audience           string
+		expectedStatusCode int
+	}
+
+	provider := test.LaunchTestProvider()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	content := fmt.Sprintf(serviceIsolationConfig, provider.URL, upstream.URL, upstream.URL)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0o600))
+
+	conf, err := LoadConf(dir, "GATEWAY_TEST")
+	assert.NoError(t, err)
+
+	router := gin.New()
+	for _, serviceConf := range conf.Services {
+		instance, err := service.New(serviceConf)
+		assert.NoError(t, err)
+		defer instance.Stop()
+
+		assert.NoError(t, instance.AttachEndpoints(router))
+	}
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: token minted for the service",
+			path:               "/orders/items",
+			audience:           "orders",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: token minted for another service",
+			path:               "/billing/items",
+			audience:           "orders",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: token minted for the gateway client",
+			path:               "/orders/items",
+			audience:           "gateway",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			token := test.NewToken(jwt.MapClaims{
+				"iss": provider.URL,
+				"aud": jwt.ClaimStrings{testCase.audience},
+				"exp": jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			})
+
+			req := httptest.NewRequest("GET", testCase.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+}
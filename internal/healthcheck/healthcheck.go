@@ -0,0 +1,203 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Aloe-Corporation/logs"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
+	"go.uber.org/zap"
+)
+
+var (
+	log = logs.Get()
+)
+
+const (
+	defaultInterval       = 10 * time.Second
+	defaultTimeout        = 2 * time.Second
+	defaultExpectedStatus = http.StatusOK
+	defaultMaxFailures    = 5
+	defaultCooldown       = 30 * time.Second
+)
+
+type Config struct {
+	Active  ActiveConfig  `mapstructure:"active"`
+	Passive PassiveConfig `mapstructure:"passive"`
+}
+
+// ActiveConfig configures the periodic probing of every target.
+type ActiveConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Path appended to the target URL, e.g. /health.
+	Path           string        `mapstructure:"path"`
+	Interval       time.Duration `mapstructure:"interval"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	ExpectedStatus int           `mapstructure:"expected_status"`
+}
+
+// PassiveConfig configures the ejection of targets based on the outcome of
+// forwarded requests.
+type PassiveConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Number of consecutive failures after which the target is ejected.
+	MaxFailures int `mapstructure:"max_failures"`
+	// Time during which an ejected target doesn't receive requests.
+	Cooldown time.Duration `mapstructure:"cooldown"`
+}
+
+type Checker struct {
+	name    string
+	conf    Config
+	targets []*loadbalancer.Target
+	client  *http.Client
+
+	failures map[*loadbalancer.Target]int
+	mu       sync.Mutex
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func New(name string, conf Config, targets []*loadbalancer.Target) *Checker {
+	if conf.Active.Interval <= 0 {
+		conf.Active.Interval = defaultInterval
+	}
+
+	if conf.Active.Timeout <= 0 {
+		conf.Active.Timeout = defaultTimeout
+	}
+
+	if conf.Active.ExpectedStatus == 0 {
+		conf.Active.ExpectedStatus = defaultExpectedStatus
+	}
+
+	if conf.Passive.MaxFailures <= 0 {
+		conf.Passive.MaxFailures = defaultMaxFailures
+	}
+
+	if conf.Passive.Cooldown <= 0 {
+		conf.Passive.Cooldown = defaultCooldown
+	}
+
+	return &Checker{
+		name:    name,
+		conf:    conf,
+		targets: targets,
+		client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		failures: make(map[*loadbalancer.Target]int),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start launches the active health checks in background. It does nothing if
+// active checks are disabled.
+func (c *Checker) Start() {
+	if !c.conf.Active.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.conf.Active.Interval)
+		defer ticker.Stop()
+
+		c.probeAll()
+		for {
+			select {
+			case <-ticker.C:
+				c.probeAll()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Checker) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// ReportSuccess resets the consecutive failures count of the target.
+func (c *Checker) ReportSuccess(target *loadbalancer.Target) {
+	if !c.conf.Passive.Enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.failures, target)
+}
+
+// ReportFailure records a failed request and ejects the target once the
+// configured number of consecutive failures is reached.
+func (c *Checker) ReportFailure(target *loadbalancer.Target) {
+	if !c.conf.Passive.Enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures[target]++
+	if c.failures[target] < c.conf.Passive.MaxFailures {
+		return
+	}
+
+	delete(c.failures, target)
+	target.Eject(time.Now().Add(c.conf.Passive.Cooldown))
+	log.Warn("upstream target ejected",
+		zap.String("upstream", c.name),
+		zap.String("target", target.URL),
+		zap.Duration("cooldown", c.conf.Passive.Cooldown),
+	)
+}
+
+func (c *Checker) probeAll() {
+	wg := sync.WaitGroup{}
+	for _, target := range c.targets {
+		wg.Add(1)
+		go func(target *loadbalancer.Target) {
+			defer wg.Done()
+			c.probe(target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) probe(target *loadbalancer.Target) {
+	healthy := true
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.Active.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL+c.conf.Active.Path, nil)
+	if err != nil {
+		healthy = false
+	} else {
+		res, err := c.client.Do(req)
+		if err != nil {
+			healthy = false
+		} else {
+			res.Body.Close()
+			healthy = res.StatusCode == c.conf.Active.ExpectedStatus
+		}
+	}
+
+	if healthy != target.Healthy() {
+		log.Warn("upstream target health changed",
+			zap.String("upstream", c.name),
+			zap.String("target", target.URL),
+			zap.Bool("healthy", healthy),
+		)
+	}
+	target.SetHealthy(healthy)
+}
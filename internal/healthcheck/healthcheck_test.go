@@ -0,0 +1,164 @@
+package healthcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	checker := New("test", Config{}, nil)
+	assert.Equal(t, defaultInterval, checker.conf.Active.Interval)
+	assert.Equal(t, defaultTimeout, checker.conf.Active.Timeout)
+	assert.Equal(t, defaultExpectedStatus, checker.conf.Active.ExpectedStatus)
+	assert.Equal(t, defaultMaxFailures, checker.conf.Passive.MaxFailures)
+	assert.Equal(t, defaultCooldown, checker.conf.Passive.Cooldown)
+}
+
+func TestCheckerReportFailure(t *testing.T) {
+	type testData struct {
+		name            string
+		conf            PassiveConfig
+		failures        int
+		success         bool
+		expectedEjected bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "Target ejected after max failures",
+			conf:            PassiveConfig{Enabled: true, MaxFailures: 3, Cooldown: time.Hour},
+			failures:        3,
+			expectedEjected: true,
+		},
+		{
+			name:            "Target kept below max failures",
+			conf:            PassiveConfig{Enabled: true, MaxFailures: 3, Cooldown: time.Hour},
+			failures:        2,
+			expectedEjected: false,
+		},
+		{
+			name:            "Success resets consecutive failures",
+			conf:            PassiveConfig{Enabled: true, MaxFailures: 3, Cooldown: time.Hour},
+			failures:        2,
+			success:         true,
+			expectedEjected: false,
+		},
+		{
+			name:            "Passive checks disabled",
+			conf:            PassiveConfig{Enabled: false, MaxFailures: 1, Cooldown: time.Hour},
+			failures:        3,
+			expectedEjected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			target := &loadbalancer.Target{URL: "http://a"}
+			checker := New("test", Config{Passive: testCase.conf}, []*loadbalancer.Target{target})
+
+			for i := 0; i < testCase.failures; i++ {
+				checker.ReportFailure(target)
+			}
+			if testCase.success {
+				checker.ReportSuccess(target)
+				checker.ReportFailure(target)
+			}
+
+			assert.Equal(t, testCase.expectedEjected, target.Ejected())
+		})
+	}
+}
+
+func TestCheckerCooldown(t *testing.T) {
+	target := &loadbalancer.Target{URL: "http://a"}
+	checker := New("test", Config{
+		Passive: PassiveConfig{Enabled: true, MaxFailures: 1, Cooldown: 50 * time.Millisecond},
+	}, []*loadbalancer.Target{target})
+
+	checker.ReportFailure(target)
+	assert.False(t, target.Available())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, target.Available())
+}
+
+func TestCheckerProbe(t *testing.T) {
+	type testData struct {
+		name            string
+		handler         http.HandlerFunc
+		conf            ActiveConfig
+		expectedHealthy bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Healthy target",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/health" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			},
+			conf:            ActiveConfig{Enabled: true, Path: "/health"},
+			expectedHealthy: true,
+		},
+		{
+			name: "Unexpected status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			conf:            ActiveConfig{Enabled: true, Path: "/health"},
+			expectedHealthy: false,
+		},
+		{
+			name: "Custom expected status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			conf:            ActiveConfig{Enabled: true, Path: "/health", ExpectedStatus: http.StatusNoContent},
+			expectedHealthy: true,
+		},
+		{
+			name: "Timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+			},
+			conf:            ActiveConfig{Enabled: true, Path: "/health", Timeout: 10 * time.Millisecond},
+			expectedHealthy: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(testCase.handler)
+			defer server.Close()
+
+			target := &loadbalancer.Target{URL: server.URL}
+			checker := New("test", Config{Active: testCase.conf}, []*loadbalancer.Target{target})
+			checker.probeAll()
+
+			assert.Equal(t, testCase.expectedHealthy, target.Healthy())
+		})
+	}
+}
+
+func TestCheckerStart(t *testing.T) {
+	target := &loadbalancer.Target{URL: "http://127.0.0.1:0"}
+	checker := New("test", Config{
+		Active: ActiveConfig{Enabled: true, Interval: time.Hour},
+	}, []*loadbalancer.Target{target})
+
+	checker.Start()
+	defer checker.Stop()
+
+	assert.Eventually(t, func() bool {
+		return !target.Healthy()
+	}, time.Second, 10*time.Millisecond)
+}
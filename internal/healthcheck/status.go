@@ -0,0 +1,46 @@
+package healthcheck
+
+import (
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
+)
+
+type ServiceStatus struct {
+	Name    string         `json:"name"`
+	Targets []TargetStatus `json:"targets"`
+}
+
+type TargetStatus struct {
+	URL          string     `json:"url"`
+	Healthy      bool       `json:"healthy"`
+	Ejected      bool       `json:"ejected"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	InFlight     int64      `json:"in_flight"`
+}
+
+// Status returns the current health of the given targets.
+func Status(name string, targets []*loadbalancer.Target) ServiceStatus {
+	status := ServiceStatus{
+		Name:    name,
+		Targets: []TargetStatus{},
+	}
+
+	for _, target := range targets {
+		targetStatus := TargetStatus{
+			URL:      target.URL,
+			Healthy:  target.Healthy(),
+			Ejected:  target.Ejected(),
+			InFlight: target.InFlight(),
+		}
+
+		if targetStatus.Ejected {
+			until := target.EjectedUntil()
+			targetStatus.EjectedUntil = &until
+		}
+
+		status.Targets = append(status.Targets, targetStatus)
+	}
+
+	return status
+}
@@ -0,0 +1,32 @@
+package healthcheck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	healthy := &loadbalancer.Target{URL: "http://a"}
+	unhealthy := &loadbalancer.Target{URL: "http://b"}
+	unhealthy.SetHealthy(false)
+	ejected := &loadbalancer.Target{URL: "http://c"}
+	until := time.Now().Add(time.Hour)
+	ejected.Eject(until)
+
+	status := Status("test", []*loadbalancer.Target{healthy, unhealthy, ejected})
+	assert.Equal(t, "test", status.Name)
+	assert.Len(t, status.Targets, 3)
+
+	assert.True(t, status.Targets[0].Healthy)
+	assert.False(t, status.Targets[0].Ejected)
+	assert.Nil(t, status.Targets[0].EjectedUntil)
+
+	assert.False(t, status.Targets[1].Healthy)
+
+	assert.True(t, status.Targets[2].Healthy)
+	assert.True(t, status.Targets[2].Ejected)
+	assert.Equal(t, until.UnixNano(), status.Targets[2].EjectedUntil.UnixNano())
+}
@@ -0,0 +1,48 @@
+package loadbalancer
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	RoundRobin               = "round_robin"
+	WeightedRoundRobin       = "weighted_round_robin"
+	LeastOutstandingRequests = "least_outstanding_requests"
+	RandomTwoChoices         = "random_two_choices"
+)
+
+var (
+	ErrNoTarget         = errors.New("no target available")
+	ErrMissingTargetURL = errors.New("target url is missing")
+	ErrInvalidWeight    = errors.New("target weight must be positive")
+	ErrUnknownStrategy  = errors.New("unknown load balancing strategy")
+)
+
+// Balancer selects the target a request is forwarded to. Targets that are
+// not available are skipped.
+type Balancer interface {
+	Next() (*Target, error)
+	Targets() []*Target
+}
+
+// New returns the balancer implementing the given strategy. Round robin is
+// used when no strategy is provided.
+func New(strategy string, targets []*Target) (Balancer, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTarget
+	}
+
+	switch strategy {
+	case "", RoundRobin:
+		return newRoundRobin(targets), nil
+	case WeightedRoundRobin:
+		return newWeightedRoundRobin(targets), nil
+	case LeastOutstandingRequests:
+		return newLeastOutstanding(targets), nil
+	case RandomTwoChoices:
+		return newRandomTwoChoices(targets), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, strategy)
+	}
+}
@@ -0,0 +1,76 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	type testData struct {
+		name         string
+		strategy     string
+		targets      []*Target
+		expectedType Balancer
+		expectedErr  error
+	}
+
+	targets := []*Target{{URL: "http://a", Weight: 1}}
+
+	var testCases = [...]testData{
+		{
+			name:         "Default strategy",
+			strategy:     "",
+			targets:      targets,
+			expectedType: &roundRobin{},
+		},
+		{
+			name:         "Round robin",
+			strategy:     RoundRobin,
+			targets:      targets,
+			expectedType: &roundRobin{},
+		},
+		{
+			name:         "Weighted round robin",
+			strategy:     WeightedRoundRobin,
+			targets:      targets,
+			expectedType: &weightedRoundRobin{},
+		},
+		{
+			name:         "Least outstanding requests",
+			strategy:     LeastOutstandingRequests,
+			targets:      targets,
+			expectedType: &leastOutstanding{},
+		},
+		{
+			name:         "Random two choices",
+			strategy:     RandomTwoChoices,
+			targets:      targets,
+			expectedType: &randomTwoChoices{},
+		},
+		{
+			name:        "Fail case: unknown strategy",
+			strategy:    "unknown",
+			targets:     targets,
+			expectedErr: ErrUnknownStrategy,
+		},
+		{
+			name:        "Fail case: no target",
+			strategy:    RoundRobin,
+			expectedErr: ErrNoTarget,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			balancer, err := New(testCase.strategy, testCase.targets)
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.IsType(t, testCase.expectedType, balancer)
+				assert.Equal(t, testCase.targets, balancer.Targets())
+			}
+		})
+	}
+}
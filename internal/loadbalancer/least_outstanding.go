@@ -0,0 +1,47 @@
+package loadbalancer
+
+import "sync/atomic"
+
+// leastOutstanding picks the target with the fewest in flight requests. Ties
+// are broken by rotating the starting point of the scan.
+type leastOutstanding struct {
+	targets []*Target
+	start   atomic.Uint64
+}
+
+func newLeastOutstanding(targets []*Target) *leastOutstanding {
+	return &leastOutstanding{
+		targets: targets,
+	}
+}
+
+func (l *leastOutstanding) Next() (*Target, error) {
+	count := len(l.targets)
+	if count == 0 {
+		return nil, ErrNoTarget
+	}
+
+	offset := int((l.start.Add(1) - 1) % uint64(count))
+
+	var best *Target
+	for i := 0; i < count; i++ {
+		target := l.targets[(offset+i)%count]
+		if !target.Available() {
+			continue
+		}
+
+		if best == nil || target.InFlight() < best.InFlight() {
+			best = target
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoTarget
+	}
+
+	return best, nil
+}
+
+func (l *leastOutstanding) Targets() []*Target {
+	return l.targets
+}
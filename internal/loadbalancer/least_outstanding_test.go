@@ -0,0 +1,43 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeastOutstandingNext(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}}
+	balancer := newLeastOutstanding(targets)
+
+	targets[0].Acquire()
+	targets[2].Acquire()
+
+	for i := 0; i < 3; i++ {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://b", target.URL)
+	}
+
+	targets[1].Acquire()
+	targets[1].Acquire()
+	target, err := balancer.Next()
+	assert.NoError(t, err)
+	assert.NotEqual(t, "http://b", target.URL)
+}
+
+func TestLeastOutstandingNextSkipsUnavailableTargets(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}}
+	balancer := newLeastOutstanding(targets)
+
+	targets[1].Acquire()
+	targets[0].SetHealthy(false)
+
+	target, err := balancer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://b", target.URL)
+
+	targets[1].SetHealthy(false)
+	_, err = balancer.Next()
+	assert.ErrorIs(t, err, ErrNoTarget)
+}
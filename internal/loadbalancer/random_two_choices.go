@@ -0,0 +1,48 @@
+package loadbalancer
+
+import "math/rand"
+
+// randomTwoChoices samples two distinct targets at random and keeps the one
+// with the fewest in flight requests.
+type randomTwoChoices struct {
+	targets []*Target
+}
+
+func newRandomTwoChoices(targets []*Target) *randomTwoChoices {
+	return &randomTwoChoices{
+		targets: targets,
+	}
+}
+
+func (r *randomTwoChoices) Next() (*Target, error) {
+	available := make([]*Target, 0, len(r.targets))
+	for _, target := range r.targets {
+		if target.Available() {
+			available = append(available, target)
+		}
+	}
+
+	count := len(available)
+	switch count {
+	case 0:
+		return nil, ErrNoTarget
+	case 1:
+		return available[0], nil
+	}
+
+	first := rand.Intn(count)
+	second := rand.Intn(count - 1)
+	if second >= first {
+		second++
+	}
+
+	if available[second].InFlight() < available[first].InFlight() {
+		return available[second], nil
+	}
+
+	return available[first], nil
+}
+
+func (r *randomTwoChoices) Targets() []*Target {
+	return r.targets
+}
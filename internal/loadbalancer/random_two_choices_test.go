@@ -0,0 +1,43 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomTwoChoicesNext(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}}
+	balancer := newRandomTwoChoices(targets)
+
+	targets[0].Acquire()
+
+	// With two targets both are always sampled, the least loaded one wins.
+	for i := 0; i < 10; i++ {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://b", target.URL)
+	}
+
+	single := newRandomTwoChoices(targets[:1])
+	target, err := single.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://a", target.URL)
+}
+
+func TestRandomTwoChoicesNextSkipsUnavailableTargets(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}}
+	balancer := newRandomTwoChoices(targets)
+
+	targets[0].SetHealthy(false)
+	targets[2].SetHealthy(false)
+	for i := 0; i < 10; i++ {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://b", target.URL)
+	}
+
+	targets[1].SetHealthy(false)
+	_, err := balancer.Next()
+	assert.ErrorIs(t, err, ErrNoTarget)
+}
@@ -0,0 +1,30 @@
+package loadbalancer
+
+import "sync/atomic"
+
+type roundRobin struct {
+	targets []*Target
+	next    atomic.Uint64
+}
+
+func newRoundRobin(targets []*Target) *roundRobin {
+	return &roundRobin{
+		targets: targets,
+	}
+}
+
+func (r *roundRobin) Next() (*Target, error) {
+	count := uint64(len(r.targets))
+	for i := uint64(0); i < count; i++ {
+		target := r.targets[(r.next.Add(1)-1)%count]
+		if target.Available() {
+			return target, nil
+		}
+	}
+
+	return nil, ErrNoTarget
+}
+
+func (r *roundRobin) Targets() []*Target {
+	return r.targets
+}
@@ -0,0 +1,35 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRobinNext(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}}
+	balancer := newRoundRobin(targets)
+
+	for _, expected := range []string{"http://a", "http://b", "http://c", "http://a"} {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, target.URL)
+	}
+}
+
+func TestRoundRobinNextSkipsUnavailableTargets(t *testing.T) {
+	targets := []*Target{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}}
+	balancer := newRoundRobin(targets)
+
+	targets[1].SetHealthy(false)
+	for _, expected := range []string{"http://a", "http://c", "http://a"} {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, target.URL)
+	}
+
+	targets[0].SetHealthy(false)
+	targets[2].SetHealthy(false)
+	_, err := balancer.Next()
+	assert.ErrorIs(t, err, ErrNoTarget)
+}
@@ -0,0 +1,99 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type TargetConfig struct {
+	URL string `mapstructure:"url"`
+	// Relative weight of the target, only used by the weighted round robin
+	// strategy. Defaults to 1.
+	Weight int `mapstructure:"weight"`
+}
+
+// Target is an upstream instance requests can be forwarded to.
+type Target struct {
+	URL    string
+	Weight int
+
+	inFlight     atomic.Int64
+	unhealthy    atomic.Bool
+	ejectedUntil atomic.Int64
+}
+
+func NewTargets(confs []TargetConfig) ([]*Target, error) {
+	targets := []*Target{}
+	for _, conf := range confs {
+		if conf.URL == "" {
+			return nil, ErrMissingTargetURL
+		}
+
+		if conf.Weight < 0 {
+			return nil, fmt.Errorf("target %s: %w", conf.URL, ErrInvalidWeight)
+		}
+
+		weight := conf.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		targets = append(targets, &Target{
+			URL:    conf.URL,
+			Weight: weight,
+		})
+	}
+
+	return targets, nil
+}
+
+// Acquire must be called before forwarding a request to the target, and
+// Release once the response has been handled.
+func (t *Target) Acquire() {
+	t.inFlight.Add(1)
+}
+
+func (t *Target) Release() {
+	t.inFlight.Add(-1)
+}
+
+// InFlight returns the number of requests currently forwarded to the target.
+func (t *Target) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+// Available reports whether the target can receive requests: it must be
+// healthy and not ejected.
+func (t *Target) Available() bool {
+	return t.Healthy() && !t.Ejected()
+}
+
+func (t *Target) Healthy() bool {
+	return !t.unhealthy.Load()
+}
+
+// SetHealthy records the result of the last active health check.
+func (t *Target) SetHealthy(healthy bool) {
+	t.unhealthy.Store(!healthy)
+}
+
+// Eject removes the target from the balancing pool until the given time.
+func (t *Target) Eject(until time.Time) {
+	t.ejectedUntil.Store(until.UnixNano())
+}
+
+func (t *Target) Ejected() bool {
+	return time.Now().UnixNano() < t.ejectedUntil.Load()
+}
+
+// EjectedUntil returns the end of the current ejection, or the zero time if
+// the target has never been ejected.
+func (t *Target) EjectedUntil() time.Time {
+	until := t.ejectedUntil.Load()
+	if until == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, until)
+}
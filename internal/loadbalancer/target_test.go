@@ -0,0 +1,85 @@
+package loadbalancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTargets(t *testing.T) {
+	type testData struct {
+		name            string
+		confs           []TargetConfig
+		expectedWeights []int
+		shouldFail      bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Success case: default weight",
+			confs: []TargetConfig{
+				{URL: "http://a"},
+				{URL: "http://b", Weight: 3},
+			},
+			expectedWeights: []int{1, 3},
+		},
+		{
+			name: "Fail case: missing url",
+			confs: []TargetConfig{
+				{Weight: 3},
+			},
+			shouldFail: true,
+		},
+		{
+			name: "Fail case: negative weight",
+			confs: []TargetConfig{
+				{URL: "http://a", Weight: -1},
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			targets, err := NewTargets(testCase.confs)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				for i, target := range targets {
+					assert.Equal(t, testCase.confs[i].URL, target.URL)
+					assert.Equal(t, testCase.expectedWeights[i], target.Weight)
+				}
+			}
+		})
+	}
+}
+
+func TestTargetAcquireRelease(t *testing.T) {
+	target := &Target{URL: "http://a"}
+
+	target.Acquire()
+	target.Acquire()
+	assert.Equal(t, int64(2), target.InFlight())
+
+	target.Release()
+	assert.Equal(t, int64(1), target.InFlight())
+}
+
+func TestTargetAvailable(t *testing.T) {
+	target := &Target{URL: "http://a"}
+	assert.True(t, target.Available())
+
+	target.SetHealthy(false)
+	assert.False(t, target.Available())
+
+	target.SetHealthy(true)
+	target.Eject(time.Now().Add(time.Hour))
+	assert.True(t, target.Healthy())
+	assert.True(t, target.Ejected())
+	assert.False(t, target.Available())
+
+	target.Eject(time.Now().Add(-time.Second))
+	assert.True(t, target.Available())
+}
@@ -0,0 +1,49 @@
+package loadbalancer
+
+import "sync"
+
+// weightedRoundRobin implements the smooth weighted round robin algorithm
+// used by nginx: targets are interleaved instead of being picked in bursts.
+type weightedRoundRobin struct {
+	targets        []*Target
+	currentWeights []int
+	mu             sync.Mutex
+}
+
+func newWeightedRoundRobin(targets []*Target) *weightedRoundRobin {
+	return &weightedRoundRobin{
+		targets:        targets,
+		currentWeights: make([]int, len(targets)),
+	}
+}
+
+func (w *weightedRoundRobin) Next() (*Target, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	best := -1
+	total := 0
+	for i, target := range w.targets {
+		if !target.Available() {
+			continue
+		}
+
+		w.currentWeights[i] += target.Weight
+		total += target.Weight
+
+		if best == -1 || w.currentWeights[i] > w.currentWeights[best] {
+			best = i
+		}
+	}
+
+	if best == -1 {
+		return nil, ErrNoTarget
+	}
+
+	w.currentWeights[best] -= total
+	return w.targets[best], nil
+}
+
+func (w *weightedRoundRobin) Targets() []*Target {
+	return w.targets
+}
@@ -0,0 +1,43 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRoundRobinNext(t *testing.T) {
+	targets := []*Target{
+		{URL: "http://a", Weight: 5},
+		{URL: "http://b", Weight: 1},
+		{URL: "http://c", Weight: 1},
+	}
+	balancer := newWeightedRoundRobin(targets)
+
+	// Smooth weighted round robin sequence for weights 5, 1, 1.
+	expected := []string{"http://a", "http://a", "http://b", "http://a", "http://c", "http://a", "http://a"}
+	for _, url := range expected {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, url, target.URL)
+	}
+}
+
+func TestWeightedRoundRobinNextSkipsUnavailableTargets(t *testing.T) {
+	targets := []*Target{
+		{URL: "http://a", Weight: 5},
+		{URL: "http://b", Weight: 1},
+	}
+	balancer := newWeightedRoundRobin(targets)
+
+	targets[0].SetHealthy(false)
+	for i := 0; i < 3; i++ {
+		target, err := balancer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://b", target.URL)
+	}
+
+	targets[1].SetHealthy(false)
+	_, err := balancer.Next()
+	assert.ErrorIs(t, err, ErrNoTarget)
+}
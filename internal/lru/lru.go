@@ -0,0 +1,89 @@
+// Package lru implements a fixed capacity least recently used cache.
+package lru
+
+import "container/list"
+
+// Cache evicts its least recently used entry when full. It is not safe for
+// concurrent use.
+type Cache[K comparable, V any] struct {
+	capacity int
+	entries  map[K]*list.Element
+	order    *list.List
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New returns a cache holding up to capacity entries, unbounded when
+// capacity is not positive.
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		entries:  map[K]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Get returns the value of key and marks it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add sets the value of key, evicting the least recently used entry when the
+// cache is full. It returns the evicted key, if any.
+func (c *Cache[K, V]) Add(key K, value V) (evicted K, ok bool) {
+	if element, found := c.entries[key]; found {
+		element.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return evicted, false
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.capacity <= 0 || c.order.Len() <= c.capacity {
+		return evicted, false
+	}
+
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	evicted = oldest.Value.(*entry[K, V]).key
+	delete(c.entries, evicted)
+
+	return evicted, true
+}
+
+// Remove deletes key from the cache.
+func (c *Cache[K, V]) Remove(key K) {
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Oldest returns the least recently used entry without marking it as used.
+func (c *Cache[K, V]) Oldest() (key K, value V, ok bool) {
+	oldest := c.order.Back()
+	if oldest == nil {
+		return key, value, false
+	}
+
+	e := oldest.Value.(*entry[K, V])
+	return e.key, e.value, true
+}
+
+func (c *Cache[K, V]) Len() int {
+	return c.order.Len()
+}
+
+// Cap returns the maximum number of entries, not positive when unbounded.
+func (c *Cache[K, V]) Cap() int {
+	return c.capacity
+}
@@ -0,0 +1,57 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	cache := New[string, int](2)
+
+	_, evicted := cache.Add("a", 1)
+	assert.False(t, evicted)
+	_, evicted = cache.Add("b", 2)
+	assert.False(t, evicted)
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	// b is the least recently used entry.
+	key, evicted := cache.Add("c", 3)
+	assert.True(t, evicted)
+	assert.Equal(t, "b", key)
+	assert.Equal(t, 2, cache.Len())
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+
+	_, evicted = cache.Add("a", 10)
+	assert.False(t, evicted)
+	value, _ = cache.Get("a")
+	assert.Equal(t, 10, value)
+
+	key, value, ok = cache.Oldest()
+	assert.True(t, ok)
+	assert.Equal(t, "c", key)
+	assert.Equal(t, 3, value)
+
+	cache.Remove("c")
+	assert.Equal(t, 1, cache.Len())
+	_, ok = cache.Get("c")
+	assert.False(t, ok)
+}
+
+func TestCacheUnbounded(t *testing.T) {
+	cache := New[int, int](0)
+	for i := 0; i < 100; i++ {
+		_, evicted := cache.Add(i, i)
+		assert.False(t, evicted)
+	}
+
+	assert.Equal(t, 100, cache.Len())
+
+	_, _, ok := New[int, int](1).Oldest()
+	assert.False(t, ok)
+}
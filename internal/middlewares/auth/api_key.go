@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultAPIKeyHeader = "X-Api-Key"
+
+type APIKeyConfig struct {
+	// Header carrying the key, X-Api-Key by default.
+	Header string `mapstructure:"header"`
+	// Query parameter carrying the key, keys are only read from the header
+	// when empty.
+	QueryParam string         `mapstructure:"query_param"`
+	Store      KeyStoreConfig `mapstructure:"store"`
+}
+
+type apiKeyAuthenticator struct {
+	header     string
+	queryParam string
+	store      KeyStore
+
+	roleChecker       *claimChecker
+	permissionChecker *claimChecker
+}
+
+func newAPIKeyAuthenticator(conf APIKeyConfig) (*apiKeyAuthenticator, error) {
+	store, err := NewKeyStore(conf.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	header := conf.Header
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+
+	return &apiKeyAuthenticator{
+		header:     header,
+		queryParam: conf.QueryParam,
+		store:      store,
+		roleChecker: newClaimChecker(ClaimCheckerConfig{
+			TokenKey:  "roles",
+			ClaimType: ClaimTypeStringList,
+		}),
+		permissionChecker: newClaimChecker(ClaimCheckerConfig{
+			TokenKey:  "permissions",
+			ClaimType: ClaimTypeStringList,
+		}),
+	}, nil
+}
+
+// extract returns the key sent by the client, if any.
+func (a *apiKeyAuthenticator) extract(c *gin.Context) (string, bool) {
+	if key := c.GetHeader(a.header); key != "" {
+		return key, true
+	}
+
+	if a.queryParam != "" {
+		if key := c.Query(a.queryParam); key != "" {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// authenticate looks the key up and exposes it as claims: `sub` holds the key
+// name, `roles` and `permissions` its roles and permissions.
+func (a *apiKeyAuthenticator) authenticate(key string) (*principal, error) {
+	apiKey, err := a.store.Lookup(HashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &principal{
+		token: &jwt.Token{
+			Claims: jwt.MapClaims{
+				"sub":         apiKey.Name,
+				"roles":       toAnySlice(apiKey.Roles),
+				"permissions": toAnySlice(apiKey.Permissions),
+			},
+		},
+		roleChecker:       a.roleChecker,
+		permissionChecker: a.permissionChecker,
+	}, nil
+}
+
+func toAnySlice(values []string) []any {
+	slice := make([]any, 0, len(values))
+	for _, value := range values {
+		slice = append(slice, value)
+	}
+
+	return slice
+}
+
+// strip removes the key from the request.
+func (a *apiKeyAuthenticator) strip(c *gin.Context) {
+	c.Request.Header.Del(a.header)
+
+	if a.queryParam != "" {
+		query := c.Request.URL.Query()
+		if query.Has(a.queryParam) {
+			query.Del(a.queryParam)
+			c.Request.URL.RawQuery = query.Encode()
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyAuthenticatorExtract(t *testing.T) {
+	type testData struct {
+		name        string
+		queryParam  string
+		target      string
+		header      string
+		expectedKey string
+		expectedOk  bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:        "Key in header",
+			target:      "/",
+			header:      "secret",
+			expectedKey: "secret",
+			expectedOk:  true,
+		},
+		{
+			name:        "Key in query",
+			queryParam:  "api_key",
+			target:      "/?api_key=secret",
+			expectedKey: "secret",
+			expectedOk:  true,
+		},
+		{
+			name:       "Query disabled",
+			target:     "/?api_key=secret",
+			expectedOk: false,
+		},
+		{
+			name:       "No key",
+			queryParam: "api_key",
+			target:     "/",
+			expectedOk: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			authenticator := &apiKeyAuthenticator{header: defaultAPIKeyHeader, queryParam: testCase.queryParam}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", testCase.target, nil)
+			if testCase.header != "" {
+				c.Request.Header.Set(defaultAPIKeyHeader, testCase.header)
+			}
+
+			key, ok := authenticator.extract(c)
+			assert.Equal(t, testCase.expectedOk, ok)
+			assert.Equal(t, testCase.expectedKey, key)
+		})
+	}
+}
+
+func TestAPIKeyAuthenticatorStrip(t *testing.T) {
+	authenticator := &apiKeyAuthenticator{header: defaultAPIKeyHeader, queryParam: "api_key"}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?api_key=secret&page=2", nil)
+	c.Request.Header.Set(defaultAPIKeyHeader, "secret")
+
+	authenticator.strip(c)
+	assert.Empty(t, c.Request.Header.Get(defaultAPIKeyHeader))
+	assert.Equal(t, "page=2", c.Request.URL.RawQuery)
+}
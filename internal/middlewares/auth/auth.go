@@ -1,112 +1,528 @@
 package auth
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/Aloe-Corporation/logs"
-	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/FloRichardAloeCorp/gateway/internal/policy"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
+// Authentication modes an endpoint can accept.
+const (
+	ModeBearer = "bearer"
+	ModeAPIKey = "api_key"
+	ModeMTLS   = "mtls"
+	// Session cookie set by the login route of a backend-for-frontend.
+	ModeSession = "session"
+)
+
 var (
 	log = logs.Get()
 
 	ErrNoAuthHeader          = errors.New("authorization header not found")
 	ErrMalformatedAuthHeader = errors.New("authorization header malformated")
+	ErrNoCredentials         = errors.New("no credentials found")
+
+	ErrNoProvider          = errors.New("no provider configured")
+	ErrDuplicateProvider   = errors.New("duplicate provider")
+	ErrUnknownProvider     = errors.New("unknown provider")
+	ErrUnknownIssuer       = errors.New("unknown token issuer")
+	ErrProviderNotAccepted = errors.New("token provider not accepted")
+	ErrNoAudience          = errors.New("provider has no client id or audiences to check")
+
+	ErrUnknownMode     = errors.New("unknown authentication mode")
+	ErrModeNotEnabled  = errors.New("authentication mode not configured")
+	ErrNoAuthenticator = errors.New("no authentication mode configured")
 )
 
 type AuthMiddlewareConfig struct {
-	ProviderURL         string             `mapstructure:"provider_url"`
-	ClientID            string             `mapstructure:"client_id"`
-	AuthorizedRoles     ClaimCheckerConfig `mapstructure:"authorized_roles"`
-	RequiredPermissions ClaimCheckerConfig `mapstructure:"required_permissions"`
+	// Default provider, registered as `default`.
+	ProviderURL string `mapstructure:"provider_url"`
+	ClientID    string `mapstructure:"client_id"`
+	// Accepted token audiences, the provider client ID by default. Services
+	// sharing a provider should require their own audience.
+	Audiences []string `mapstructure:"audiences"`
+	// Optional, clients the tokens must be issued to, read from the `azp`
+	// claim or the `client_id` claim.
+	AuthorizedParties []string `mapstructure:"authorized_parties"`
+	// Optional, issuers the tokens must come from, among the provider ones.
+	Issuers []string `mapstructure:"issuers"`
+	// Optional, verifies tokens of the default provider offline.
+	StaticKeys *StaticKeysConfig `mapstructure:"static_keys"`
+	// Additional providers by name. The provider verifying a token is
+	// selected from its `iss` claim.
+	Providers           map[string]ProviderConfig `mapstructure:"providers"`
+	AuthorizedRoles     ClaimCheckerConfig        `mapstructure:"authorized_roles"`
+	RequiredPermissions ClaimCheckerConfig        `mapstructure:"required_permissions"`
+	// Claims sent to the upstream as request headers. Client supplied copies
+	// of these headers are removed.
+	ForwardedClaims []ForwardedClaimConfig `mapstructure:"forwarded_claims"`
+	// Optional, enables the api_key authentication mode.
+	APIKeys *APIKeyConfig `mapstructure:"api_keys"`
+	// Optional, enables the mtls authentication mode. Client certificates
+	// must be verified by the TLS listener.
+	ClientCertificates *ClientCertificateConfig `mapstructure:"client_certificates"`
+	// Optional, enables the session authentication mode and its login,
+	// callback and logout routes.
+	Session   *SessionConfig  `mapstructure:"session"`
+	Discovery DiscoveryConfig `mapstructure:"discovery"`
 }
 
 type AuthMiddleware struct {
-	Verifier *oidc.IDTokenVerifier
+	providers map[string]*provider
+	issuers   map[string]*provider
+	// Providers validating opaque tokens, sorted by name.
+	introspectionProviders []*provider
+	apiKeys                *apiKeyAuthenticator
+	certs                  *clientCertificateAuthenticator
+	session                *sessionManager
+
+	forwardedClaims []ForwardedClaimConfig
+}
+
+// Rules holds the authorization requirements of an endpoint.
+type Rules struct {
+	AcceptedRoles       []string
+	AcceptedPermissions []string
+	// Override the match modes of the claim checkers.
+	RolesMatch       string
+	PermissionsMatch string
+	// Names of the providers whose tokens are accepted, all providers when
+	// empty.
+	Providers []string
+	// Accepted authentication modes, tried in order. Only bearer tokens are
+	// accepted when empty.
+	Modes []string
+	// Optional, overrides the client certificates accepted by the mtls mode.
+	AllowedCertificates *CertificateAllowList
+	// Optional, override the issuers, audiences and authorized parties
+	// required by the providers.
+	Issuers           []string
+	Audiences         []string
+	AuthorizedParties []string
+	// Optional, expression the request must satisfy.
+	Policy *policy.Policy
+	// Returns the client IP given to the policy, the peer address when nil.
+	ClientIP func(r *http.Request) string
+}
+
+// principal is an authenticated client, its claims are checked against the
+// endpoint rules.
+type principal struct {
+	token *jwt.Token
 
 	roleChecker       *claimChecker
 	permissionChecker *claimChecker
 }
 
-func NewAuthMiddleware(conf AuthMiddlewareConfig) (*AuthMiddleware, error) {
-	provider, err := oidc.NewProvider(context.Background(), conf.ProviderURL)
-	if err != nil {
-		return nil, fmt.Errorf("can't create new provider: %w", err)
+func NewAuthMiddleware(conf AuthMiddlewareConfig) (_ *AuthMiddleware, err error) {
+	providerConfs := map[string]ProviderConfig{}
+	for name, providerConf := range conf.Providers {
+		providerConfs[name] = providerConf
 	}
 
-	oidcConfig := oidc.Config{
-		ClientID: conf.ClientID,
+	if conf.ProviderURL != "" {
+		if _, ok := providerConfs[DefaultProvider]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateProvider, DefaultProvider)
+		}
+
+		providerConfs[DefaultProvider] = ProviderConfig{
+			ProviderURL: conf.ProviderURL,
+			ClientID:    conf.ClientID,
+			StaticKeys:  conf.StaticKeys,
+		}
 	}
 
-	verifier := provider.Verifier(&oidcConfig)
+	if len(providerConfs) == 0 && conf.APIKeys == nil && conf.ClientCertificates == nil {
+		return nil, ErrNoAuthenticator
+	}
 
-	return &AuthMiddleware{
-		Verifier:          verifier,
-		roleChecker:       newClaimChecker(conf.AuthorizedRoles),
-		permissionChecker: newClaimChecker(conf.RequiredPermissions),
-	}, nil
-}
+	middleware := &AuthMiddleware{
+		providers:       map[string]*provider{},
+		issuers:         map[string]*provider{},
+		forwardedClaims: conf.ForwardedClaims,
+	}
+	defer func() {
+		if err != nil {
+			middleware.Stop()
+		}
+	}()
 
-func (a *AuthMiddleware) Guard(acceptedRoles, acceptedPermissions []string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		rawToken, err := extractToken(c)
+	for name, providerConf := range providerConfs {
+		provider, err := newProvider(name, providerConf, conf)
 		if err != nil {
-			log.Error("Auth middleware failure", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "missing token")
-			return
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+
+		if _, ok := middleware.issuers[provider.issuer]; ok {
+			return nil, fmt.Errorf("%w: issuer %s", ErrDuplicateProvider, provider.issuer)
 		}
 
-		_, err = a.Verifier.Verify(c.Request.Context(), rawToken)
+		middleware.providers[name] = provider
+		// Providers only validating opaque tokens may not have an issuer.
+		if provider.issuer != "" {
+			middleware.issuers[provider.issuer] = provider
+		}
+		if provider.introspection {
+			middleware.introspectionProviders = append(middleware.introspectionProviders, provider)
+		}
+	}
+	for _, issuer := range conf.Issuers {
+		if _, ok := middleware.issuers[issuer]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, issuer)
+		}
+	}
+
+	slices.SortFunc(middleware.introspectionProviders, func(a, b *provider) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	if conf.APIKeys != nil {
+		apiKeys, err := newAPIKeyAuthenticator(*conf.APIKeys)
 		if err != nil {
-			log.Error("Auth middleware failure", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid token")
-			return
+			return nil, fmt.Errorf("api keys: %w", err)
+		}
+		middleware.apiKeys = apiKeys
+	}
+
+	if conf.ClientCertificates != nil {
+		middleware.certs = newClientCertificateAuthenticator(*conf.ClientCertificates)
+	}
+
+	if conf.Session != nil {
+		sessionConf := conf.Session.withDefaults()
+		provider, ok := middleware.providers[sessionConf.Provider]
+		if !ok {
+			return nil, fmt.Errorf("session: %w: %s", ErrUnknownProvider, sessionConf.Provider)
 		}
 
-		token, _, err := jwt.NewParser().ParseUnverified(rawToken, jwt.MapClaims{})
+		session, err := newSessionManager(sessionConf, providerConfs[sessionConf.Provider], provider)
+		if err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+		middleware.session = session
+	}
+
+	return middleware, nil
+}
+
+// NotReadyProviders returns the sorted names of the providers whose
+// discovery has not succeeded yet.
+func (a *AuthMiddleware) NotReadyProviders() []string {
+	names := []string{}
+	for name, provider := range a.providers {
+		if !provider.ready() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Stop stops the background discovery of the providers.
+func (a *AuthMiddleware) Stop() {
+	for _, provider := range a.providers {
+		provider.stop()
+	}
+}
+
+// AttachSessionRoutes registers the login, callback and logout routes when
+// the session mode is enabled.
+func (a *AuthMiddleware) AttachSessionRoutes(routes gin.IRoutes) {
+	if a.session != nil {
+		a.session.attachRoutes(routes)
+	}
+}
+
+func (a *AuthMiddleware) Guard(rules Rules) (gin.HandlerFunc, error) {
+	for _, issuer := range rules.Issuers {
+		if _, ok := a.issuers[issuer]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, issuer)
+		}
+	}
+
+	overrides := tokenRequirements{
+		issuers:           rules.Issuers,
+		audiences:         rules.Audiences,
+		authorizedParties: rules.AuthorizedParties,
+	}
+
+	// Requirements of the tokens of the accepted providers.
+	acceptedProviders := map[string]*tokenRequirements{}
+	for _, name := range rules.Providers {
+		provider, ok := a.providers[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+		acceptedProviders[name] = provider.requirements.override(overrides)
+	}
+	if len(rules.Providers) == 0 {
+		for name, provider := range a.providers {
+			acceptedProviders[name] = provider.requirements.override(overrides)
+		}
+	}
+
+	// OIDC tokens are issued to many clients of the provider, they are only
+	// accepted for an audience.
+	acceptsTokens := len(rules.Modes) == 0 || slices.Contains(rules.Modes, ModeBearer) || slices.Contains(rules.Modes, ModeSession)
+	for name, requirements := range acceptedProviders {
+		if acceptsTokens && a.providers[name].requireAudience && len(requirements.audiences) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoAudience, name)
+		}
+	}
+
+	for _, match := range []string{rules.RolesMatch, rules.PermissionsMatch} {
+		if !isMatchMode(match) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMatchMode, match)
+		}
+	}
+
+	modes := rules.Modes
+	if len(modes) == 0 {
+		modes = []string{ModeBearer}
+	}
+
+	for _, mode := range modes {
+		switch mode {
+		case ModeBearer:
+			if len(a.providers) == 0 {
+				return nil, fmt.Errorf("%w: %s", ErrNoProvider, mode)
+			}
+		case ModeAPIKey:
+			if a.apiKeys == nil {
+				return nil, fmt.Errorf("%w: %s", ErrModeNotEnabled, mode)
+			}
+		case ModeMTLS:
+			if a.certs == nil {
+				return nil, fmt.Errorf("%w: %s", ErrModeNotEnabled, mode)
+			}
+		case ModeSession:
+			if a.session == nil {
+				return nil, fmt.Errorf("%w: %s", ErrModeNotEnabled, mode)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMode, mode)
+		}
+	}
+
+	bearer := slices.Contains(modes, ModeBearer)
+
+	return func(c *gin.Context) {
+		if a.certs != nil && a.certs.identityHeader != "" {
+			c.Request.Header.Del(a.certs.identityHeader)
+		}
+
+		principal, err := a.authenticate(c, modes, acceptedProviders, rules.AllowedCertificates)
 		if err != nil {
 			log.Error("Auth middleware failure", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid token")
+			status, body := authenticationFailure(err)
+			abort(c, status, body, bearer)
 			return
 		}
 
-		if len(acceptedRoles) > 0 {
-			ok, err := a.roleChecker.check(token, acceptedRoles)
+		if len(rules.AcceptedRoles) > 0 {
+			ok, err := principal.roleChecker.check(principal.token, rules.AcceptedRoles, rules.RolesMatch)
 			if err != nil {
 				log.Error("Auth middleware failure", zap.Error(err))
-				c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid role")
-				return
 			}
 
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid role")
+				abort(c, http.StatusForbidden, ErrorResponse{
+					Error:            ErrorCodeInsufficientScope,
+					ErrorDescription: "missing required role",
+					Scope:            strings.Join(rules.AcceptedRoles, " "),
+				}, bearer)
 				return
 			}
 		}
 
-		if len(acceptedPermissions) > 0 {
-			ok, err := a.permissionChecker.check(token, acceptedPermissions)
+		if len(rules.AcceptedPermissions) > 0 {
+			ok, err := principal.permissionChecker.check(principal.token, rules.AcceptedPermissions, rules.PermissionsMatch)
 			if err != nil {
 				log.Error("Auth middleware failure", zap.Error(err))
-				c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid permission")
+			}
+
+			if !ok {
+				abort(c, http.StatusForbidden, ErrorResponse{
+					Error:            ErrorCodeInsufficientScope,
+					ErrorDescription: "missing required permission",
+					Scope:            strings.Join(rules.AcceptedPermissions, " "),
+				}, bearer)
 				return
 			}
+		}
+
+		if rules.Policy != nil {
+			ok, err := rules.Policy.Evaluate(policyInput(c, principal.token, rules.ClientIP))
+			if err != nil {
+				log.Error("Auth middleware failure", zap.Error(err))
+			}
 
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid role")
+				abort(c, http.StatusForbidden, ErrorResponse{
+					Error:            ErrorCodeInsufficientScope,
+					ErrorDescription: "denied by policy",
+				}, bearer)
 				return
 			}
 		}
 
+		forwardClaims(c.Request.Header, principal.token, a.forwardedClaims)
+
 		c.Next()
+	}, nil
+}
+
+// authenticate authenticates the client with the first mode it sent
+// credentials for.
+func (a *AuthMiddleware) authenticate(c *gin.Context, modes []string, acceptedProviders map[string]*tokenRequirements, allowedCertificates *CertificateAllowList) (*principal, error) {
+	for _, mode := range modes {
+		switch mode {
+		case ModeBearer:
+			if c.GetHeader("Authorization") != "" {
+				return a.authenticateBearer(c, acceptedProviders)
+			}
+		case ModeAPIKey:
+			if key, ok := a.apiKeys.extract(c); ok {
+				principal, err := a.apiKeys.authenticate(key)
+				if err != nil {
+					return nil, err
+				}
+
+				// The key is a secret of the client, it is not forwarded.
+				a.apiKeys.strip(c)
+				return principal, nil
+			}
+		case ModeMTLS:
+			if cert, ok := a.certs.extract(c); ok {
+				principal, err := a.certs.authenticate(cert, allowedCertificates)
+				if err != nil {
+					return nil, err
+				}
+
+				if a.certs.identityHeader != "" {
+					c.Request.Header.Set(a.certs.identityHeader, certificateIdentity(cert))
+				}
+				return principal, nil
+			}
+		case ModeSession:
+			if _, err := c.Cookie(a.session.conf.CookieName); err == nil {
+				return a.session.authenticate(c, acceptedProviders)
+			}
+		}
+	}
+
+	return nil, ErrNoCredentials
+}
+
+func (a *AuthMiddleware) authenticateBearer(c *gin.Context, acceptedProviders map[string]*tokenRequirements) (*principal, error) {
+	rawToken, err := extractToken(c)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := a.selectProvider(rawToken)
+	if errors.Is(err, jwt.ErrTokenMalformed) {
+		return a.authenticateOpaque(c, rawToken, acceptedProviders, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	requirements, ok := acceptedProviders[provider.name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotAccepted, provider.name)
+	}
+
+	token, err := provider.verify(c.Request.Context(), rawToken, requirements)
+	if err != nil {
+		return nil, err
 	}
+
+	return &principal{
+		token:             token,
+		roleChecker:       provider.roleChecker,
+		permissionChecker: provider.permissionChecker,
+	}, nil
+}
+
+// authenticateOpaque validates a token that is not a JWT with the accepted
+// providers supporting introspection, in order. parseErr is returned when
+// none of them does.
+func (a *AuthMiddleware) authenticateOpaque(c *gin.Context, rawToken string, acceptedProviders map[string]*tokenRequirements, parseErr error) (*principal, error) {
+	err := parseErr
+	for _, provider := range a.introspectionProviders {
+		requirements, ok := acceptedProviders[provider.name]
+		if !ok {
+			continue
+		}
+
+		var token *jwt.Token
+		token, err = provider.verify(c.Request.Context(), rawToken, requirements)
+		if err != nil {
+			continue
+		}
+
+		return &principal{
+			token:             token,
+			roleChecker:       provider.roleChecker,
+			permissionChecker: provider.permissionChecker,
+		}, nil
+	}
+
+	return nil, err
+}
+
+// selectProvider returns the provider that issued the token, read from the
+// unverified `iss` claim.
+func (a *AuthMiddleware) selectProvider(rawToken string) (*provider, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(rawToken, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := a.issuers[issuer]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, issuer)
+	}
+
+	return provider, nil
+}
+
+func policyInput(c *gin.Context, token *jwt.Token, clientIP func(r *http.Request) string) policy.Input {
+	input := policy.Input{
+		PathParams: map[string]string{},
+		Header:     c.Request.Header,
+		Method:     c.Request.Method,
+		ClientIP:   c.RemoteIP(),
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		input.Claims = claims
+	}
+
+	for _, param := range c.Params {
+		input.PathParams[param.Key] = param.Value
+	}
+
+	if clientIP != nil {
+		input.ClientIP = clientIP(c.Request)
+	}
+
+	return input
 }
 
 func extractToken(c *gin.Context) (string, error) {
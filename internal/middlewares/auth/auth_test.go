@@ -1,14 +1,20 @@
 package auth
 
 import (
-	"errors"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	// model "github.com/FloRichardAloeCorp/gateway/pkg/structs"
 
+	"github.com/FloRichardAloeCorp/gateway/internal/policy"
 	"github.com/FloRichardAloeCorp/gateway/internal/test"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -36,13 +42,80 @@ func TestNewAuthMiddleware(t *testing.T) {
 			},
 		},
 		{
-			name:       "Fail case: invalid test provider",
+			name:       "Success case: named providers",
+			shouldFail: false,
+			conf: AuthMiddlewareConfig{
+				Providers: map[string]ProviderConfig{
+					"staff": {
+						ProviderURL: server.URL,
+						ClientID:    "1234567890",
+					},
+				},
+			},
+		},
+		{
+			name:       "Success case: static keys without discovery",
+			shouldFail: false,
+			conf: AuthMiddlewareConfig{
+				ProviderURL: "http://unreachable.local",
+				ClientID:    "1234567890",
+				StaticKeys: &StaticKeysConfig{
+					PublicKeys: []string{test.RS256PublicKey},
+				},
+			},
+		},
+		{
+			name:        "Fail case: no provider",
+			shouldFail:  true,
+			conf:        AuthMiddlewareConfig{},
+			expectedErr: ErrNoAuthenticator,
+		},
+		{
+			name:       "Fail case: duplicate issuer",
+			shouldFail: true,
+			conf: AuthMiddlewareConfig{
+				ProviderURL: server.URL,
+				ClientID:    "1234567890",
+				Providers: map[string]ProviderConfig{
+					"staff": {
+						ProviderURL: server.URL,
+						ClientID:    "1234567890",
+					},
+				},
+			},
+			expectedErr: ErrDuplicateProvider,
+		},
+		{
+			name:       "Fail case: unknown required issuer",
 			shouldFail: true,
+			conf: AuthMiddlewareConfig{
+				ProviderURL: server.URL,
+				ClientID:    "1234567890",
+				Issuers:     []string{"https://other.example.com"},
+			},
+			expectedErr: ErrUnknownIssuer,
+		},
+		{
+			name:       "Fail case: unsupported match mode",
+			shouldFail: true,
+			conf: AuthMiddlewareConfig{
+				ProviderURL: server.URL,
+				ClientID:    "1234567890",
+				RequiredPermissions: ClaimCheckerConfig{
+					TokenKey:  "scope",
+					ClaimType: ClaimTypeSpaceSeparated,
+					Match:     "some",
+				},
+			},
+			expectedErr: ErrUnsupportedMatchMode,
+		},
+		{
+			name:       "Success case: unreachable provider discovered in background",
+			shouldFail: false,
 			conf: AuthMiddlewareConfig{
 				ProviderURL: "invalid",
 				ClientID:    "1234567890",
 			},
-			expectedErr: errors.New("can't create new provider"),
 		},
 	}
 
@@ -65,8 +138,10 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 		conf                AuthMiddlewareConfig
 		acceptedRoles       []string
 		acceptedPermissions []string
+		permissionsMatch    string
 		header              http.Header
 		expectedStatusCode  int
+		expectedWWWAuth     string
 	}
 
 	provider := test.LaunchTestProvider()
@@ -140,6 +215,71 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 			},
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name: "Success case: all of the scopes",
+			conf: AuthMiddlewareConfig{
+				ProviderURL: provider.URL,
+				ClientID:    "123456",
+				RequiredPermissions: ClaimCheckerConfig{
+					TokenKey:  "scope",
+					ClaimType: ClaimTypeSpaceSeparated,
+				},
+			},
+			acceptedPermissions: []string{
+				"orders:read",
+				"orders:write",
+			},
+			permissionsMatch: MatchAll,
+			header: http.Header{
+				"Authorization": []string{
+					"Bearer " + test.NewToken(jwt.MapClaims{
+						"iss":   provider.URL,
+						"exp":   jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+						"aud":   jwt.ClaimStrings{"123456"},
+						"scope": "openid orders:read orders:write",
+					}),
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "Fail case: missing one of the scopes",
+			conf: AuthMiddlewareConfig{
+				ProviderURL: provider.URL,
+				ClientID:    "123456",
+				RequiredPermissions: ClaimCheckerConfig{
+					TokenKey:  "scope",
+					ClaimType: ClaimTypeSpaceSeparated,
+				},
+			},
+			acceptedPermissions: []string{
+				"orders:read",
+				"orders:write",
+			},
+			permissionsMatch: MatchAll,
+			header: http.Header{
+				"Authorization": []string{
+					"Bearer " + test.NewToken(jwt.MapClaims{
+						"iss":   provider.URL,
+						"exp":   jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+						"aud":   jwt.ClaimStrings{"123456"},
+						"scope": "openid orders:read",
+					}),
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedWWWAuth:    `Bearer error="insufficient_scope", error_description="missing required permission", scope="orders:read orders:write"`,
+		},
+		{
+			name: "Fail case: no credentials",
+			conf: AuthMiddlewareConfig{
+				ProviderURL: provider.URL,
+				ClientID:    "123456",
+			},
+			header:             http.Header{},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedWWWAuth:    "Bearer",
+		},
 		{
 			name: "Fail case: no token in header",
 			conf: AuthMiddlewareConfig{
@@ -152,6 +292,7 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 				},
 			},
 			expectedStatusCode: http.StatusUnauthorized,
+			expectedWWWAuth:    `Bearer error="invalid_request", error_description="malformed authorization header"`,
 		},
 		{
 			name: "Fail case: expired token",
@@ -169,6 +310,7 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 				},
 			},
 			expectedStatusCode: http.StatusUnauthorized,
+			expectedWWWAuth:    `Bearer error="invalid_token", error_description="token expired"`,
 		},
 		{
 			name: "Fail case: invalid role",
@@ -193,7 +335,8 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 					}),
 				},
 			},
-			expectedStatusCode: http.StatusUnauthorized,
+			expectedStatusCode: http.StatusForbidden,
+			expectedWWWAuth:    `Bearer error="insufficient_scope", error_description="missing required role", scope="manager"`,
 		},
 		{
 			name: "Fail case: invalid role key",
@@ -218,7 +361,8 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 					}),
 				},
 			},
-			expectedStatusCode: http.StatusUnauthorized,
+			expectedStatusCode: http.StatusForbidden,
+			expectedWWWAuth:    `Bearer error="insufficient_scope", error_description="missing required role", scope="manager"`,
 		},
 		{
 			name: "Fail case: invalid permission",
@@ -243,7 +387,8 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 					}),
 				},
 			},
-			expectedStatusCode: http.StatusUnauthorized,
+			expectedStatusCode: http.StatusForbidden,
+			expectedWWWAuth:    `Bearer error="insufficient_scope", error_description="missing required permission", scope="read"`,
 		},
 		{
 			name: "Fail case: invalid permission key",
@@ -268,7 +413,8 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 					}),
 				},
 			},
-			expectedStatusCode: http.StatusUnauthorized,
+			expectedStatusCode: http.StatusForbidden,
+			expectedWWWAuth:    `Bearer error="insufficient_scope", error_description="missing required permission", scope="read"`,
 		},
 	}
 
@@ -282,7 +428,622 @@ func TestAuthMiddlewareGuard(t *testing.T) {
 			middleware, err := NewAuthMiddleware(testCase.conf)
 			assert.NoError(t, err)
 
-			middleware.Guard(testCase.acceptedRoles, testCase.acceptedPermissions)(c)
+			guard, err := middleware.Guard(Rules{
+				AcceptedRoles:       testCase.acceptedRoles,
+				AcceptedPermissions: testCase.acceptedPermissions,
+				PermissionsMatch:    testCase.permissionsMatch,
+			})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+			assert.Equal(t, testCase.expectedWWWAuth, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestAuthMiddlewareGuardProviders(t *testing.T) {
+	type testData struct {
+		name               string
+		providers          []string
+		issuer             string
+		expectedStatusCode int
+	}
+
+	staff := test.LaunchTestProvider()
+	customers := test.LaunchTestProvider()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: staff.URL,
+		ClientID:    "123456",
+		Providers: map[string]ProviderConfig{
+			"customers": {
+				ProviderURL: customers.URL,
+				ClientID:    "654321",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: default provider",
+			issuer:             staff.URL,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: provider selected from issuer",
+			issuer:             customers.URL,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: accepted provider",
+			providers:          []string{"customers"},
+			issuer:             customers.URL,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: provider not accepted",
+			providers:          []string{DefaultProvider},
+			issuer:             customers.URL,
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: unknown issuer",
+			issuer:             "http://unknown",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			audience := "123456"
+			if testCase.issuer == customers.URL {
+				audience = "654321"
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{}
+			c.Request.Header = http.Header{
+				"Authorization": []string{
+					"Bearer " + test.NewToken(jwt.MapClaims{
+						"iss": testCase.issuer,
+						"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+						"aud": jwt.ClaimStrings{audience},
+					}),
+				},
+			}
+
+			guard, err := middleware.Guard(Rules{Providers: testCase.providers})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+
+	_, err = middleware.Guard(Rules{Providers: []string{"unknown"}})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestAuthMiddlewareGuardServiceIsolation(t *testing.T) {
+	type testData struct {
+		name               string
+		middleware         *AuthMiddleware
+		claims             jwt.MapClaims
+		expectedStatusCode int
+	}
+
+	provider := test.LaunchTestProvider()
+
+	// Two services sharing the provider and its client.
+	orders, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "gateway",
+		Audiences:   []string{"orders"},
+		Issuers:     []string{provider.URL},
+	})
+	assert.NoError(t, err)
+
+	billing, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL:       provider.URL,
+		ClientID:          "gateway",
+		Audiences:         []string{"billing"},
+		AuthorizedParties: []string{"web"},
+	})
+	assert.NoError(t, err)
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: token minted for the service",
+			middleware:         orders,
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"orders"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: token minted for several services",
+			middleware:         billing,
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"orders", "billing"}, "azp": "web"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: token minted for another service",
+			middleware:         billing,
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"orders"}, "azp": "web"},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: client id is not an accepted audience",
+			middleware:         orders,
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"gateway"}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: other authorized party",
+			middleware:         billing,
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"billing"}, "azp": "mobile"},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": provider.URL,
+				"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+			}
+			for key, value := range testCase.claims {
+				claims[key] = value
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{}
+			c.Request.Header = http.Header{
+				"Authorization": []string{"Bearer " + test.NewToken(claims)},
+			}
+
+			guard, err := testCase.middleware.Guard(Rules{})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+}
+
+func TestAuthMiddlewareGuardRequirementsOverride(t *testing.T) {
+	type testData struct {
+		name               string
+		rules              Rules
+		claims             jwt.MapClaims
+		expectedStatusCode int
+	}
+
+	provider := test.LaunchTestProvider()
+
+	// The endpoints override the requirements of the shared middleware.
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "gateway",
+	})
+	assert.NoError(t, err)
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: provider audience",
+			rules:              Rules{},
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"gateway"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: overridden audience",
+			rules:              Rules{Audiences: []string{"orders"}},
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"orders"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: overridden issuer and authorized party",
+			rules:              Rules{Issuers: []string{provider.URL}, AuthorizedParties: []string{"web"}},
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"gateway"}, "azp": "web"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: provider audience replaced",
+			rules:              Rules{Audiences: []string{"orders"}},
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"gateway"}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: other authorized party",
+			rules:              Rules{AuthorizedParties: []string{"web"}},
+			claims:             jwt.MapClaims{"aud": jwt.ClaimStrings{"gateway"}, "azp": "mobile"},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": provider.URL,
+				"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+			}
+			for key, value := range testCase.claims {
+				claims[key] = value
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{}
+			c.Request.Header = http.Header{
+				"Authorization": []string{"Bearer " + test.NewToken(claims)},
+			}
+
+			guard, err := middleware.Guard(testCase.rules)
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+
+	t.Run("Fail case: unknown issuer", func(t *testing.T) {
+		_, err := middleware.Guard(Rules{Issuers: []string{"https://other.example.com"}})
+		assert.ErrorIs(t, err, ErrUnknownIssuer)
+	})
+}
+
+func TestAuthMiddlewareGuardNoAudience(t *testing.T) {
+	provider := test.LaunchTestProvider()
+
+	// Without client id nor audiences, any token of the provider would be
+	// accepted.
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL:        provider.URL,
+		ClientCertificates: &ClientCertificateConfig{},
+	})
+	assert.NoError(t, err)
+	defer middleware.Stop()
+
+	t.Run("Fail case: no audience", func(t *testing.T) {
+		_, err := middleware.Guard(Rules{})
+		assert.ErrorIs(t, err, ErrNoAudience)
+	})
+
+	t.Run("Success case: endpoint audiences", func(t *testing.T) {
+		_, err := middleware.Guard(Rules{Audiences: []string{"orders"}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Success case: no token accepted", func(t *testing.T) {
+		_, err := middleware.Guard(Rules{Modes: []string{ModeMTLS}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthMiddlewareGuardAPIKey(t *testing.T) {
+	type testData struct {
+		name                string
+		modes               []string
+		acceptedRoles       []string
+		acceptedPermissions []string
+		target              string
+		header              http.Header
+		expectedStatusCode  int
+	}
+
+	storePath := filepath.Join(t.TempDir(), "keys.yaml")
+	err := os.WriteFile(storePath, []byte(`keys:
+  - name: partner
+    hash: `+HashAPIKey("secret")+`
+    roles: [partner]
+    permissions: [orders:read]
+`), 0600)
+	assert.NoError(t, err)
+
+	provider := test.LaunchTestProvider()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+		APIKeys: &APIKeyConfig{
+			QueryParam: "api_key",
+			Store: KeyStoreConfig{
+				Type: KeyStoreYAML,
+				Path: storePath,
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: key in header",
+			modes:              []string{ModeAPIKey},
+			target:             "/",
+			header:             http.Header{"X-Api-Key": []string{"secret"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: key in query",
+			modes:              []string{ModeAPIKey},
+			target:             "/?api_key=secret",
+			header:             http.Header{},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:                "Success case: key roles and permissions",
+			modes:               []string{ModeBearer, ModeAPIKey},
+			acceptedRoles:       []string{"partner"},
+			acceptedPermissions: []string{"orders:read"},
+			target:              "/",
+			header:              http.Header{"X-Api-Key": []string{"secret"}},
+			expectedStatusCode:  http.StatusOK,
+		},
+		{
+			name:               "Success case: bearer token with both modes",
+			modes:              []string{ModeAPIKey, ModeBearer},
+			target:             "/",
+			header:             http.Header{"Authorization": []string{"Bearer " + test.NewToken(jwt.MapClaims{"iss": provider.URL, "exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)), "aud": jwt.ClaimStrings{"123456"}})}},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: invalid role",
+			modes:              []string{ModeAPIKey},
+			acceptedRoles:      []string{"admin"},
+			target:             "/",
+			header:             http.Header{"X-Api-Key": []string{"secret"}},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "Fail case: unknown key",
+			modes:              []string{ModeAPIKey},
+			target:             "/",
+			header:             http.Header{"X-Api-Key": []string{"other"}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: api key mode not accepted",
+			modes:              nil,
+			target:             "/",
+			header:             http.Header{"X-Api-Key": []string{"secret"}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", testCase.target, nil)
+			c.Request.Header = testCase.header
+
+			guard, err := middleware.Guard(Rules{
+				AcceptedRoles:       testCase.acceptedRoles,
+				AcceptedPermissions: testCase.acceptedPermissions,
+				Modes:               testCase.modes,
+			})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+			if w.Code == http.StatusOK {
+				assert.Empty(t, c.Request.Header.Get("X-Api-Key"))
+				assert.Empty(t, c.Request.URL.Query().Get("api_key"))
+			}
+		})
+	}
+
+	_, err = middleware.Guard(Rules{Modes: []string{"unknown"}})
+	assert.ErrorIs(t, err, ErrUnknownMode)
+
+	withoutKeys, err := NewAuthMiddleware(AuthMiddlewareConfig{ProviderURL: provider.URL, ClientID: "123456"})
+	assert.NoError(t, err)
+	_, err = withoutKeys.Guard(Rules{Modes: []string{ModeAPIKey}})
+	assert.ErrorIs(t, err, ErrModeNotEnabled)
+}
+
+func TestAuthMiddlewareGuardClientCertificate(t *testing.T) {
+	type testData struct {
+		name                string
+		allowedCertificates *CertificateAllowList
+		cert                *x509.Certificate
+		verified            bool
+		expectedStatusCode  int
+		expectedIdentity    string
+	}
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ClientCertificates: &ClientCertificateConfig{
+			Allowed: CertificateAllowList{
+				URIs: []string{"spiffe://example.org/*"},
+			},
+			IdentityHeader: "X-Client-Identity",
+		},
+	})
+	assert.NoError(t, err)
+
+	spiffeCert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "orders"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/orders"}},
+	}
+	billingCert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: allowed SPIFFE ID",
+			cert:               spiffeCert,
+			verified:           true,
+			expectedStatusCode: http.StatusOK,
+			expectedIdentity:   "spiffe://example.org/orders",
+		},
+		{
+			name:                "Success case: endpoint allow list",
+			allowedCertificates: &CertificateAllowList{CommonNames: []string{"billing"}},
+			cert:                billingCert,
+			verified:            true,
+			expectedStatusCode:  http.StatusOK,
+			expectedIdentity:    "billing",
+		},
+		{
+			name:               "Fail case: certificate not allowed",
+			cert:               billingCert,
+			verified:           true,
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: certificate not verified",
+			cert:               spiffeCert,
+			verified:           false,
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("X-Client-Identity", "spoofed")
+			c.Request.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{testCase.cert},
+			}
+			if testCase.verified {
+				c.Request.TLS.VerifiedChains = [][]*x509.Certificate{{testCase.cert}}
+			}
+
+			guard, err := middleware.Guard(Rules{
+				Modes:               []string{ModeMTLS},
+				AllowedCertificates: testCase.allowedCertificates,
+			})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+			assert.Equal(t, testCase.expectedIdentity, c.Request.Header.Get("X-Client-Identity"))
+		})
+	}
+}
+
+func TestAuthMiddlewareGuardForwardedClaims(t *testing.T) {
+	provider := test.LaunchTestProvider()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+		ForwardedClaims: []ForwardedClaimConfig{
+			{Claim: "sub", Header: "X-User-Id"},
+			{Claim: "org.id", Header: "X-Tenant"},
+		},
+	})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{}
+	c.Request.Header = http.Header{
+		"Authorization": []string{
+			"Bearer " + test.NewToken(jwt.MapClaims{
+				"iss": provider.URL,
+				"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+				"aud": jwt.ClaimStrings{"123456"},
+				"sub": "user-1",
+			}),
+		},
+		"X-User-Id": []string{"spoofed"},
+		"X-Tenant":  []string{"spoofed"},
+	}
+
+	guard, err := middleware.Guard(Rules{})
+	assert.NoError(t, err)
+
+	guard(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-1", c.Request.Header.Get("X-User-Id"))
+	assert.Empty(t, c.Request.Header.Get("X-Tenant"))
+}
+
+func TestAuthMiddlewareGuardPolicy(t *testing.T) {
+	type testData struct {
+		name               string
+		policy             string
+		claims             jwt.MapClaims
+		tenant             string
+		clientIP           func(r *http.Request) string
+		expectedStatusCode int
+	}
+
+	provider := test.LaunchTestProvider()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+	})
+	assert.NoError(t, err)
+
+	rolesOrScope := `"admin" in claims.roles || ("orders:write" in claims.scope.split(" ") && claims.tenant == path.tenant)`
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: role",
+			policy:             rolesOrScope,
+			claims:             jwt.MapClaims{"roles": []string{"admin"}},
+			tenant:             "acme",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: scope and tenant",
+			policy:             rolesOrScope,
+			claims:             jwt.MapClaims{"scope": "orders:read orders:write", "tenant": "acme"},
+			tenant:             "acme",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: client ip",
+			policy:             `client_ip == "10.0.0.1" && method == "GET"`,
+			clientIP:           func(*http.Request) string { return "10.0.0.1" },
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: other tenant",
+			policy:             rolesOrScope,
+			claims:             jwt.MapClaims{"scope": "orders:write", "tenant": "acme"},
+			tenant:             "other",
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "Fail case: missing claims",
+			policy:             rolesOrScope,
+			tenant:             "acme",
+			expectedStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": provider.URL,
+				"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+				"aud": jwt.ClaimStrings{"123456"},
+			}
+			for key, value := range testCase.claims {
+				claims[key] = value
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/tenants/"+testCase.tenant, nil)
+			c.Request.Header.Set("Authorization", "Bearer "+test.NewToken(claims))
+			c.Params = gin.Params{{Key: "tenant", Value: testCase.tenant}}
+
+			endpointPolicy, err := policy.Compile(testCase.policy, "/tenants/:tenant")
+			assert.NoError(t, err)
+
+			guard, err := middleware.Guard(Rules{Policy: endpointPolicy, ClientIP: testCase.clientIP})
+			assert.NoError(t, err)
+
+			guard(c)
 			assert.Equal(t, testCase.expectedStatusCode, w.Code)
 		})
 	}
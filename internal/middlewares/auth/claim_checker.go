@@ -15,59 +15,122 @@ var (
 
 	ErrInvalidClaimType     = errors.New("can't cast token claim to provided type")
 	ErrUnsupportedClaimType = errors.New("unsupported provided claim type")
+	ErrUnsupportedMatchMode = errors.New("unsupported match mode")
+)
+
+// Claim types of the checked claims.
+const (
+	ClaimTypeString     = "string"
+	ClaimTypeStringList = "[]string"
+	// Space-delimited string, such as the OAuth2 `scope` claim.
+	ClaimTypeSpaceSeparated = "space_separated"
+)
+
+// Match modes of the accepted values.
+const (
+	// The claim holds one of the accepted values.
+	MatchAny = "any"
+	// The claim holds all the accepted values.
+	MatchAll = "all"
 )
 
 type ClaimCheckerConfig struct {
 	TokenKey  string   `mapstructure:"token_key"`
 	ClaimType string   `mapstructure:"claim_type"`
 	Values    []string `mapstructure:"values"`
+	// `any` by default, endpoints can override it.
+	Match string `mapstructure:"match"`
 }
 
 type claimChecker struct {
 	tokenKey  string
 	claimType string
+	match     string
+}
+
+func isMatchMode(match string) bool {
+	return match == "" || match == MatchAny || match == MatchAll
 }
 
 func newClaimChecker(conf ClaimCheckerConfig) *claimChecker {
 	return &claimChecker{
 		tokenKey:  conf.TokenKey,
 		claimType: conf.ClaimType,
+		match:     conf.Match,
 	}
 }
 
-func (c *claimChecker) check(token *jwt.Token, acceptedValues []string) (bool, error) {
+// check reports whether the claim matches the accepted values with the match
+// mode, the checker one when match is empty.
+func (c *claimChecker) check(token *jwt.Token, acceptedValues []string, match string) (bool, error) {
+	if match == "" {
+		match = c.match
+	}
+
 	rawClaim, err := findClaim(c.tokenKey, token)
 	if err != nil {
 		return false, err
 	}
 
+	values, err := c.claimValues(rawClaim)
+	if err != nil {
+		return false, err
+	}
+
+	switch match {
+	case "", MatchAny:
+		for _, value := range values {
+			if slices.Contains(acceptedValues, value) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case MatchAll:
+		for _, accepted := range acceptedValues {
+			if !slices.Contains(values, accepted) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedMatchMode, match)
+	}
+}
+
+func (c *claimChecker) claimValues(rawClaim any) ([]string, error) {
 	switch c.claimType {
-	case "string":
+	case ClaimTypeString:
 		claim, ok := rawClaim.(string)
 		if !ok {
-			return false, fmt.Errorf("can't cast claim to string: %w", ErrInvalidClaimType)
+			return nil, fmt.Errorf("can't cast claim to string: %w", ErrInvalidClaimType)
 		}
-		return slices.Contains(acceptedValues, claim), nil
-	case "[]string":
+		return []string{claim}, nil
+	case ClaimTypeStringList:
 		claim, ok := rawClaim.([]any)
 		if !ok {
-			return false, fmt.Errorf("can't cast claim to []string: %w", ErrInvalidClaimType)
+			return nil, fmt.Errorf("can't cast claim to []string: %w", ErrInvalidClaimType)
 		}
 
+		values := make([]string, 0, len(claim))
 		for _, value := range claim {
 			strValue, ok := value.(string)
 			if !ok {
-				return false, fmt.Errorf("can't cast claim element to string: %w", ErrInvalidClaimType)
-			}
-
-			if slices.Contains(acceptedValues, strValue) {
-				return true, nil
+				return nil, fmt.Errorf("can't cast claim element to string: %w", ErrInvalidClaimType)
 			}
+			values = append(values, strValue)
 		}
 
-		return false, nil
+		return values, nil
+	case ClaimTypeSpaceSeparated:
+		claim, ok := rawClaim.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't cast claim to string: %w", ErrInvalidClaimType)
+		}
+		return strings.Fields(claim), nil
 	default:
-		return false, ErrUnsupportedClaimType
+		return nil, ErrUnsupportedClaimType
 	}
 }
 
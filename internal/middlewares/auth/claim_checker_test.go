@@ -15,6 +15,7 @@ func TestClaimCheckerCheck(t *testing.T) {
 		instance       claimChecker
 		token          *jwt.Token
 		acceptedValues []string
+		match          string
 		shouldFail     bool
 		expectedErr    error
 		expectedRes    bool
@@ -253,6 +254,131 @@ func TestClaimCheckerCheck(t *testing.T) {
 			expectedRes: false,
 			expectedErr: fmt.Errorf("can't cast claim to []string: %w", ErrInvalidClaimType),
 		},
+		{
+			name: "Success case: space separated type",
+			instance: claimChecker{
+				tokenKey:  "scope",
+				claimType: ClaimTypeSpaceSeparated,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"scope": "openid orders:read  orders:write",
+				},
+			},
+			acceptedValues: []string{
+				"orders:write",
+				"orders:delete",
+			},
+			expectedRes: true,
+		},
+		{
+			name: "Success case: all of the values",
+			instance: claimChecker{
+				tokenKey:  "scope",
+				claimType: ClaimTypeSpaceSeparated,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"scope": "openid orders:read orders:write",
+				},
+			},
+			acceptedValues: []string{
+				"orders:read",
+				"orders:write",
+			},
+			match:       MatchAll,
+			expectedRes: true,
+		},
+		{
+			name: "Success case: missing one of all the values",
+			instance: claimChecker{
+				tokenKey:  "scope",
+				claimType: ClaimTypeSpaceSeparated,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"scope": "openid orders:read",
+				},
+			},
+			acceptedValues: []string{
+				"orders:read",
+				"orders:write",
+			},
+			match:       MatchAll,
+			expectedRes: false,
+		},
+		{
+			name: "Success case: checker match mode",
+			instance: claimChecker{
+				tokenKey:  "roles",
+				claimType: ClaimTypeStringList,
+				match:     MatchAll,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"roles": []any{"user"},
+				},
+			},
+			acceptedValues: []string{
+				"user",
+				"manager",
+			},
+			expectedRes: false,
+		},
+		{
+			name: "Success case: endpoint overrides checker match mode",
+			instance: claimChecker{
+				tokenKey:  "roles",
+				claimType: ClaimTypeStringList,
+				match:     MatchAll,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"roles": []any{"user"},
+				},
+			},
+			acceptedValues: []string{
+				"user",
+				"manager",
+			},
+			match:       MatchAny,
+			expectedRes: true,
+		},
+		{
+			name: "Fail case: space separated type with array claim",
+			instance: claimChecker{
+				tokenKey:  "scope",
+				claimType: ClaimTypeSpaceSeparated,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"scope": []any{"orders:read"},
+				},
+			},
+			acceptedValues: []string{
+				"orders:read",
+			},
+			shouldFail:  true,
+			expectedErr: fmt.Errorf("can't cast claim to string: %w", ErrInvalidClaimType),
+		},
+		{
+			name: "Fail case: unsupported match mode",
+			instance: claimChecker{
+				tokenKey:  "role",
+				claimType: ClaimTypeString,
+			},
+			token: &jwt.Token{
+				Claims: jwt.MapClaims{
+					"role": "user",
+				},
+			},
+			acceptedValues: []string{
+				"user",
+			},
+			match:       "some",
+			shouldFail:  true,
+			expectedErr: fmt.Errorf("%w: some", ErrUnsupportedMatchMode),
+		},
 		{
 			name: "Fail case: unsupported claim type",
 			instance: claimChecker{
@@ -276,7 +402,7 @@ func TestClaimCheckerCheck(t *testing.T) {
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			valid, err := testCase.instance.check(testCase.token, testCase.acceptedValues)
+			valid, err := testCase.instance.check(testCase.token, testCase.acceptedValues, testCase.match)
 			if testCase.shouldFail {
 				assert.Error(t, err)
 				assert.Equal(t, testCase.expectedErr, err)
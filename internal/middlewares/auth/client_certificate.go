@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoClientCertificate         = errors.New("no verified client certificate")
+	ErrClientCertificateNotAllowed = errors.New("client certificate not allowed")
+)
+
+// CertificateAllowList lists the accepted client certificate identities.
+// Entries ending with `*` match any value starting with the rest of the
+// entry, e.g. `spiffe://example.org/*`.
+type CertificateAllowList struct {
+	CommonNames []string `mapstructure:"common_names"`
+	DNSNames    []string `mapstructure:"dns_names"`
+	// URI SANs, including SPIFFE IDs.
+	URIs []string `mapstructure:"uris"`
+}
+
+func (l CertificateAllowList) isEmpty() bool {
+	return len(l.CommonNames) == 0 && len(l.DNSNames) == 0 && len(l.URIs) == 0
+}
+
+// allows reports whether the certificate matches the allow list. Any
+// certificate matches an empty allow list.
+func (l CertificateAllowList) allows(cert *x509.Certificate) bool {
+	if l.isEmpty() {
+		return true
+	}
+
+	if matchesAny(l.CommonNames, cert.Subject.CommonName) {
+		return true
+	}
+
+	for _, name := range cert.DNSNames {
+		if matchesAny(l.DNSNames, name) {
+			return true
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if matchesAny(l.URIs, uri.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(value, prefix)
+		}
+		return pattern == value
+	})
+}
+
+type ClientCertificateConfig struct {
+	// Certificates accepted by endpoints that don't define their own allow
+	// list.
+	Allowed CertificateAllowList `mapstructure:"allowed"`
+	// Header receiving the verified identity, the SPIFFE ID of the
+	// certificate or its subject common name. Not forwarded when empty.
+	IdentityHeader string `mapstructure:"identity_header"`
+}
+
+// clientCertificateAuthenticator authenticates clients from the certificate
+// verified by the TLS listener.
+type clientCertificateAuthenticator struct {
+	allowed        CertificateAllowList
+	identityHeader string
+}
+
+func newClientCertificateAuthenticator(conf ClientCertificateConfig) *clientCertificateAuthenticator {
+	return &clientCertificateAuthenticator{
+		allowed:        conf.Allowed,
+		identityHeader: conf.IdentityHeader,
+	}
+}
+
+// extract returns the verified client certificate, if any.
+func (a *clientCertificateAuthenticator) extract(c *gin.Context) (*x509.Certificate, bool) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return state.VerifiedChains[0][0], true
+}
+
+// authenticate exposes the certificate as claims: `sub` holds its identity,
+// `cn`, `dns_names` and `uris` its subject common name and SANs.
+func (a *clientCertificateAuthenticator) authenticate(cert *x509.Certificate, allowed *CertificateAllowList) (*principal, error) {
+	allowList := a.allowed
+	if allowed != nil {
+		allowList = *allowed
+	}
+
+	if !allowList.allows(cert) {
+		return nil, ErrClientCertificateNotAllowed
+	}
+
+	uris := []string{}
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	return &principal{
+		token: &jwt.Token{
+			Claims: jwt.MapClaims{
+				"sub":       certificateIdentity(cert),
+				"cn":        cert.Subject.CommonName,
+				"dns_names": toAnySlice(cert.DNSNames),
+				"uris":      toAnySlice(uris),
+			},
+		},
+		roleChecker:       newClaimChecker(ClaimCheckerConfig{}),
+		permissionChecker: newClaimChecker(ClaimCheckerConfig{}),
+	}, nil
+}
+
+// certificateIdentity returns the SPIFFE ID of the certificate, or its
+// subject common name when it has none.
+func certificateIdentity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+
+	return cert.Subject.CommonName
+}
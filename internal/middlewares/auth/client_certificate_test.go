@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateAllowListAllows(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "orders"},
+		DNSNames: []string{"orders.internal"},
+		URIs:     []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/orders"}},
+	}
+
+	type testData struct {
+		name            string
+		allowList       CertificateAllowList
+		expectedAllowed bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "Empty allow list",
+			allowList:       CertificateAllowList{},
+			expectedAllowed: true,
+		},
+		{
+			name:            "Common name",
+			allowList:       CertificateAllowList{CommonNames: []string{"billing", "orders"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "DNS name",
+			allowList:       CertificateAllowList{DNSNames: []string{"orders.internal"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "SPIFFE ID prefix",
+			allowList:       CertificateAllowList{URIs: []string{"spiffe://example.org/ns/prod/*"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "SPIFFE ID of another trust domain",
+			allowList:       CertificateAllowList{URIs: []string{"spiffe://other.org/*"}},
+			expectedAllowed: false,
+		},
+		{
+			name:            "Unknown common name",
+			allowList:       CertificateAllowList{CommonNames: []string{"billing"}},
+			expectedAllowed: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedAllowed, testCase.allowList.allows(cert))
+		})
+	}
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}}
+	assert.Equal(t, "orders", certificateIdentity(cert))
+
+	cert.URIs = []*url.URL{
+		{Scheme: "https", Host: "orders.internal"},
+		{Scheme: "spiffe", Host: "example.org", Path: "/orders"},
+	}
+	assert.Equal(t, "spiffe://example.org/orders", certificateIdentity(cert))
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDiscoveryTimeout    = 10 * time.Second
+	defaultDiscoveryMinBackoff = time.Second
+	defaultDiscoveryMaxBackoff = time.Minute
+	defaultJWKSRefreshInterval = 10 * time.Second
+)
+
+var ErrProviderNotReady = errors.New("provider discovery not completed")
+
+// DiscoveryConfig tunes the discovery of OIDC providers. Providers are
+// discovered in background without delaying the gateway start, a failed
+// discovery is retried and tokens of the provider are rejected with 503
+// until it succeeds.
+type DiscoveryConfig struct {
+	// Timeout of a discovery attempt, 10s by default.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Delay before the first retry, doubled after each failure up to
+	// MaxBackoff. 1s and 1m by default.
+	MinBackoff time.Duration `mapstructure:"min_backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// Minimum delay between two JWKS refreshes triggered by an unknown key,
+	// 10s by default.
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks_refresh_interval"`
+}
+
+func (c DiscoveryConfig) withDefaults() DiscoveryConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultDiscoveryTimeout
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = defaultDiscoveryMinBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = max(defaultDiscoveryMaxBackoff, c.MinBackoff)
+	}
+	if c.JWKSRefreshInterval <= 0 {
+		c.JWKSRefreshInterval = defaultJWKSRefreshInterval
+	}
+
+	return c
+}
+
+// discoveredVerifier verifies tokens with the verifier built from the
+// provider discovery document, once it has been fetched.
+type discoveredVerifier struct {
+	name     string
+	conf     DiscoveryConfig
+	discover func(ctx context.Context) (tokenVerifier, error)
+
+	// Canceled to stop the background discovery.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Closed once the first discovery attempt is done.
+	attempted chan struct{}
+
+	mu       sync.RWMutex
+	verifier tokenVerifier
+}
+
+// newDiscoveredVerifier starts the discovery in background, retrying it
+// until it succeeds or the verifier is stopped.
+func newDiscoveredVerifier(name string, conf DiscoveryConfig, discover func(ctx context.Context) (tokenVerifier, error)) *discoveredVerifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := &discoveredVerifier{
+		name:      name,
+		conf:      conf,
+		discover:  discover,
+		ctx:       ctx,
+		cancel:    cancel,
+		attempted: make(chan struct{}),
+	}
+
+	go v.run()
+
+	return v
+}
+
+func (v *discoveredVerifier) run() {
+	err := v.attempt()
+	close(v.attempted)
+	if err == nil {
+		log.Info("provider discovered", zap.String("provider", v.name))
+		return
+	}
+
+	log.Warn("provider discovery failed, retrying in background",
+		zap.String("provider", v.name),
+		zap.Error(err))
+	v.retry()
+}
+
+func (v *discoveredVerifier) attempt() error {
+	ctx, cancel := context.WithTimeout(v.ctx, v.conf.Timeout)
+	defer cancel()
+
+	verifier, err := v.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.verifier = verifier
+	v.mu.Unlock()
+
+	return nil
+}
+
+func (v *discoveredVerifier) retry() {
+	backoff := v.conf.MinBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-v.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		err := v.attempt()
+		if err == nil {
+			log.Info("provider discovered", zap.String("provider", v.name))
+			return
+		}
+
+		if v.ctx.Err() != nil {
+			return
+		}
+
+		backoff = min(2*backoff, v.conf.MaxBackoff)
+		log.Warn("provider discovery failed",
+			zap.String("provider", v.name),
+			zap.Duration("retry_in", backoff),
+			zap.Error(err))
+	}
+}
+
+// stop stops the background discovery.
+func (v *discoveredVerifier) stop() {
+	v.cancel()
+}
+
+func (v *discoveredVerifier) current() tokenVerifier {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.verifier
+}
+
+func (v *discoveredVerifier) ready() bool {
+	return v.current() != nil
+}
+
+func (v *discoveredVerifier) verify(ctx context.Context, rawToken string) (*jwt.Token, error) {
+	verifier := v.current()
+	if verifier == nil {
+		// Requests received during the first discovery attempt wait for it,
+		// later ones are rejected until a retry succeeds.
+		select {
+		case <-v.attempted:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s", ErrProviderNotReady, v.name)
+		}
+		verifier = v.current()
+	}
+
+	if verifier == nil {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotReady, v.name)
+	}
+
+	return verifier.verify(ctx, rawToken)
+}
+
+// providerMetadata is the part of the discovery document used by the
+// gateway.
+type providerMetadata struct {
+	Issuer           string   `json:"issuer"`
+	AuthURL          string   `json:"authorization_endpoint"`
+	TokenURL         string   `json:"token_endpoint"`
+	EndSessionURL    string   `json:"end_session_endpoint"`
+	JWKSURL          string   `json:"jwks_uri"`
+	IntrospectionURL string   `json:"introspection_endpoint"`
+	Algorithms       []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func discoverProvider(ctx context.Context, providerURL string) (providerMetadata, error) {
+	metadata := providerMetadata{}
+
+	oidcProvider, err := oidc.NewProvider(ctx, providerURL)
+	if err != nil {
+		return metadata, fmt.Errorf("can't create new provider: %w", err)
+	}
+
+	if err := oidcProvider.Claims(&metadata); err != nil {
+		return metadata, fmt.Errorf("can't read provider metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// discoverOIDCVerifier fetches the discovery document and the JWKS of the
+// provider.
+func discoverOIDCVerifier(ctx context.Context, conf ProviderConfig, refreshInterval time.Duration) (tokenVerifier, error) {
+	metadata, err := discoverProvider(ctx, conf.ProviderURL)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithms := []jose.SignatureAlgorithm{}
+	for _, algorithm := range metadata.Algorithms {
+		if _, ok := supportedSignatureAlgorithms[algorithm]; ok {
+			algorithms = append(algorithms, jose.SignatureAlgorithm(algorithm))
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = []jose.SignatureAlgorithm{jose.RS256}
+	}
+
+	keySet := newRemoteKeySet(metadata.JWKSURL, algorithms, refreshInterval, &http.Client{Timeout: defaultDiscoveryTimeout})
+	if _, err := keySet.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	supportedAlgorithms := make([]string, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		supportedAlgorithms = append(supportedAlgorithms, string(algorithm))
+	}
+
+	// Audiences are checked with the provider requirements, they can be
+	// overridden by services and endpoints.
+	oidcConfig := oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: supportedAlgorithms,
+	}
+
+	return &oidcVerifier{verifier: oidc.NewVerifier(metadata.Issuer, keySet, &oidcConfig)}, nil
+}
+
+// discoverIntrospectionVerifier reads the introspection endpoint from the
+// discovery document.
+func discoverIntrospectionVerifier(ctx context.Context, conf ProviderConfig) (tokenVerifier, error) {
+	metadata, err := discoverProvider(ctx, conf.ProviderURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.IntrospectionURL == "" {
+		return nil, ErrNoIntrospectionEndpoint
+	}
+
+	return newIntrospectionVerifier(conf.Introspection.withDefaults(conf), metadata.IntrospectionURL), nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoveryConfigWithDefaults(t *testing.T) {
+	type testData struct {
+		name     string
+		conf     DiscoveryConfig
+		expected DiscoveryConfig
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Defaults",
+			expected: DiscoveryConfig{
+				Timeout:             defaultDiscoveryTimeout,
+				MinBackoff:          defaultDiscoveryMinBackoff,
+				MaxBackoff:          defaultDiscoveryMaxBackoff,
+				JWKSRefreshInterval: defaultJWKSRefreshInterval,
+			},
+		},
+		{
+			name: "Max backoff lower than min backoff",
+			conf: DiscoveryConfig{
+				MinBackoff: 2 * time.Minute,
+				MaxBackoff: time.Second,
+			},
+			expected: DiscoveryConfig{
+				Timeout:             defaultDiscoveryTimeout,
+				MinBackoff:          2 * time.Minute,
+				MaxBackoff:          2 * time.Minute,
+				JWKSRefreshInterval: defaultJWKSRefreshInterval,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.conf.withDefaults())
+		})
+	}
+}
+
+func TestAuthMiddlewareDiscoveryRetry(t *testing.T) {
+	var available atomic.Bool
+	provider := test.LaunchTestProvider(func(c *gin.Context) {
+		if !available.Load() {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+		}
+	})
+	defer provider.Close()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+		Discovery: DiscoveryConfig{
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 20 * time.Millisecond,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultProvider}, middleware.NotReadyProviders())
+
+	guard, err := middleware.Guard(Rules{})
+	assert.NoError(t, err)
+
+	token := test.NewToken(jwt.MapClaims{
+		"iss": provider.URL,
+		"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+		"aud": jwt.ClaimStrings{"123456"},
+	})
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		guard(c)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve())
+
+	available.Store(true)
+	assert.Eventually(t, func() bool {
+		return len(middleware.NotReadyProviders()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, serve())
+}
+
+func TestAuthMiddlewareDiscoveryInBackground(t *testing.T) {
+	provider := test.LaunchTestProvider(func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer provider.Close()
+
+	start := time.Now()
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+	})
+	assert.NoError(t, err)
+	defer middleware.Stop()
+
+	// The discovery doesn't delay the middleware creation.
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, []string{DefaultProvider}, middleware.NotReadyProviders())
+
+	guard, err := middleware.Guard(Rules{})
+	assert.NoError(t, err)
+
+	// The first request waits for the first discovery attempt.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+test.NewToken(jwt.MapClaims{
+		"iss": provider.URL,
+		"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+		"aud": jwt.ClaimStrings{"123456"},
+	}))
+	guard(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, middleware.NotReadyProviders())
+}
+
+func TestAuthMiddlewareDiscoveryStop(t *testing.T) {
+	var attempts atomic.Int32
+	provider := test.LaunchTestProvider(func(c *gin.Context) {
+		attempts.Add(1)
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+	})
+	defer provider.Close()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: provider.URL,
+		ClientID:    "123456",
+		Discovery: DiscoveryConfig{
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return attempts.Load() >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	middleware.Stop()
+	time.Sleep(50 * time.Millisecond)
+	stopped := attempts.Load()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stopped, attempts.Load())
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ForwardedClaimConfig struct {
+	// Dotted path of the claim, e.g. `org.id`.
+	Claim string `mapstructure:"claim"`
+	// Upstream request header receiving the claim value.
+	Header string `mapstructure:"header"`
+}
+
+// IdentityHeaders returns the request headers set from the verified
+// identity: the forwarded claim headers and the client certificate identity
+// header.
+func IdentityHeaders(conf AuthMiddlewareConfig) []string {
+	headers := make([]string, 0, len(conf.ForwardedClaims)+1)
+	for _, forwarded := range conf.ForwardedClaims {
+		headers = append(headers, forwarded.Header)
+	}
+
+	if conf.ClientCertificates != nil && conf.ClientCertificates.IdentityHeader != "" {
+		headers = append(headers, conf.ClientCertificates.IdentityHeader)
+	}
+
+	return headers
+}
+
+// StripIdentityHeaders removes the identity headers from requests of
+// endpoints that are not guarded, so they can't be spoofed.
+func StripIdentityHeaders(headers []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, header := range headers {
+			c.Request.Header.Del(header)
+		}
+
+		c.Next()
+	}
+}
+
+// forwardClaims replaces the forwarded claim headers of the request with the
+// verified token claims. Missing claims leave the header unset.
+func forwardClaims(header http.Header, token *jwt.Token, forwardedClaims []ForwardedClaimConfig) {
+	for _, forwarded := range forwardedClaims {
+		header.Del(forwarded.Header)
+	}
+
+	for _, forwarded := range forwardedClaims {
+		claim, err := findClaim(forwarded.Claim, token)
+		if err != nil {
+			continue
+		}
+
+		value, err := formatClaim(claim)
+		if err != nil {
+			log.Warn("can't forward claim: " + err.Error())
+			continue
+		}
+
+		header.Set(forwarded.Header, value)
+	}
+}
+
+// formatClaim formats a claim as a header value. Arrays of strings are
+// joined by commas, objects are JSON encoded.
+func formatClaim(claim any) (string, error) {
+	switch value := claim.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			strElement, ok := element.(string)
+			if !ok {
+				return formatJSONClaim(claim)
+			}
+			values = append(values, strElement)
+		}
+		return strings.Join(values, ","), nil
+	default:
+		return formatJSONClaim(claim)
+	}
+}
+
+func formatJSONClaim(claim any) (string, error) {
+	value, err := json.Marshal(claim)
+	if err != nil {
+		return "", fmt.Errorf("can't encode claim: %w", err)
+	}
+
+	return string(value), nil
+}
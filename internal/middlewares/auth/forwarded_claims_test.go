@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardClaims(t *testing.T) {
+	token := &jwt.Token{
+		Claims: jwt.MapClaims{
+			"sub":    "user-1",
+			"org":    map[string]any{"id": "acme"},
+			"groups": []any{"a", "b"},
+			"level":  float64(3),
+		},
+	}
+
+	header := http.Header{
+		"X-User-Id": []string{"spoofed"},
+		"X-Email":   []string{"spoofed"},
+		"X-Other":   []string{"kept"},
+	}
+
+	forwardClaims(header, token, []ForwardedClaimConfig{
+		{Claim: "sub", Header: "X-User-Id"},
+		{Claim: "org.id", Header: "X-Tenant"},
+		{Claim: "groups", Header: "X-Groups"},
+		{Claim: "level", Header: "X-Level"},
+		{Claim: "email", Header: "X-Email"},
+	})
+
+	assert.Equal(t, http.Header{
+		"X-User-Id": []string{"user-1"},
+		"X-Tenant":  []string{"acme"},
+		"X-Groups":  []string{"a,b"},
+		"X-Level":   []string{"3"},
+		"X-Other":   []string{"kept"},
+	}, header)
+}
+
+func TestFormatClaim(t *testing.T) {
+	type testData struct {
+		name          string
+		claim         any
+		expectedValue string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:          "String",
+			claim:         "user",
+			expectedValue: "user",
+		},
+		{
+			name:          "Number",
+			claim:         float64(1.5),
+			expectedValue: "1.5",
+		},
+		{
+			name:          "Boolean",
+			claim:         true,
+			expectedValue: "true",
+		},
+		{
+			name:          "Array of strings",
+			claim:         []any{"a", "b"},
+			expectedValue: "a,b",
+		},
+		{
+			name:          "Mixed array",
+			claim:         []any{"a", float64(1)},
+			expectedValue: `["a",1]`,
+		},
+		{
+			name:          "Object",
+			claim:         map[string]any{"id": "acme"},
+			expectedValue: `{"id":"acme"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			value, err := formatClaim(testCase.claim)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedValue, value)
+		})
+	}
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	headers := IdentityHeaders(AuthMiddlewareConfig{
+		ForwardedClaims: []ForwardedClaimConfig{
+			{Claim: "sub", Header: "X-User-Id"},
+			{Claim: "org.id", Header: "X-Org-Id"},
+		},
+		ClientCertificates: &ClientCertificateConfig{IdentityHeader: "X-Client-Identity"},
+	})
+	assert.Equal(t, []string{"X-User-Id", "X-Org-Id", "X-Client-Identity"}, headers)
+
+	assert.Empty(t, IdentityHeaders(AuthMiddlewareConfig{ClientCertificates: &ClientCertificateConfig{}}))
+}
+
+func TestStripIdentityHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("X-User-Id", "spoofed")
+	c.Request.Header.Set("X-Client-Identity", "spoofed")
+	c.Request.Header.Set("X-Other", "kept")
+
+	StripIdentityHeaders([]string{"X-User-Id", "X-Client-Identity"})(c)
+
+	assert.Empty(t, c.Request.Header.Get("X-User-Id"))
+	assert.Empty(t, c.Request.Header.Get("X-Client-Identity"))
+	assert.Equal(t, "kept", c.Request.Header.Get("X-Other"))
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/lru"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultIntrospectionCacheSize = 1000
+	defaultIntrospectionTimeout   = 10 * time.Second
+)
+
+var (
+	ErrInactiveToken           = errors.New("inactive token")
+	ErrNoIntrospectionEndpoint = errors.New("no introspection endpoint")
+)
+
+// IntrospectionConfig enables RFC 7662 token introspection, needed to
+// validate opaque tokens.
+type IntrospectionConfig struct {
+	// Introspection endpoint. When empty, it is read from the provider
+	// discovery document.
+	URL          string `mapstructure:"url"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// Maximum number of introspection results cached until the token
+	// expires, 1000 by default.
+	CacheSize int `mapstructure:"cache_size"`
+	// Timeout of the requests to the introspection endpoint, 10s by default.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// withDefaults authenticates with the provider client when no introspection
+// client is set.
+func (c IntrospectionConfig) withDefaults(provider ProviderConfig) IntrospectionConfig {
+	if c.ClientID == "" {
+		c.ClientID = provider.ClientID
+	}
+
+	return c
+}
+
+type introspectionVerifier struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache *lru.Cache[[sha256.Size]byte, introspectionResult]
+}
+
+type introspectionResult struct {
+	claims    jwt.MapClaims
+	expiresAt time.Time
+}
+
+func newIntrospectionVerifier(conf IntrospectionConfig, endpoint string) *introspectionVerifier {
+	cacheSize := conf.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultIntrospectionCacheSize
+	}
+
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultIntrospectionTimeout
+	}
+
+	return &introspectionVerifier{
+		url:          endpoint,
+		clientID:     conf.ClientID,
+		clientSecret: conf.ClientSecret,
+		client:       &http.Client{Timeout: timeout},
+		cache:        lru.New[[sha256.Size]byte, introspectionResult](cacheSize),
+	}
+}
+
+func (v *introspectionVerifier) verify(ctx context.Context, rawToken string) (*jwt.Token, error) {
+	key := sha256.Sum256([]byte(rawToken))
+
+	v.mu.Lock()
+	result, ok := v.cache.Get(key)
+	if ok && time.Now().After(result.expiresAt) {
+		v.cache.Remove(key)
+		ok = false
+	}
+	v.mu.Unlock()
+
+	if !ok {
+		claims, err := v.introspect(ctx, rawToken)
+		if err != nil {
+			return nil, err
+		}
+
+		result = introspectionResult{claims: claims}
+
+		// Results are only cached for tokens announcing their expiry.
+		exp, err := claims.GetExpirationTime()
+		if err == nil && exp != nil {
+			result.expiresAt = exp.Time
+			if time.Now().Before(result.expiresAt) {
+				v.mu.Lock()
+				v.cache.Add(key, result)
+				v.mu.Unlock()
+			}
+		}
+	}
+
+	if !result.expiresAt.IsZero() && time.Now().After(result.expiresAt) {
+		return nil, ErrInactiveToken
+	}
+
+	return &jwt.Token{Raw: rawToken, Claims: result.claims, Valid: true}, nil
+}
+
+// introspect returns the introspection response of an active token.
+func (v *introspectionVerifier) introspect(ctx context.Context, rawToken string) (jwt.MapClaims, error) {
+	form := url.Values{
+		"token":           []string{rawToken},
+		"token_type_hint": []string{"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't introspect token: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't introspect token: unexpected status %d", res.StatusCode)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("can't decode introspection response: %w", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrInactiveToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// launchIntrospectionServer serves an introspection endpoint authenticating
+// the client `gateway:secret` and counting its calls.
+func launchIntrospectionServer(calls *atomic.Int64) *httptest.Server {
+	tokens := map[string]gin.H{
+		"active": {
+			"active": true,
+			"sub":    "user",
+			"roles":  []string{"admin"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		},
+		"expired": {
+			"active": true,
+			"sub":    "user",
+			"exp":    time.Now().Add(-time.Minute).Unix(),
+		},
+		"no-exp": {
+			"active": true,
+			"sub":    "user",
+		},
+	}
+
+	router := gin.New()
+	router.POST("/introspect", func(c *gin.Context) {
+		calls.Add(1)
+
+		clientID, clientSecret, ok := c.Request.BasicAuth()
+		if !ok || clientID != "gateway" || clientSecret != "secret" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		claims, ok := tokens[c.PostForm("token")]
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+
+		c.JSON(http.StatusOK, claims)
+	})
+
+	return httptest.NewServer(router)
+}
+
+func TestIntrospectionVerifierVerify(t *testing.T) {
+	type testData struct {
+		name          string
+		shouldFail    bool
+		clientSecret  string
+		token         string
+		expectedCalls int64
+		expectedSub   string
+		expectedErr   error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:          "Success case: result cached until expiry",
+			clientSecret:  "secret",
+			token:         "active",
+			expectedCalls: 1,
+			expectedSub:   "user",
+		},
+		{
+			name:          "Success case: result without expiry not cached",
+			clientSecret:  "secret",
+			token:         "no-exp",
+			expectedCalls: 2,
+			expectedSub:   "user",
+		},
+		{
+			name:          "Fail case: inactive token",
+			shouldFail:    true,
+			clientSecret:  "secret",
+			token:         "unknown",
+			expectedCalls: 2,
+			expectedErr:   ErrInactiveToken,
+		},
+		{
+			name:          "Fail case: expired token",
+			shouldFail:    true,
+			clientSecret:  "secret",
+			token:         "expired",
+			expectedCalls: 2,
+			expectedErr:   ErrInactiveToken,
+		},
+		{
+			name:          "Fail case: client not authenticated",
+			shouldFail:    true,
+			clientSecret:  "wrong",
+			token:         "active",
+			expectedCalls: 2,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls atomic.Int64
+			server := launchIntrospectionServer(&calls)
+			defer server.Close()
+
+			verifier := newIntrospectionVerifier(IntrospectionConfig{
+				ClientID:     "gateway",
+				ClientSecret: testCase.clientSecret,
+			}, server.URL+"/introspect")
+
+			for i := 0; i < 2; i++ {
+				token, err := verifier.verify(context.Background(), testCase.token)
+				if testCase.shouldFail {
+					assert.Error(t, err)
+					if testCase.expectedErr != nil {
+						assert.ErrorIs(t, err, testCase.expectedErr)
+					}
+					continue
+				}
+
+				assert.NoError(t, err)
+				sub, err := token.Claims.GetSubject()
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedSub, sub)
+			}
+
+			assert.Equal(t, testCase.expectedCalls, calls.Load())
+		})
+	}
+}
+
+func TestIntrospectionVerifierCacheSize(t *testing.T) {
+	var calls atomic.Int64
+	server := launchIntrospectionServer(&calls)
+	defer server.Close()
+
+	verifier := newIntrospectionVerifier(IntrospectionConfig{
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		CacheSize:    1,
+	}, server.URL+"/introspect")
+
+	_, err := verifier.verify(context.Background(), "active")
+	assert.NoError(t, err)
+	_, err = verifier.verify(context.Background(), "expired")
+	assert.Error(t, err)
+	_, err = verifier.verify(context.Background(), "active")
+	assert.NoError(t, err)
+
+	// The expired result evicted nothing, it was never cached.
+	assert.Equal(t, int64(2), calls.Load())
+	assert.Equal(t, 1, verifier.cache.Len())
+}
+
+func TestIntrospectionVerifierTimeout(t *testing.T) {
+	type testData struct {
+		name            string
+		timeout         time.Duration
+		expectedTimeout time.Duration
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "Default timeout",
+			expectedTimeout: defaultIntrospectionTimeout,
+		},
+		{
+			name:            "Custom timeout",
+			timeout:         time.Second,
+			expectedTimeout: time.Second,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			verifier := newIntrospectionVerifier(IntrospectionConfig{Timeout: testCase.timeout}, "http://localhost/introspect")
+			assert.Equal(t, testCase.expectedTimeout, verifier.client.Timeout)
+		})
+	}
+}
+
+func TestAuthMiddlewareGuardIntrospection(t *testing.T) {
+	type testData struct {
+		name               string
+		providers          []string
+		roles              []string
+		token              string
+		expectedStatusCode int
+	}
+
+	var calls atomic.Int64
+	server := launchIntrospectionServer(&calls)
+	defer server.Close()
+
+	oidcProvider := test.LaunchTestProvider()
+	defer oidcProvider.Close()
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		Providers: map[string]ProviderConfig{
+			"opaque": {
+				ClientID: "gateway",
+				AuthorizedRoles: &ClaimCheckerConfig{
+					TokenKey:  "roles",
+					ClaimType: "[]string",
+				},
+				Introspection: &IntrospectionConfig{
+					URL:          server.URL + "/introspect",
+					ClientSecret: "secret",
+				},
+			},
+			"discovered": {
+				ProviderURL:   oidcProvider.URL,
+				ClientID:      "123456",
+				Introspection: &IntrospectionConfig{},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	jwtToken := test.NewToken(jwt.MapClaims{
+		"iss": oidcProvider.URL,
+		"sub": "user",
+		"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+		"aud": jwt.ClaimStrings{"123456"},
+	})
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: opaque token",
+			token:              "active",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: role from introspection response",
+			roles:              []string{"admin"},
+			token:              "active",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Success case: endpoint discovered",
+			providers:          []string{"discovered"},
+			token:              jwtToken,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Fail case: invalid role",
+			roles:              []string{"staff"},
+			token:              "active",
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "Fail case: inactive token",
+			token:              "unknown",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Fail case: provider not accepted",
+			providers:          []string{"discovered"},
+			token:              "active",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("Authorization", "Bearer "+testCase.token)
+
+			guard, err := middleware.Guard(Rules{
+				AcceptedRoles: testCase.roles,
+				Providers:     testCase.providers,
+			})
+			assert.NoError(t, err)
+
+			guard(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Asymmetric algorithms accepted for tokens of discovered providers.
+var supportedSignatureAlgorithms = map[string]struct{}{
+	string(jose.RS256): {}, string(jose.RS384): {}, string(jose.RS512): {},
+	string(jose.ES256): {}, string(jose.ES384): {}, string(jose.ES512): {},
+	string(jose.PS256): {}, string(jose.PS384): {}, string(jose.PS512): {},
+	string(jose.EdDSA): {},
+}
+
+// remoteKeySet caches the JWKS of a provider. It is refreshed when a token is
+// signed by an unknown key, at most once per refresh interval so that forged
+// key IDs can't flood the provider.
+type remoteKeySet struct {
+	url             string
+	algorithms      []jose.SignatureAlgorithm
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mu   sync.RWMutex
+	keys []jose.JSONWebKey
+
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+}
+
+func newRemoteKeySet(url string, algorithms []jose.SignatureAlgorithm, refreshInterval time.Duration, client *http.Client) *remoteKeySet {
+	return &remoteKeySet{
+		url:             url,
+		algorithms:      algorithms,
+		refreshInterval: refreshInterval,
+		client:          client,
+	}
+}
+
+// VerifySignature implements oidc.KeySet.
+func (s *remoteKeySet) VerifySignature(ctx context.Context, rawToken string) ([]byte, error) {
+	jws, err := jose.ParseSigned(rawToken, s.algorithms)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+
+	s.mu.RLock()
+	keys := s.keys
+	s.mu.RUnlock()
+
+	if payload, ok := verifyWithKeys(jws, keys); ok {
+		return payload, nil
+	}
+
+	// The provider may have rotated its keys.
+	keys, err = s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload, ok := verifyWithKeys(jws, keys); ok {
+		return payload, nil
+	}
+
+	return nil, ErrNoVerificationKey
+}
+
+// refresh fetches the keys, unless they were fetched less than a refresh
+// interval ago. Concurrent callers wait for a single fetch.
+func (s *remoteKeySet) refresh(ctx context.Context) ([]jose.JSONWebKey, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if !s.lastRefresh.IsZero() && time.Since(s.lastRefresh) < s.refreshInterval {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.keys, nil
+	}
+	s.lastRefresh = time.Now()
+
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return keys, nil
+}
+
+func (s *remoteKeySet) fetch(ctx context.Context) ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch jwks: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't fetch jwks: unexpected status %d", res.StatusCode)
+	}
+
+	jwks := jose.JSONWebKeySet{}
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("can't decode jwks: %w", err)
+	}
+
+	return jwks.Keys, nil
+}
+
+// verifyWithKeys verifies the signature with the key matching its kid, or
+// with every key when it has none.
+func verifyWithKeys(jws *jose.JSONWebSignature, keys []jose.JSONWebKey) ([]byte, bool) {
+	kid := jws.Signatures[0].Header.KeyID
+
+	for _, key := range keys {
+		if kid != "" && key.KeyID != kid {
+			continue
+		}
+
+		payload, err := jws.Verify(&key)
+		if err == nil {
+			return payload, true
+		}
+	}
+
+	return nil, false
+}
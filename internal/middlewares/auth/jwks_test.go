@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteKeySetVerifySignature(t *testing.T) {
+	block, _ := pem.Decode([]byte(test.RS256PrivateKey))
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.NoError(t, err)
+	privateKey := parsedKey.(*rsa.PrivateKey)
+
+	// The served key ID changes to simulate a key rotation.
+	var kid atomic.Value
+	kid.Store("old")
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(test.MustMarshall(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{
+				{Key: &privateKey.PublicKey, KeyID: kid.Load().(string), Algorithm: "RS256", Use: "sig"},
+			},
+		}))
+	}))
+	defer server.Close()
+
+	keySet := newRemoteKeySet(server.URL, []jose.SignatureAlgorithm{jose.RS256}, time.Hour, server.Client())
+	_, err = keySet.refresh(context.Background())
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{"sub": "user"}
+
+	_, err = keySet.VerifySignature(context.Background(), signStaticToken(jwt.SigningMethodRS256, privateKey, "old", claims))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fetches.Load())
+
+	// Unknown keys are not fetched again before the refresh interval.
+	kid.Store("new")
+	_, err = keySet.VerifySignature(context.Background(), signStaticToken(jwt.SigningMethodRS256, privateKey, "new", claims))
+	assert.ErrorIs(t, err, ErrNoVerificationKey)
+	assert.Equal(t, int64(1), fetches.Load())
+
+	keySet.refreshInterval = 0
+	_, err = keySet.VerifySignature(context.Background(), signStaticToken(jwt.SigningMethodRS256, privateKey, "new", claims))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), fetches.Load())
+
+	_, err = keySet.VerifySignature(context.Background(), "malformed")
+	assert.Error(t, err)
+}
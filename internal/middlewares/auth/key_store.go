@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	KeyStoreYAML  = "yaml"
+	KeyStoreBBolt = "bbolt"
+)
+
+var (
+	ErrUnknownAPIKey       = errors.New("unknown api key")
+	ErrUnknownKeyStoreType = errors.New("unknown key store type")
+)
+
+// APIKey describes a key by the SHA-256 hash of its value, the value itself
+// is never stored.
+type APIKey struct {
+	Name        string   `yaml:"name" json:"name"`
+	Hash        string   `yaml:"hash" json:"hash"`
+	Roles       []string `yaml:"roles" json:"roles"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// KeyStore looks up API keys from the hash of their value.
+type KeyStore interface {
+	// Lookup returns ErrUnknownAPIKey when no key matches the hash.
+	Lookup(hash string) (*APIKey, error)
+}
+
+type KeyStoreConfig struct {
+	// Format of the store file, one of yaml or bbolt.
+	Type string `mapstructure:"type"`
+	Path string `mapstructure:"path"`
+}
+
+func NewKeyStore(conf KeyStoreConfig) (KeyStore, error) {
+	switch conf.Type {
+	case KeyStoreYAML:
+		return newYAMLKeyStore(conf.Path)
+	case KeyStoreBBolt:
+		return newBBoltKeyStore(conf.Path)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyStoreType, conf.Type)
+	}
+}
+
+// HashAPIKey returns the hash under which a key must be stored.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// memoryKeyStore holds keys loaded at startup.
+type memoryKeyStore struct {
+	keys map[string]APIKey
+}
+
+func newMemoryKeyStore(keys []APIKey) (*memoryKeyStore, error) {
+	store := &memoryKeyStore{keys: map[string]APIKey{}}
+	for _, key := range keys {
+		if _, err := hex.DecodeString(key.Hash); err != nil || len(key.Hash) != 2*sha256.Size {
+			return nil, fmt.Errorf("invalid hash of api key %s", key.Name)
+		}
+
+		// Lookups use the lower case hashes of HashAPIKey.
+		key.Hash = strings.ToLower(key.Hash)
+
+		store.keys[key.Hash] = key
+	}
+
+	return store, nil
+}
+
+func (s *memoryKeyStore) Lookup(hash string) (*APIKey, error) {
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrUnknownAPIKey
+	}
+
+	return &key, nil
+}
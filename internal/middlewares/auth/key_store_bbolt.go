@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket of the bbolt key store, keys are JSON encoded APIKey indexed by
+// their hash.
+var BBoltKeysBucket = []byte("api_keys")
+
+// newBBoltKeyStore loads the keys of the bbolt database at path. The database
+// is opened read-only and closed once loaded.
+func newBBoltKeyStore(path string) (*memoryKeyStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("can't open key store: %w", err)
+	}
+	defer db.Close()
+
+	keys := []APIKey{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BBoltKeysBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(hash, value []byte) error {
+			key := APIKey{}
+			if err := json.Unmarshal(value, &key); err != nil {
+				return fmt.Errorf("can't decode api key %s: %w", hash, err)
+			}
+
+			key.Hash = string(hash)
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't load key store: %w", err)
+	}
+
+	return newMemoryKeyStore(keys)
+}
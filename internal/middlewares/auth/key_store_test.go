@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	assert.Equal(t, "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", HashAPIKey("secret"))
+}
+
+func TestNewKeyStore(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "keys.yaml")
+	err := os.WriteFile(yamlPath, []byte(`keys:
+  - name: partner
+    hash: `+HashAPIKey("secret")+`
+    roles: [partner]
+    permissions: [orders:read]
+`), 0600)
+	assert.NoError(t, err)
+
+	invalidYAMLPath := filepath.Join(dir, "invalid.yaml")
+	err = os.WriteFile(invalidYAMLPath, []byte(`keys:
+  - name: partner
+    hash: secret
+`), 0600)
+	assert.NoError(t, err)
+
+	upperYAMLPath := filepath.Join(dir, "upper.yaml")
+	err = os.WriteFile(upperYAMLPath, []byte(`keys:
+  - name: partner
+    hash: `+strings.ToUpper(HashAPIKey("secret"))+`
+    roles: [partner]
+    permissions: [orders:read]
+`), 0600)
+	assert.NoError(t, err)
+
+	writeBBoltStore := func(name string, hash string) string {
+		path := filepath.Join(dir, name)
+		db, err := bolt.Open(path, 0600, nil)
+		assert.NoError(t, err)
+		err = db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucket(BBoltKeysBucket)
+			if err != nil {
+				return err
+			}
+
+			value, err := json.Marshal(APIKey{
+				Name:        "partner",
+				Roles:       []string{"partner"},
+				Permissions: []string{"orders:read"},
+			})
+			if err != nil {
+				return err
+			}
+
+			return bucket.Put([]byte(hash), value)
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close())
+
+		return path
+	}
+
+	boltPath := writeBBoltStore("keys.db", HashAPIKey("secret"))
+	upperBoltPath := writeBBoltStore("upper.db", strings.ToUpper(HashAPIKey("secret")))
+
+	type testData struct {
+		name       string
+		conf       KeyStoreConfig
+		shouldFail bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Success case: yaml store",
+			conf: KeyStoreConfig{Type: KeyStoreYAML, Path: yamlPath},
+		},
+		{
+			name: "Success case: bbolt store",
+			conf: KeyStoreConfig{Type: KeyStoreBBolt, Path: boltPath},
+		},
+		{
+			name: "Success case: yaml store with upper case hash",
+			conf: KeyStoreConfig{Type: KeyStoreYAML, Path: upperYAMLPath},
+		},
+		{
+			name: "Success case: bbolt store with upper case hash",
+			conf: KeyStoreConfig{Type: KeyStoreBBolt, Path: upperBoltPath},
+		},
+		{
+			name:       "Fail case: missing file",
+			conf:       KeyStoreConfig{Type: KeyStoreYAML, Path: filepath.Join(dir, "missing.yaml")},
+			shouldFail: true,
+		},
+		{
+			name:       "Fail case: invalid hash",
+			conf:       KeyStoreConfig{Type: KeyStoreYAML, Path: invalidYAMLPath},
+			shouldFail: true,
+		},
+		{
+			name:       "Fail case: unknown type",
+			conf:       KeyStoreConfig{Type: "sql", Path: yamlPath},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			store, err := NewKeyStore(testCase.conf)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			key, err := store.Lookup(HashAPIKey("secret"))
+			assert.NoError(t, err)
+			assert.Equal(t, &APIKey{
+				Name:        "partner",
+				Hash:        HashAPIKey("secret"),
+				Roles:       []string{"partner"},
+				Permissions: []string{"orders:read"},
+			}, key)
+
+			_, err = store.Lookup(HashAPIKey("other"))
+			assert.ErrorIs(t, err, ErrUnknownAPIKey)
+		})
+	}
+}
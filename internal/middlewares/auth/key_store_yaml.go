@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// newYAMLKeyStore loads the keys listed under `keys` in the file at path.
+func newYAMLKeyStore(path string) (*memoryKeyStore, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read key store: %w", err)
+	}
+
+	file := struct {
+		Keys []APIKey `yaml:"keys"`
+	}{}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("can't parse key store: %w", err)
+	}
+
+	return newMemoryKeyStore(file.Keys)
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Name of the provider configured by `provider_url` and `client_id`.
+const DefaultProvider = "default"
+
+type ProviderConfig struct {
+	ProviderURL string `mapstructure:"provider_url"`
+	ClientID    string `mapstructure:"client_id"`
+	// Override the middleware audiences and authorized parties for tokens
+	// of this provider. Services and endpoints can override them. Endpoints
+	// accepting tokens of an OIDC provider without client id must have
+	// audiences.
+	Audiences         []string `mapstructure:"audiences"`
+	AuthorizedParties []string `mapstructure:"authorized_parties"`
+	// Override the middleware claim checkers for tokens of this provider.
+	AuthorizedRoles     *ClaimCheckerConfig `mapstructure:"authorized_roles"`
+	RequiredPermissions *ClaimCheckerConfig `mapstructure:"required_permissions"`
+	// Optional, validates tokens with the introspection endpoint instead of
+	// verifying their signature. Required to accept opaque tokens.
+	Introspection *IntrospectionConfig `mapstructure:"introspection"`
+	// Optional, verifies tokens with local keys instead of the provider
+	// JWKS. The provider URL is then only the expected issuer.
+	StaticKeys *StaticKeysConfig `mapstructure:"static_keys"`
+}
+
+// tokenVerifier validates raw tokens and returns their claims.
+type tokenVerifier interface {
+	verify(ctx context.Context, rawToken string) (*jwt.Token, error)
+}
+
+type provider struct {
+	name     string
+	issuer   string
+	verifier tokenVerifier
+	// Whether the provider can validate opaque tokens.
+	introspection bool
+	// Whether the provider tokens must have an accepted audience.
+	requireAudience bool
+
+	roleChecker       *claimChecker
+	permissionChecker *claimChecker
+	requirements      *tokenRequirements
+}
+
+func newProvider(name string, conf ProviderConfig, defaults AuthMiddlewareConfig) (*provider, error) {
+	roles := defaults.AuthorizedRoles
+	if conf.AuthorizedRoles != nil {
+		roles = *conf.AuthorizedRoles
+	}
+
+	permissions := defaults.RequiredPermissions
+	if conf.RequiredPermissions != nil {
+		permissions = *conf.RequiredPermissions
+	}
+
+	for _, match := range []string{roles.Match, permissions.Match} {
+		if !isMatchMode(match) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMatchMode, match)
+		}
+	}
+
+	if len(conf.Audiences) == 0 {
+		conf.Audiences = defaults.Audiences
+	}
+	if len(conf.AuthorizedParties) == 0 {
+		conf.AuthorizedParties = defaults.AuthorizedParties
+	}
+
+	provider := &provider{
+		name:              name,
+		issuer:            conf.ProviderURL,
+		roleChecker:       newClaimChecker(roles),
+		permissionChecker: newClaimChecker(permissions),
+		requirements: &tokenRequirements{
+			issuers:           defaults.Issuers,
+			audiences:         conf.Audiences,
+			authorizedParties: conf.AuthorizedParties,
+		},
+	}
+
+	// The discovery document is not needed when the introspection endpoint
+	// is known.
+	if conf.Introspection != nil && conf.Introspection.URL != "" {
+		provider.verifier = newIntrospectionVerifier(conf.Introspection.withDefaults(conf), conf.Introspection.URL)
+		provider.introspection = true
+		return provider, nil
+	}
+
+	if conf.StaticKeys != nil {
+		verifier, err := newStaticVerifier(*conf.StaticKeys, conf.ProviderURL)
+		if err != nil {
+			return nil, fmt.Errorf("can't load static keys: %w", err)
+		}
+
+		if len(conf.StaticKeys.Audiences) > 0 {
+			provider.requirements.audiences = conf.StaticKeys.Audiences
+		}
+		provider.requirements.audiences = withClientIDAudience(provider.requirements.audiences, conf.ClientID)
+		provider.verifier = verifier
+		return provider, nil
+	}
+
+	discovery := defaults.Discovery.withDefaults()
+	if conf.Introspection != nil {
+		provider.verifier = newDiscoveredVerifier(name, discovery, func(ctx context.Context) (tokenVerifier, error) {
+			return discoverIntrospectionVerifier(ctx, conf)
+		})
+		provider.introspection = true
+		return provider, nil
+	}
+
+	provider.requirements.audiences = withClientIDAudience(provider.requirements.audiences, conf.ClientID)
+	provider.requireAudience = true
+	provider.verifier = newDiscoveredVerifier(name, discovery, func(ctx context.Context) (tokenVerifier, error) {
+		return discoverOIDCVerifier(ctx, conf, discovery.JWKSRefreshInterval)
+	})
+
+	return provider, nil
+}
+
+// withClientIDAudience returns the audiences, the client ID when there are
+// none: JWTs are accepted when issued for the client by default.
+func withClientIDAudience(audiences []string, clientID string) []string {
+	if len(audiences) == 0 && clientID != "" {
+		return []string{clientID}
+	}
+
+	return audiences
+}
+
+// verify validates the token with the provider verifier and checks the
+// requirements on its claims, the provider ones when nil.
+func (p *provider) verify(ctx context.Context, rawToken string, requirements *tokenRequirements) (*jwt.Token, error) {
+	token, err := p.verifier.verify(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if requirements == nil {
+		requirements = p.requirements
+	}
+
+	if err := requirements.check(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ready reports whether the provider can verify tokens, false until its
+// discovery succeeded.
+func (p *provider) ready() bool {
+	if verifier, ok := p.verifier.(*discoveredVerifier); ok {
+		return verifier.ready()
+	}
+
+	return true
+}
+
+// stop stops the background discovery of the provider, if any.
+func (p *provider) stop() {
+	if verifier, ok := p.verifier.(*discoveredVerifier); ok {
+		verifier.stop()
+	}
+}
+
+type oidcVerifier struct {
+	verifier *oidc.IDTokenVerifier
+}
+
+func (v *oidcVerifier) verify(ctx context.Context, rawToken string) (*jwt.Token, error) {
+	if _, err := v.verifier.Verify(ctx, rawToken); err != nil {
+		return nil, err
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(rawToken, jwt.MapClaims{})
+	return token, err
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidAudience        = errors.New("token audience not accepted")
+	ErrIssuerNotAccepted      = errors.New("token issuer not accepted")
+	ErrInvalidAuthorizedParty = errors.New("token authorized party not accepted")
+)
+
+// tokenRequirements are checked on the claims of verified tokens, whatever
+// the verifier. Empty requirements are not checked.
+type tokenRequirements struct {
+	issuers           []string
+	audiences         []string
+	authorizedParties []string
+}
+
+// override returns the requirements with the non empty overrides replacing
+// them.
+func (r *tokenRequirements) override(overrides tokenRequirements) *tokenRequirements {
+	merged := *r
+	if len(overrides.issuers) > 0 {
+		merged.issuers = overrides.issuers
+	}
+	if len(overrides.audiences) > 0 {
+		merged.audiences = overrides.audiences
+	}
+	if len(overrides.authorizedParties) > 0 {
+		merged.authorizedParties = overrides.authorizedParties
+	}
+
+	return &merged
+}
+
+func (r *tokenRequirements) check(token *jwt.Token) error {
+	if len(r.issuers) > 0 {
+		issuer, err := token.Claims.GetIssuer()
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(r.issuers, issuer) {
+			return fmt.Errorf("%w: %s", ErrIssuerNotAccepted, issuer)
+		}
+	}
+
+	if err := checkAudience(token, r.audiences); err != nil {
+		return err
+	}
+
+	if len(r.authorizedParties) > 0 {
+		if !slices.Contains(r.authorizedParties, authorizedParty(token)) {
+			return ErrInvalidAuthorizedParty
+		}
+	}
+
+	return nil
+}
+
+// checkAudience checks that the token audience contains one of the accepted
+// audiences, when there are some.
+func checkAudience(token *jwt.Token, accepted []string) error {
+	if len(accepted) == 0 {
+		return nil
+	}
+
+	audiences, err := token.Claims.GetAudience()
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(audiences, func(audience string) bool {
+		return slices.Contains(accepted, audience)
+	}) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// authorizedParty returns the client the token was issued to, read from the
+// OIDC `azp` claim or the RFC 9068 `client_id` claim.
+func authorizedParty(token *jwt.Token) string {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+
+	if azp, ok := claims["azp"].(string); ok {
+		return azp
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	return clientID
+}
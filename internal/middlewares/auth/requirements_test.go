@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRequirementsCheck(t *testing.T) {
+	type testData struct {
+		name         string
+		requirements tokenRequirements
+		claims       jwt.MapClaims
+		expectedErr  error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:         "Success case: no requirements",
+			requirements: tokenRequirements{},
+			claims:       jwt.MapClaims{},
+		},
+		{
+			name: "Success case: all requirements",
+			requirements: tokenRequirements{
+				issuers:           []string{"https://idp.example.com"},
+				audiences:         []string{"orders", "billing"},
+				authorizedParties: []string{"web"},
+			},
+			claims: jwt.MapClaims{
+				"iss": "https://idp.example.com",
+				"aud": []any{"account", "orders"},
+				"azp": "web",
+			},
+		},
+		{
+			name:         "Success case: client_id claim",
+			requirements: tokenRequirements{authorizedParties: []string{"web"}},
+			claims:       jwt.MapClaims{"client_id": "web"},
+		},
+		{
+			name:         "Success case: string audience",
+			requirements: tokenRequirements{audiences: []string{"orders"}},
+			claims:       jwt.MapClaims{"aud": "orders"},
+		},
+		{
+			name:         "Fail case: other issuer",
+			requirements: tokenRequirements{issuers: []string{"https://idp.example.com"}},
+			claims:       jwt.MapClaims{"iss": "https://other.example.com"},
+			expectedErr:  ErrIssuerNotAccepted,
+		},
+		{
+			name:         "Fail case: token minted for another service",
+			requirements: tokenRequirements{audiences: []string{"orders"}},
+			claims:       jwt.MapClaims{"aud": []any{"billing"}},
+			expectedErr:  ErrInvalidAudience,
+		},
+		{
+			name:         "Fail case: no audience",
+			requirements: tokenRequirements{audiences: []string{"orders"}},
+			claims:       jwt.MapClaims{},
+			expectedErr:  ErrInvalidAudience,
+		},
+		{
+			name:         "Fail case: other authorized party",
+			requirements: tokenRequirements{authorizedParties: []string{"web"}},
+			claims:       jwt.MapClaims{"azp": "mobile", "client_id": "web"},
+			expectedErr:  ErrInvalidAuthorizedParty,
+		},
+		{
+			name:         "Fail case: no authorized party",
+			requirements: tokenRequirements{authorizedParties: []string{"web"}},
+			claims:       jwt.MapClaims{},
+			expectedErr:  ErrInvalidAuthorizedParty,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.requirements.check(&jwt.Token{Claims: testCase.claims})
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTokenRequirementsOverride(t *testing.T) {
+	type testData struct {
+		name         string
+		overrides    tokenRequirements
+		expectedReqs *tokenRequirements
+	}
+
+	defaults := tokenRequirements{
+		issuers:           []string{"https://idp.example.com"},
+		audiences:         []string{"gateway"},
+		authorizedParties: []string{"web"},
+	}
+
+	var testCases = [...]testData{
+		{
+			name:         "Success case: no overrides",
+			overrides:    tokenRequirements{},
+			expectedReqs: &defaults,
+		},
+		{
+			name:      "Success case: audiences overridden",
+			overrides: tokenRequirements{audiences: []string{"orders"}},
+			expectedReqs: &tokenRequirements{
+				issuers:           []string{"https://idp.example.com"},
+				audiences:         []string{"orders"},
+				authorizedParties: []string{"web"},
+			},
+		},
+		{
+			name: "Success case: all overridden",
+			overrides: tokenRequirements{
+				issuers:           []string{"https://other.example.com"},
+				audiences:         []string{"orders"},
+				authorizedParties: []string{"mobile"},
+			},
+			expectedReqs: &tokenRequirements{
+				issuers:           []string{"https://other.example.com"},
+				audiences:         []string{"orders"},
+				authorizedParties: []string{"mobile"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedReqs, defaults.override(testCase.overrides))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Error codes of rejected requests. The RFC 6750 ones are also sent in the
+// WWW-Authenticate challenge.
+const (
+	ErrorCodeMissingCredentials = "missing_credentials"
+	ErrorCodeInvalidRequest     = "invalid_request"
+	ErrorCodeInvalidToken       = "invalid_token"
+	ErrorCodeInsufficientScope  = "insufficient_scope"
+	ErrorCodeInvalidGrant       = "invalid_grant"
+	ErrorCodeUnavailable        = "temporarily_unavailable"
+)
+
+// ErrorResponse is the body of requests rejected by the guard. 401 responses
+// ask the client to authenticate again, 403 responses to be granted access.
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	// Roles or permissions required by the endpoint, separated by spaces.
+	Scope string `json:"scope,omitempty"`
+}
+
+// authenticationFailure returns the status and body of a request that failed
+// to authenticate.
+func authenticationFailure(err error) (int, ErrorResponse) {
+	switch {
+	case errors.Is(err, ErrProviderNotReady):
+		return http.StatusServiceUnavailable, ErrorResponse{Error: ErrorCodeUnavailable, ErrorDescription: "authentication unavailable"}
+	case errors.Is(err, ErrNoCredentials):
+		return http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeMissingCredentials, ErrorDescription: "missing credentials"}
+	case errors.Is(err, ErrMalformatedAuthHeader):
+		return http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeInvalidRequest, ErrorDescription: "malformed authorization header"}
+	case errors.Is(err, ErrSessionExpired):
+		return http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeInvalidToken, ErrorDescription: "session expired"}
+	case errors.Is(err, jwt.ErrTokenExpired), errors.As(err, new(*oidc.TokenExpiredError)):
+		return http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeInvalidToken, ErrorDescription: "token expired"}
+	default:
+		return http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeInvalidToken, ErrorDescription: "invalid credentials"}
+	}
+}
+
+// abort rejects the request. The bearer challenge is only sent when the
+// endpoint accepts bearer tokens.
+func abort(c *gin.Context, status int, body ErrorResponse, bearer bool) {
+	if bearer && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+		c.Header("WWW-Authenticate", bearerChallenge(body))
+	}
+
+	c.AbortWithStatusJSON(status, body)
+}
+
+// bearerChallenge formats a RFC 6750 challenge. The error code is omitted
+// when the request had no credentials.
+func bearerChallenge(body ErrorResponse) string {
+	if body.Error == ErrorCodeMissingCredentials {
+		return "Bearer"
+	}
+
+	params := []string{
+		`error="` + quoteChallengeValue(body.Error) + `"`,
+		`error_description="` + quoteChallengeValue(body.ErrorDescription) + `"`,
+	}
+	if body.Scope != "" {
+		params = append(params, `scope="`+quoteChallengeValue(body.Scope)+`"`)
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// quoteChallengeValue escapes the characters that can't appear in a quoted
+// string.
+func quoteChallengeValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticationFailure(t *testing.T) {
+	type testData struct {
+		name               string
+		err                error
+		expectedStatusCode int
+		expectedCode       string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:               "Provider not ready",
+			err:                fmt.Errorf("provider default: %w", ErrProviderNotReady),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedCode:       ErrorCodeUnavailable,
+		},
+		{
+			name:               "No credentials",
+			err:                ErrNoCredentials,
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedCode:       ErrorCodeMissingCredentials,
+		},
+		{
+			name:               "Malformed header",
+			err:                ErrMalformatedAuthHeader,
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedCode:       ErrorCodeInvalidRequest,
+		},
+		{
+			name:               "Expired token",
+			err:                fmt.Errorf("%w: %w", jwt.ErrTokenInvalidClaims, jwt.ErrTokenExpired),
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedCode:       ErrorCodeInvalidToken,
+		},
+		{
+			name:               "Unknown api key",
+			err:                ErrUnknownAPIKey,
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedCode:       ErrorCodeInvalidToken,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			status, body := authenticationFailure(testCase.err)
+			assert.Equal(t, testCase.expectedStatusCode, status)
+			assert.Equal(t, testCase.expectedCode, body.Error)
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	type testData struct {
+		name            string
+		status          int
+		body            ErrorResponse
+		bearer          bool
+		expectedBody    string
+		expectedWWWAuth string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "Insufficient scope",
+			status:          http.StatusForbidden,
+			body:            ErrorResponse{Error: ErrorCodeInsufficientScope, ErrorDescription: "missing required role", Scope: "admin manager"},
+			bearer:          true,
+			expectedBody:    `{"error":"insufficient_scope","error_description":"missing required role","scope":"admin manager"}`,
+			expectedWWWAuth: `Bearer error="insufficient_scope", error_description="missing required role", scope="admin manager"`,
+		},
+		{
+			name:            "Escaped challenge",
+			status:          http.StatusForbidden,
+			body:            ErrorResponse{Error: ErrorCodeInsufficientScope, ErrorDescription: "missing required role", Scope: `a"b\c`},
+			bearer:          true,
+			expectedBody:    `{"error":"insufficient_scope","error_description":"missing required role","scope":"a\"b\\c"}`,
+			expectedWWWAuth: `Bearer error="insufficient_scope", error_description="missing required role", scope="a\"b\\c"`,
+		},
+		{
+			name:            "Missing credentials",
+			status:          http.StatusUnauthorized,
+			body:            ErrorResponse{Error: ErrorCodeMissingCredentials, ErrorDescription: "missing credentials"},
+			bearer:          true,
+			expectedBody:    `{"error":"missing_credentials","error_description":"missing credentials"}`,
+			expectedWWWAuth: "Bearer",
+		},
+		{
+			name:         "No bearer challenge",
+			status:       http.StatusUnauthorized,
+			body:         ErrorResponse{Error: ErrorCodeInvalidToken, ErrorDescription: "invalid credentials"},
+			expectedBody: `{"error":"invalid_token","error_description":"invalid credentials"}`,
+		},
+		{
+			name:         "No challenge when unavailable",
+			status:       http.StatusServiceUnavailable,
+			body:         ErrorResponse{Error: ErrorCodeUnavailable, ErrorDescription: "authentication unavailable"},
+			bearer:       true,
+			expectedBody: `{"error":"temporarily_unavailable","error_description":"authentication unavailable"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			abort(c, testCase.status, testCase.body, testCase.bearer)
+
+			assert.True(t, c.IsAborted())
+			assert.Equal(t, testCase.status, w.Code)
+			assert.JSONEq(t, testCase.expectedBody, w.Body.String())
+			assert.Equal(t, testCase.expectedWWWAuth, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
@@ -0,0 +1,568 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/lru"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultSessionCookieName   = "gateway_session"
+	defaultSessionPathPrefix   = "/auth"
+	defaultSessionRefresh      = 30 * time.Second
+	defaultSessionTimeout      = 10 * time.Second
+	defaultSessionRedirect     = "/"
+	loginStateLifetime         = 10 * time.Minute
+	refreshedSessionsCacheSize = 1000
+)
+
+var (
+	ErrNoRedirectURL   = errors.New("no redirect url")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrNoSessionClient = errors.New("session provider has no client id")
+
+	sessionChunkPattern = regexp.MustCompile(`^_[0-9]+$`)
+)
+
+// SessionConfig enables the session authentication mode of a
+// backend-for-frontend. Browsers log in with the authorization code flow and
+// PKCE on the login and callback routes, the tokens are kept in an encrypted
+// cookie and the access token is sent to the upstream as a bearer token.
+type SessionConfig struct {
+	// Provider users log in with, `default` by default. Its client id is
+	// used for the authorization code flow.
+	Provider string `mapstructure:"provider"`
+	// Optional, public clients only rely on PKCE.
+	ClientSecret string `mapstructure:"client_secret"`
+	// Absolute URL of the callback route, as registered at the provider.
+	RedirectURL string `mapstructure:"redirect_url"`
+	// `openid` by default. Some providers only issue refresh tokens with the
+	// `offline_access` scope.
+	Scopes []string `mapstructure:"scopes"`
+	// Prefix of the login, callback and logout routes, added to the service
+	// path prefix. `/auth` by default.
+	PathPrefix string `mapstructure:"path_prefix"`
+	// Base64 encoded 32 bytes key encrypting the cookies.
+	CookieSecret string `mapstructure:"cookie_secret"`
+	// `gateway_session` by default. Large sessions are split across cookies
+	// suffixed with `_1`, `_2`...
+	CookieName   string `mapstructure:"cookie_name"`
+	CookieDomain string `mapstructure:"cookie_domain"`
+	// `/` by default.
+	CookiePath string `mapstructure:"cookie_path"`
+	// Sends cookies over plain HTTP, for local development only.
+	InsecureCookie bool `mapstructure:"insecure_cookie"`
+	// Where users land after login when the login route has no local
+	// `redirect` parameter, `/` by default.
+	PostLoginRedirect string `mapstructure:"post_login_redirect"`
+	// Where users land after logout, `/` by default. It is sent to the
+	// provider end session endpoint when absolute.
+	PostLogoutRedirect string `mapstructure:"post_logout_redirect"`
+	// Access tokens expiring within this delay are refreshed, 30s by
+	// default.
+	RefreshBefore time.Duration `mapstructure:"refresh_before"`
+	// Timeout of the requests to the provider, 10s by default.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func (c SessionConfig) withDefaults() SessionConfig {
+	if c.Provider == "" {
+		c.Provider = DefaultProvider
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid"}
+	}
+	if c.PathPrefix == "" {
+		c.PathPrefix = defaultSessionPathPrefix
+	}
+	if c.CookieName == "" {
+		c.CookieName = defaultSessionCookieName
+	}
+	if c.CookiePath == "" {
+		c.CookiePath = "/"
+	}
+	if c.PostLoginRedirect == "" {
+		c.PostLoginRedirect = defaultSessionRedirect
+	}
+	if c.PostLogoutRedirect == "" {
+		c.PostLogoutRedirect = defaultSessionRedirect
+	}
+	if c.RefreshBefore <= 0 {
+		c.RefreshBefore = defaultSessionRefresh
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultSessionTimeout
+	}
+
+	return c
+}
+
+// session holds the tokens of a logged in user.
+type session struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// newSession returns the session holding token. Tokens missing from a
+// refresh response are kept from the previous session.
+func newSession(token *oauth2.Token, previous *session) *session {
+	s := &session{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	if idToken, ok := token.Extra("id_token").(string); ok {
+		s.IDToken = idToken
+	}
+
+	if previous != nil {
+		if s.RefreshToken == "" {
+			s.RefreshToken = previous.RefreshToken
+		}
+		if s.IDToken == "" {
+			s.IDToken = previous.IDToken
+		}
+	}
+
+	return s
+}
+
+// loginState is kept in a cookie between the login and callback routes.
+type loginState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+}
+
+// refreshCall is a refresh in progress, concurrent requests of a session
+// wait for its result instead of spending the refresh token again.
+type refreshCall struct {
+	done    chan struct{}
+	session *session
+	err     error
+}
+
+type sessionManager struct {
+	conf        SessionConfig
+	providerURL string
+	clientID    string
+	provider    *provider
+	codec       *cookieCodec
+	client      *http.Client
+
+	// Filled by the first successful discovery.
+	discoveryMu   sync.Mutex
+	oauthConfig   *oauth2.Config
+	endSessionURL string
+
+	refreshMu  sync.Mutex
+	refreshing map[string]*refreshCall
+	// Sessions refreshed recently by their previous refresh token, for the
+	// requests sent with the previous cookie.
+	refreshed *lru.Cache[string, *session]
+}
+
+func newSessionManager(conf SessionConfig, providerConf ProviderConfig, provider *provider) (*sessionManager, error) {
+	conf = conf.withDefaults()
+	if conf.RedirectURL == "" {
+		return nil, ErrNoRedirectURL
+	}
+
+	if _, err := url.ParseRequestURI(conf.RedirectURL); err != nil {
+		return nil, fmt.Errorf("invalid redirect url: %w", err)
+	}
+
+	if providerConf.ClientID == "" {
+		return nil, ErrNoSessionClient
+	}
+
+	codec, err := newCookieCodec(conf.CookieSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionManager{
+		conf:        conf,
+		providerURL: providerConf.ProviderURL,
+		clientID:    providerConf.ClientID,
+		provider:    provider,
+		codec:       codec,
+		client:      &http.Client{Timeout: conf.Timeout},
+		refreshing:  map[string]*refreshCall{},
+		refreshed:   lru.New[string, *session](refreshedSessionsCacheSize),
+	}, nil
+}
+
+// attachRoutes registers the login, callback and logout routes.
+func (m *sessionManager) attachRoutes(routes gin.IRoutes) {
+	routes.GET(m.conf.PathPrefix+"/login", m.login)
+	routes.GET(m.conf.PathPrefix+"/callback", m.callback)
+	routes.GET(m.conf.PathPrefix+"/logout", m.logout)
+}
+
+// discover returns the OAuth2 configuration of the provider, fetched from its
+// discovery document on first use.
+func (m *sessionManager) discover(ctx context.Context) (*oauth2.Config, string, error) {
+	m.discoveryMu.Lock()
+	defer m.discoveryMu.Unlock()
+
+	if m.oauthConfig != nil {
+		return m.oauthConfig, m.endSessionURL, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.conf.Timeout)
+	defer cancel()
+
+	metadata, err := discoverProvider(ctx, m.providerURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrProviderNotReady, err)
+	}
+
+	m.oauthConfig = &oauth2.Config{
+		ClientID:     m.clientID,
+		ClientSecret: m.conf.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthURL,
+			TokenURL: metadata.TokenURL,
+		},
+		RedirectURL: m.conf.RedirectURL,
+		Scopes:      m.conf.Scopes,
+	}
+	m.endSessionURL = metadata.EndSessionURL
+
+	return m.oauthConfig, m.endSessionURL, nil
+}
+
+// tokenContext returns the context of token requests. They are not canceled
+// with the client request, other requests may wait for a refresh.
+func (m *sessionManager) tokenContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.conf.Timeout)
+	return context.WithValue(ctx, oauth2.HTTPClient, m.client), cancel
+}
+
+func (m *sessionManager) login(c *gin.Context) {
+	oauthConfig, _, err := m.discover(c.Request.Context())
+	if err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		status, body := authenticationFailure(err)
+		abort(c, status, body, false)
+		return
+	}
+
+	redirect := c.Query("redirect")
+	if !isLocalRedirect(redirect) {
+		redirect = m.conf.PostLoginRedirect
+	}
+
+	state := loginState{
+		State:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+	}
+
+	value, err := m.codec.encode(m.loginCookieName(), state)
+	if err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	m.setCookie(c, m.loginCookieName(), value, int(loginStateLifetime.Seconds()))
+	c.Redirect(http.StatusFound, oauthConfig.AuthCodeURL(state.State, oauth2.S256ChallengeOption(state.Verifier)))
+}
+
+func (m *sessionManager) callback(c *gin.Context) {
+	state := loginState{}
+	value, err := c.Cookie(m.loginCookieName())
+	if err == nil {
+		err = m.codec.decode(m.loginCookieName(), value, &state)
+	}
+	m.setCookie(c, m.loginCookieName(), "", -1)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(state.State)) != 1 {
+		log.Error("Auth middleware failure", zap.Error(fmt.Errorf("invalid login state: %w", err)))
+		abort(c, http.StatusBadRequest, ErrorResponse{Error: ErrorCodeInvalidRequest, ErrorDescription: "invalid login state"}, false)
+		return
+	}
+
+	if code := c.Query("error"); code != "" {
+		abort(c, http.StatusUnauthorized, ErrorResponse{Error: code, ErrorDescription: c.Query("error_description")}, false)
+		return
+	}
+
+	oauthConfig, _, err := m.discover(c.Request.Context())
+	if err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		status, body := authenticationFailure(err)
+		abort(c, status, body, false)
+		return
+	}
+
+	ctx, cancel := m.tokenContext(c.Request.Context())
+	defer cancel()
+
+	token, err := oauthConfig.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		abort(c, http.StatusUnauthorized, ErrorResponse{Error: ErrorCodeInvalidGrant, ErrorDescription: "authorization code exchange failed"}, false)
+		return
+	}
+
+	s := newSession(token, nil)
+	if _, err := m.provider.verify(ctx, s.AccessToken, nil); err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		status, body := authenticationFailure(err)
+		abort(c, status, body, false)
+		return
+	}
+
+	if err := m.writeSession(c, s); err != nil {
+		log.Error("Auth middleware failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(http.StatusFound, state.Redirect)
+}
+
+// logout clears the session and ends the provider session when it supports
+// RP-initiated logout.
+func (m *sessionManager) logout(c *gin.Context) {
+	s, _ := m.readSession(c.Request)
+	m.clearSession(c)
+
+	redirect := m.conf.PostLogoutRedirect
+	if _, endSessionURL, err := m.discover(c.Request.Context()); err == nil && endSessionURL != "" {
+		if target, err := url.Parse(endSessionURL); err == nil {
+			query := target.Query()
+			query.Set("client_id", m.clientID)
+			if s != nil && s.IDToken != "" {
+				query.Set("id_token_hint", s.IDToken)
+			}
+			if postLogout, err := url.Parse(redirect); err == nil && postLogout.IsAbs() {
+				query.Set("post_logout_redirect_uri", redirect)
+			}
+			target.RawQuery = query.Encode()
+			redirect = target.String()
+		}
+	}
+
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// authenticate returns the principal of the session, refreshing its tokens
+// when they are about to expire. The access token replaces the credentials
+// sent to the upstream.
+func (m *sessionManager) authenticate(c *gin.Context, acceptedProviders map[string]*tokenRequirements) (*principal, error) {
+	requirements, ok := acceptedProviders[m.provider.name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotAccepted, m.provider.name)
+	}
+
+	s, err := m.readSession(c.Request)
+	if err != nil {
+		m.clearSession(c)
+		return nil, err
+	}
+
+	if !s.Expiry.IsZero() && time.Until(s.Expiry) < m.conf.RefreshBefore {
+		refreshed, err := m.refresh(c.Request.Context(), s)
+		switch {
+		case err == nil:
+			if err := m.writeSession(c, refreshed); err != nil {
+				log.Error("Auth middleware failure", zap.Error(err))
+			}
+			s = refreshed
+		case errors.Is(err, ErrSessionExpired):
+			m.clearSession(c)
+			return nil, err
+		default:
+			// The current access token is used until it expires when the
+			// provider can't be reached.
+			log.Warn("session refresh failed", zap.Error(err))
+		}
+	}
+
+	token, err := m.provider.verify(c.Request.Context(), s.AccessToken, requirements)
+	if err != nil {
+		return nil, err
+	}
+
+	stripCookies(c.Request, m.isSessionCookie)
+	c.Request.Header.Set("Authorization", "Bearer "+s.AccessToken)
+
+	return &principal{
+		token:             token,
+		roleChecker:       m.provider.roleChecker,
+		permissionChecker: m.provider.permissionChecker,
+	}, nil
+}
+
+// refresh renews the tokens of s. Concurrent refreshes of a session share a
+// single token request.
+func (m *sessionManager) refresh(ctx context.Context, s *session) (*session, error) {
+	if s.RefreshToken == "" {
+		return nil, ErrSessionExpired
+	}
+
+	m.refreshMu.Lock()
+	if refreshed, ok := m.refreshed.Get(s.RefreshToken); ok {
+		m.refreshMu.Unlock()
+		return refreshed, nil
+	}
+
+	call, ok := m.refreshing[s.RefreshToken]
+	if ok {
+		m.refreshMu.Unlock()
+		select {
+		case <-call.done:
+			return call.session, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call = &refreshCall{done: make(chan struct{})}
+	m.refreshing[s.RefreshToken] = call
+	m.refreshMu.Unlock()
+
+	call.session, call.err = m.refreshToken(ctx, s)
+
+	m.refreshMu.Lock()
+	delete(m.refreshing, s.RefreshToken)
+	if call.err == nil {
+		m.refreshed.Add(s.RefreshToken, call.session)
+	}
+	m.refreshMu.Unlock()
+	close(call.done)
+
+	return call.session, call.err
+}
+
+func (m *sessionManager) refreshToken(ctx context.Context, s *session) (*session, error) {
+	oauthConfig, _, err := m.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := m.tokenContext(ctx)
+	defer cancel()
+
+	token, err := oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: s.RefreshToken}).Token()
+	if retrieveErr := (*oauth2.RetrieveError)(nil); errors.As(err, &retrieveErr) {
+		return nil, fmt.Errorf("%w: %w", ErrSessionExpired, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newSession(token, s), nil
+}
+
+func (m *sessionManager) readSession(r *http.Request) (*session, error) {
+	value, ok := readChunks(r, m.conf.CookieName)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	s := &session{}
+	if err := m.codec.decode(m.conf.CookieName, value, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// writeSession sets the session cookies and clears the chunks left by a
+// larger previous session.
+func (m *sessionManager) writeSession(c *gin.Context, s *session) error {
+	value, err := m.codec.encode(m.conf.CookieName, s)
+	if err != nil {
+		return err
+	}
+
+	chunks := splitChunks(value, maxCookieChunkSize)
+	if len(chunks) > maxCookieChunks {
+		return fmt.Errorf("%w: %d bytes", ErrSessionTooLarge, len(value))
+	}
+
+	for i, chunk := range chunks {
+		m.setCookie(c, chunkName(m.conf.CookieName, i), chunk, 0)
+	}
+
+	for i := len(chunks); i < maxCookieChunks; i++ {
+		if _, err := c.Request.Cookie(chunkName(m.conf.CookieName, i)); err == nil {
+			m.setCookie(c, chunkName(m.conf.CookieName, i), "", -1)
+		}
+	}
+
+	return nil
+}
+
+func (m *sessionManager) clearSession(c *gin.Context) {
+	for i := 0; i < maxCookieChunks; i++ {
+		if _, err := c.Request.Cookie(chunkName(m.conf.CookieName, i)); err == nil {
+			m.setCookie(c, chunkName(m.conf.CookieName, i), "", -1)
+		}
+	}
+}
+
+// setCookie sets a gateway cookie. It is deleted when maxAge is negative and
+// kept until the browser closes when it is 0.
+func (m *sessionManager) setCookie(c *gin.Context, name, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     m.conf.CookiePath,
+		Domain:   m.conf.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   !m.conf.InsecureCookie,
+		HttpOnly: true,
+		// Lax cookies are sent on the top level redirection from the
+		// provider to the callback route.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (m *sessionManager) loginCookieName() string {
+	return m.conf.CookieName + "_login"
+}
+
+// isSessionCookie reports whether name is one of the gateway cookies, they
+// are not sent to the upstream.
+func (m *sessionManager) isSessionCookie(name string) bool {
+	suffix, ok := strings.CutPrefix(name, m.conf.CookieName)
+	return ok && (suffix == "" || suffix == "_login" || sessionChunkPattern.MatchString(suffix))
+}
+
+// isLocalRedirect reports whether target is a path of the gateway origin,
+// redirections to other origins are rejected. Browsers ignore tabs and line
+// breaks and read backslashes as slashes.
+func isLocalRedirect(target string) bool {
+	return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") && !strings.ContainsAny(target, "\\\t\r\n")
+}
+
+func randomString() string {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Size of a cookie chunk value, browsers reject cookies larger than 4KB
+	// including their name and attributes.
+	maxCookieChunkSize = 3800
+	maxCookieChunks    = 5
+)
+
+var (
+	ErrInvalidCookieSecret = errors.New("cookie secret must be 32 base64 encoded bytes")
+	ErrInvalidCookie       = errors.New("invalid cookie")
+	ErrSessionTooLarge     = errors.New("session too large")
+)
+
+// cookieCodec encrypts the values stored in cookies with AES-GCM. The cookie
+// name is authenticated, a value can't be moved to another cookie.
+type cookieCodec struct {
+	aead cipher.AEAD
+}
+
+func newCookieCodec(secret string) (*cookieCodec, error) {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidCookieSecret
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cookieCodec{aead: aead}, nil
+}
+
+func (c *cookieCodec) encode(name string, value any) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plaintext, []byte(name))), nil
+}
+
+func (c *cookieCodec) decode(name, encoded string, value any) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return ErrInvalidCookie
+	}
+
+	nonceSize := c.aead.NonceSize()
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return ErrInvalidCookie
+	}
+
+	if err := json.Unmarshal(plaintext, value); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+
+	return nil
+}
+
+// chunkName returns the name of the cookie holding the i-th chunk of a
+// value split across several cookies.
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+
+	return name + "_" + strconv.Itoa(i)
+}
+
+// splitChunks splits value in chunks of at most size bytes.
+func splitChunks(value string, size int) []string {
+	chunks := []string{}
+	for len(value) > size {
+		chunks = append(chunks, value[:size])
+		value = value[size:]
+	}
+
+	return append(chunks, value)
+}
+
+// readChunks joins the chunks of the cookie name sent with the request.
+func readChunks(r *http.Request, name string) (string, bool) {
+	value := strings.Builder{}
+	for i := 0; i < maxCookieChunks; i++ {
+		cookie, err := r.Cookie(chunkName(name, i))
+		if err != nil {
+			break
+		}
+		value.WriteString(cookie.Value)
+	}
+
+	return value.String(), value.Len() > 0
+}
+
+// stripCookies removes the cookies matched by strip from the request.
+func stripCookies(r *http.Request, strip func(name string) bool) {
+	if r.Header.Get("Cookie") == "" {
+		return
+	}
+
+	kept := []string{}
+	for _, cookie := range r.Cookies() {
+		if !strip(cookie.Name) {
+			kept = append(kept, cookie.String())
+		}
+	}
+
+	if len(kept) == 0 {
+		r.Header.Del("Cookie")
+		return
+	}
+
+	r.Header.Set("Cookie", strings.Join(kept, "; "))
+}
@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var cookieSecret = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestNewAuthMiddlewareSession(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		conf        SessionConfig
+		expectedErr error
+	}
+
+	provider := test.LaunchTestProvider()
+
+	var testCases = [...]testData{
+		{
+			name: "Success case",
+			conf: SessionConfig{RedirectURL: "https://app.example.com/auth/callback", CookieSecret: cookieSecret},
+		},
+		{
+			name:        "Fail case: unknown provider",
+			shouldFail:  true,
+			conf:        SessionConfig{Provider: "unknown", RedirectURL: "https://app.example.com/auth/callback", CookieSecret: cookieSecret},
+			expectedErr: ErrUnknownProvider,
+		},
+		{
+			name:        "Fail case: no redirect url",
+			shouldFail:  true,
+			conf:        SessionConfig{CookieSecret: cookieSecret},
+			expectedErr: ErrNoRedirectURL,
+		},
+		{
+			name:        "Fail case: invalid cookie secret",
+			shouldFail:  true,
+			conf:        SessionConfig{RedirectURL: "https://app.example.com/auth/callback", CookieSecret: "secret"},
+			expectedErr: ErrInvalidCookieSecret,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+				ProviderURL: provider.URL,
+				ClientID:    "123456",
+				Session:     &testCase.conf,
+			})
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, middleware.session)
+		})
+	}
+}
+
+// launchSessionGateway serves the session routes and a `/api` endpoint
+// accepting sessions, echoing the credentials it receives.
+func launchSessionGateway(t *testing.T, providerURL string, conf SessionConfig) *httptest.Server {
+	var router *gin.Engine
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(gateway.Close)
+
+	conf.RedirectURL = gateway.URL + "/auth/callback"
+	conf.CookieSecret = cookieSecret
+	conf.InsecureCookie = true
+
+	middleware, err := NewAuthMiddleware(AuthMiddlewareConfig{
+		ProviderURL: providerURL,
+		ClientID:    "123456",
+		Session:     &conf,
+	})
+	assert.NoError(t, err)
+
+	guard, err := middleware.Guard(Rules{Modes: []string{ModeSession, ModeBearer}})
+	assert.NoError(t, err)
+
+	router = gin.New()
+	middleware.AttachSessionRoutes(router)
+	router.GET("/api", guard, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"authorization": c.GetHeader("Authorization"),
+			"cookie":        c.GetHeader("Cookie"),
+		})
+	})
+
+	return gateway
+}
+
+func newBrowser() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// login runs the login flow and returns the location the browser lands on.
+func login(t *testing.T, browser *http.Client, gatewayURL, redirect string) string {
+	location := gatewayURL + "/auth/login?redirect=" + url.QueryEscape(redirect)
+	for i := 0; i < 3; i++ {
+		res, err := browser.Get(location)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+
+		location = res.Header.Get("Location")
+	}
+
+	return location
+}
+
+func callAPI(t *testing.T, browser *http.Client, gatewayURL string) (int, map[string]string) {
+	req, _ := http.NewRequest("GET", gatewayURL+"/api", nil)
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	res, err := browser.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body := map[string]string{}
+	if res.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	}
+
+	return res.StatusCode, body
+}
+
+func TestSessionLoginFlow(t *testing.T) {
+	provider := test.LaunchTestProvider()
+	gateway := launchSessionGateway(t, provider.URL, SessionConfig{})
+	browser := newBrowser()
+
+	status, _ := callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	assert.Equal(t, "/app?tab=orders", login(t, browser, gateway.URL, "/app?tab=orders"))
+
+	status, body := callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.HasPrefix(body["authorization"], "Bearer ey"))
+	assert.Equal(t, "theme=dark", body["cookie"])
+
+	res, err := browser.Get(gateway.URL + "/auth/logout")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, provider.URL+"/logout", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "123456", location.Query().Get("client_id"))
+	assert.NotEmpty(t, location.Query().Get("id_token_hint"))
+
+	status, _ = callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestSessionLoginRedirect(t *testing.T) {
+	type testData struct {
+		name             string
+		redirect         string
+		expectedLocation string
+	}
+
+	provider := test.LaunchTestProvider()
+	gateway := launchSessionGateway(t, provider.URL, SessionConfig{PostLoginRedirect: "/home"})
+
+	var testCases = [...]testData{
+		{
+			name:             "Local path",
+			redirect:         "/orders/1",
+			expectedLocation: "/orders/1",
+		},
+		{
+			name:             "No redirect",
+			expectedLocation: "/home",
+		},
+		{
+			name:             "Other origin",
+			redirect:         "https://evil.example.com",
+			expectedLocation: "/home",
+		},
+		{
+			name:             "Protocol relative",
+			redirect:         "//evil.example.com",
+			expectedLocation: "/home",
+		},
+		{
+			name:             "Backslash",
+			redirect:         `/\evil.example.com`,
+			expectedLocation: "/home",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedLocation, login(t, newBrowser(), gateway.URL, testCase.redirect))
+		})
+	}
+}
+
+func TestSessionCallbackInvalidState(t *testing.T) {
+	provider := test.LaunchTestProvider()
+	gateway := launchSessionGateway(t, provider.URL, SessionConfig{})
+	browser := newBrowser()
+
+	res, err := browser.Get(gateway.URL + "/auth/login")
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	res, err = browser.Get(res.Header.Get("Location"))
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	assert.NoError(t, err)
+	query := callback.Query()
+	query.Set("state", "forged")
+	callback.RawQuery = query.Encode()
+
+	res, err = browser.Get(callback.String())
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	status, _ := callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestSessionRefresh(t *testing.T) {
+	refreshes := atomic.Int64{}
+	rejectRefresh := atomic.Bool{}
+	provider := test.LaunchTestProvider(func(c *gin.Context) {
+		if c.Request.URL.Path == "/token" && c.PostForm("grant_type") == "refresh_token" {
+			refreshes.Add(1)
+			if rejectRefresh.Load() {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			}
+		}
+	})
+
+	// Tokens are always about to expire, every request refreshes them.
+	gateway := launchSessionGateway(t, provider.URL, SessionConfig{RefreshBefore: 2 * test.TokenLifetime})
+	browser := newBrowser()
+	login(t, browser, gateway.URL, "/")
+
+	gatewayURL, _ := url.Parse(gateway.URL)
+	loggedIn := browser.Jar.Cookies(gatewayURL)
+
+	status, _ := callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), refreshes.Load())
+	assert.NotEqual(t, loggedIn, browser.Jar.Cookies(gatewayURL))
+
+	// Concurrent requests of a session share a single refresh, the refresh
+	// token can only be used once.
+	current := browser.Jar.Cookies(gatewayURL)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			other := newBrowser()
+			other.Jar.SetCookies(gatewayURL, current)
+			status, _ := callAPI(t, other, gateway.URL)
+			assert.Equal(t, http.StatusOK, status)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(2), refreshes.Load())
+
+	// The previous cookie is still sent by the requests started before the
+	// refresh.
+	status, _ = callAPI(t, browser, gateway.URL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), refreshes.Load())
+
+	rejectRefresh.Store(true)
+	expired := newBrowser()
+	login(t, expired, gateway.URL, "/")
+	status, _ = callAPI(t, expired, gateway.URL)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Empty(t, expired.Jar.Cookies(gatewayURL))
+}
+
+func TestCookieCodec(t *testing.T) {
+	codec, err := newCookieCodec(cookieSecret)
+	assert.NoError(t, err)
+
+	encoded, err := codec.encode("gateway_session", session{AccessToken: "token", Expiry: time.Unix(0, 0).UTC()})
+	assert.NoError(t, err)
+
+	decoded := session{}
+	assert.NoError(t, codec.decode("gateway_session", encoded, &decoded))
+	assert.Equal(t, session{AccessToken: "token", Expiry: time.Unix(0, 0).UTC()}, decoded)
+
+	assert.ErrorIs(t, codec.decode("gateway_session_login", encoded, &decoded), ErrInvalidCookie)
+	assert.ErrorIs(t, codec.decode("gateway_session", encoded[:len(encoded)-2]+"AA", &decoded), ErrInvalidCookie)
+	assert.ErrorIs(t, codec.decode("gateway_session", "", &decoded), ErrInvalidCookie)
+}
+
+func TestSessionChunks(t *testing.T) {
+	manager, err := newSessionManager(SessionConfig{RedirectURL: "https://app.example.com/auth/callback", CookieSecret: cookieSecret}, ProviderConfig{ClientID: "123456"}, nil)
+	assert.NoError(t, err)
+
+	large := &session{AccessToken: strings.Repeat("a", 2*maxCookieChunkSize)}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	assert.NoError(t, manager.writeSession(c, large))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	assert.Len(t, req.Cookies(), 3)
+
+	decoded, err := manager.readSession(req)
+	assert.NoError(t, err)
+	assert.Equal(t, large, decoded)
+
+	// A smaller session clears the chunks left by the previous one.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = req
+	assert.NoError(t, manager.writeSession(c, &session{AccessToken: "token"}))
+
+	cleared := []string{}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			cleared = append(cleared, cookie.Name)
+		}
+	}
+	assert.Equal(t, []string{"gateway_session_1", "gateway_session_2"}, cleared)
+
+	tooLarge := &session{AccessToken: strings.Repeat("a", maxCookieChunks*maxCookieChunkSize)}
+	assert.ErrorIs(t, manager.writeSession(c, tooLarge), ErrSessionTooLarge)
+
+	req.AddCookie(&http.Cookie{Name: "gateway_session_login", Value: "state"})
+	req.AddCookie(&http.Cookie{Name: "gateway_sessions", Value: "kept"})
+	stripCookies(req, manager.isSessionCookie)
+	assert.Equal(t, "gateway_sessions=kept", req.Header.Get("Cookie"))
+}
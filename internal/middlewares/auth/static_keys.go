@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoStaticKeys       = errors.New("no static key configured")
+	ErrInvalidStaticKey   = errors.New("invalid static key")
+	ErrNoIssuer           = errors.New("no issuer configured")
+	ErrNoVerificationKey  = errors.New("no key can verify the token")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+// StaticKeysConfig validates tokens offline with locally configured keys, the
+// provider discovery document is never fetched. Tokens must be issued by the
+// provider URL.
+type StaticKeysConfig struct {
+	// Path of a JSON Web Key Set file.
+	JWKSFile string `mapstructure:"jwks_file"`
+	// PEM encoded public keys or certificates.
+	PublicKeys []string `mapstructure:"public_keys"`
+	// Shared secrets of HMAC signed tokens.
+	HMACSecrets []string `mapstructure:"hmac_secrets"`
+	// Accepted audiences, override the provider audiences. The client ID by
+	// default.
+	Audiences []string `mapstructure:"audiences"`
+	// Tolerated clock difference when checking `exp`, `nbf` and `iat`.
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+}
+
+// staticKey is a verification key, kid and alg are only known for keys
+// loaded from a JWKS.
+type staticKey struct {
+	id        string
+	algorithm string
+	key       any
+}
+
+type staticVerifier struct {
+	keys   []staticKey
+	parser *jwt.Parser
+}
+
+func newStaticVerifier(conf StaticKeysConfig, issuer string) (*staticVerifier, error) {
+	if issuer == "" {
+		return nil, ErrNoIssuer
+	}
+
+	keys, err := loadStaticKeys(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticVerifier{
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithIssuer(issuer),
+			jwt.WithLeeway(conf.ClockSkew),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}, nil
+}
+
+func loadStaticKeys(conf StaticKeysConfig) ([]staticKey, error) {
+	keys := []staticKey{}
+
+	if conf.JWKSFile != "" {
+		jwksKeys, err := loadJWKSFile(conf.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwksKeys...)
+	}
+
+	for i, publicKey := range conf.PublicKeys {
+		pemKeys, err := parsePEMKeys(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %w", i, err)
+		}
+		keys = append(keys, pemKeys...)
+	}
+
+	for _, secret := range conf.HMACSecrets {
+		keys = append(keys, staticKey{key: []byte(secret)})
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoStaticKeys
+	}
+
+	return keys, nil
+}
+
+func loadJWKSFile(path string) ([]staticKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read jwks file: %w", err)
+	}
+
+	jwks := jose.JSONWebKeySet{}
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("%w: can't decode jwks file: %s", ErrInvalidStaticKey, err)
+	}
+
+	keys := make([]staticKey, 0, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key := jwk.Key
+		// Private keys are only used for their public part.
+		if _, symmetric := key.([]byte); !symmetric && !jwk.IsPublic() {
+			key = jwk.Public().Key
+		}
+
+		keys = append(keys, staticKey{id: jwk.KeyID, algorithm: jwk.Algorithm, key: key})
+	}
+
+	return keys, nil
+}
+
+// parsePEMKeys parses the public keys and certificates of a PEM bundle.
+func parsePEMKeys(bundle string) ([]staticKey, error) {
+	keys := []staticKey{}
+
+	rest := []byte(strings.TrimSpace(bundle))
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("%w: can't decode pem", ErrInvalidStaticKey)
+		}
+
+		var key any
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			err = fmt.Errorf("%w: pem block %s", ErrUnsupportedKeyType, block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidStaticKey, err)
+		}
+
+		keys = append(keys, staticKey{key: key})
+		rest = []byte(strings.TrimSpace(string(rest)))
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: empty pem", ErrInvalidStaticKey)
+	}
+
+	return keys, nil
+}
+
+func (v *staticVerifier) verify(_ context.Context, rawToken string) (*jwt.Token, error) {
+	token, err := v.parser.Parse(rawToken, v.verificationKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// verificationKeys returns the keys able to verify the token signature. Keys
+// are selected by kid when the token has one.
+func (v *staticVerifier) verificationKeys(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	keySet := jwt.VerificationKeySet{}
+	for _, key := range v.keys {
+		if kid != "" && key.id != "" && key.id != kid {
+			continue
+		}
+		if key.algorithm != "" && key.algorithm != token.Method.Alg() {
+			continue
+		}
+		if !compatibleKey(token.Method, key.key) {
+			continue
+		}
+
+		keySet.Keys = append(keySet.Keys, key.key)
+	}
+
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("%w: alg %s", ErrNoVerificationKey, token.Method.Alg())
+	}
+
+	return keySet, nil
+}
+
+// compatibleKey reports whether the key can verify signatures of the method,
+// preventing algorithm confusion between asymmetric keys and HMAC secrets.
+func compatibleKey(method jwt.SigningMethod, key any) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	case *jwt.SigningMethodHMAC:
+		_, ok := key.([]byte)
+		return ok
+	default:
+		return false
+	}
+}
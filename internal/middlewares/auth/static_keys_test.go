@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const staticIssuer = "https://issuer.local"
+
+func signStaticToken(method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signedToken, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return signedToken
+}
+
+func writeJWKSFile(t *testing.T, keys ...jose.JSONWebKey) string {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, test.MustMarshall(jose.JSONWebKeySet{Keys: keys}), 0o600))
+	return path
+}
+
+func TestNewStaticVerifier(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		conf        StaticKeysConfig
+		issuer      string
+		expectedErr error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:   "Success case: pem public key",
+			conf:   StaticKeysConfig{PublicKeys: []string{test.RS256PublicKey}},
+			issuer: staticIssuer,
+		},
+		{
+			name:   "Success case: hmac secret",
+			conf:   StaticKeysConfig{HMACSecrets: []string{"secret"}},
+			issuer: staticIssuer,
+		},
+		{
+			name:        "Fail case: no key",
+			shouldFail:  true,
+			issuer:      staticIssuer,
+			expectedErr: ErrNoStaticKeys,
+		},
+		{
+			name:        "Fail case: no issuer",
+			shouldFail:  true,
+			conf:        StaticKeysConfig{HMACSecrets: []string{"secret"}},
+			expectedErr: ErrNoIssuer,
+		},
+		{
+			name:        "Fail case: invalid pem",
+			shouldFail:  true,
+			conf:        StaticKeysConfig{PublicKeys: []string{"not a key"}},
+			issuer:      staticIssuer,
+			expectedErr: ErrInvalidStaticKey,
+		},
+		{
+			name:        "Fail case: private key",
+			shouldFail:  true,
+			conf:        StaticKeysConfig{PublicKeys: []string{test.RS256PrivateKey}},
+			issuer:      staticIssuer,
+			expectedErr: ErrInvalidStaticKey,
+		},
+		{
+			name:       "Fail case: missing jwks file",
+			shouldFail: true,
+			conf:       StaticKeysConfig{JWKSFile: "unknown.json"},
+			issuer:     staticIssuer,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			verifier, err := newStaticVerifier(testCase.conf, testCase.issuer)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				if testCase.expectedErr != nil {
+					assert.ErrorIs(t, err, testCase.expectedErr)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, verifier)
+		})
+	}
+}
+
+func TestStaticVerifierVerify(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		token       string
+		expectedErr error
+	}
+
+	block, _ := pem.Decode([]byte(test.RS256PrivateKey))
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.NoError(t, err)
+	privateKey := parsedKey.(*rsa.PrivateKey)
+
+	jwksPath := writeJWKSFile(t, jose.JSONWebKey{
+		Key:       &privateKey.PublicKey,
+		KeyID:     "rsa",
+		Algorithm: "RS256",
+		Use:       "sig",
+	})
+
+	verifier, err := newStaticVerifier(StaticKeysConfig{
+		JWKSFile:    jwksPath,
+		HMACSecrets: []string{"secret"},
+		ClockSkew:   time.Minute,
+	}, staticIssuer)
+	assert.NoError(t, err)
+
+	pemVerifier, err := newStaticVerifier(StaticKeysConfig{
+		PublicKeys: []string{test.RS256PublicKey},
+	}, staticIssuer)
+	assert.NoError(t, err)
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss": staticIssuer,
+			"aud": "api",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+				continue
+			}
+			claims[key] = value
+		}
+		return claims
+	}
+
+	var testCases = [...]testData{
+		{
+			name:  "Success case: jwks key selected by kid",
+			token: signStaticToken(jwt.SigningMethodRS256, privateKey, "rsa", claims(nil)),
+		},
+		{
+			name:  "Success case: jwks key without kid",
+			token: signStaticToken(jwt.SigningMethodRS256, privateKey, "", claims(nil)),
+		},
+		{
+			name:  "Success case: hmac secret",
+			token: signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(nil)),
+		},
+		{
+			name:  "Success case: expired within clock skew",
+			token: signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})),
+		},
+		{
+			name:  "Success case: not before within clock skew",
+			token: signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"nbf": time.Now().Add(30 * time.Second).Unix()})),
+		},
+		{
+			name:        "Fail case: expired",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"exp": time.Now().Add(-2 * time.Minute).Unix()})),
+			expectedErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:        "Fail case: not valid yet",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"nbf": time.Now().Add(2 * time.Minute).Unix()})),
+			expectedErr: jwt.ErrTokenNotValidYet,
+		},
+		{
+			name:        "Fail case: no expiry",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"exp": nil})),
+			expectedErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:        "Fail case: invalid issuer",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", claims(jwt.MapClaims{"iss": "https://other.local"})),
+			expectedErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:        "Fail case: invalid signature",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodHS256, []byte("other"), "", claims(nil)),
+			expectedErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:        "Fail case: unknown kid",
+			shouldFail:  true,
+			token:       signStaticToken(jwt.SigningMethodRS256, privateKey, "other", claims(nil)),
+			expectedErr: ErrNoVerificationKey,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			token, err := verifier.verify(context.Background(), testCase.token)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				if testCase.expectedErr != nil {
+					assert.ErrorIs(t, err, testCase.expectedErr)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, token.Valid)
+		})
+	}
+
+	t.Run("Fail case: public key used as hmac secret", func(t *testing.T) {
+		_, err := pemVerifier.verify(context.Background(), signStaticToken(jwt.SigningMethodHS256, []byte(test.RS256PublicKey), "", claims(jwt.MapClaims{"aud": "client"})))
+		assert.ErrorIs(t, err, ErrNoVerificationKey)
+	})
+}
+
+func TestStaticKeysProviderAudiences(t *testing.T) {
+	type testData struct {
+		name         string
+		shouldFail   bool
+		conf         ProviderConfig
+		requirements *tokenRequirements
+		audience     string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:     "Success case: client id audience by default",
+			conf:     ProviderConfig{ClientID: "client"},
+			audience: "client",
+		},
+		{
+			name:     "Success case: static keys audiences",
+			conf:     ProviderConfig{ClientID: "client", StaticKeys: &StaticKeysConfig{Audiences: []string{"gateway", "api"}}},
+			audience: "api",
+		},
+		{
+			name:     "Success case: provider audiences",
+			conf:     ProviderConfig{ClientID: "client", Audiences: []string{"api"}},
+			audience: "api",
+		},
+		{
+			name:         "Success case: overridden audiences",
+			conf:         ProviderConfig{ClientID: "client"},
+			requirements: &tokenRequirements{audiences: []string{"orders"}},
+			audience:     "orders",
+		},
+		{
+			name:       "Fail case: static keys audiences replace the client id",
+			shouldFail: true,
+			conf:       ProviderConfig{ClientID: "client", StaticKeys: &StaticKeysConfig{Audiences: []string{"gateway", "api"}}},
+			audience:   "client",
+		},
+		{
+			name:         "Fail case: overridden audiences replace the client id",
+			shouldFail:   true,
+			conf:         ProviderConfig{ClientID: "client"},
+			requirements: &tokenRequirements{audiences: []string{"orders"}},
+			audience:     "client",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := testCase.conf
+			conf.ProviderURL = staticIssuer
+			if conf.StaticKeys == nil {
+				conf.StaticKeys = &StaticKeysConfig{}
+			}
+			conf.StaticKeys.HMACSecrets = []string{"secret"}
+
+			provider, err := newProvider("default", conf, AuthMiddlewareConfig{})
+			assert.NoError(t, err)
+
+			token := signStaticToken(jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+				"iss": staticIssuer,
+				"aud": testCase.audience,
+				"exp": time.Now().Add(time.Hour).Unix(),
+			})
+
+			_, err = provider.verify(context.Background(), token, testCase.requirements)
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, ErrInvalidAudience)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestStaticKeysJWKSPrivateKey(t *testing.T) {
+	block, _ := pem.Decode([]byte(test.RS256PrivateKey))
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.NoError(t, err)
+
+	keys, err := loadJWKSFile(writeJWKSFile(t,
+		jose.JSONWebKey{Key: parsedKey, KeyID: "private"},
+		jose.JSONWebKey{Key: parsedKey.(*rsa.PrivateKey).Public(), KeyID: "encryption", Use: "enc"},
+	))
+	assert.NoError(t, err)
+
+	// Encryption keys are ignored, private keys are reduced to their public part.
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "private", keys[0].id)
+	assert.IsType(t, &rsa.PublicKey{}, keys[0].key)
+}
@@ -0,0 +1,221 @@
+package circuitbreaker
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Aloe-Corporation/logs"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	log = logs.Get()
+)
+
+const (
+	defaultFailureRatio        = 0.5
+	defaultMinRequests         = 10
+	defaultWindow              = 10 * time.Second
+	defaultOpenTimeout         = 30 * time.Second
+	defaultHalfOpenMaxRequests = 1
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	// Ratio of failed requests, between 0 and 1, above which the circuit opens.
+	FailureRatio float64 `mapstructure:"failure_ratio"`
+	// Minimum number of requests in the window before the ratio is evaluated.
+	MinRequests int `mapstructure:"min_requests"`
+	// Duration after which closed state counters are reset.
+	Window time.Duration `mapstructure:"window"`
+	// Duration the circuit stays open before letting probe requests through.
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+	// Number of successful probe requests needed to close the circuit.
+	HalfOpenMaxRequests int `mapstructure:"half_open_max_requests"`
+}
+
+type CircuitBreaker struct {
+	name string
+	conf Config
+
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+	mu          sync.Mutex
+}
+
+func New(name string, conf Config) *CircuitBreaker {
+	if conf.FailureRatio <= 0 {
+		conf.FailureRatio = defaultFailureRatio
+	}
+
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultMinRequests
+	}
+
+	if conf.Window <= 0 {
+		conf.Window = defaultWindow
+	}
+
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = defaultOpenTimeout
+	}
+
+	if conf.HalfOpenMaxRequests <= 0 {
+		conf.HalfOpenMaxRequests = defaultHalfOpenMaxRequests
+	}
+
+	return &CircuitBreaker{
+		name:        name,
+		conf:        conf,
+		state:       Closed,
+		windowStart: time.Now(),
+	}
+}
+
+// Guard fast-fails requests while the circuit is open. Responses with a 5xx
+// status code are counted as failures.
+func (b *CircuitBreaker) Guard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, retryAfter := b.allow()
+		if !ok {
+			log.Error("CircuitBreaker middleware blocking",
+				zap.String("reason", "circuit open"),
+				zap.String("circuit", b.name),
+			)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, "service unavailable")
+			return
+		}
+
+		c.Next()
+
+		b.record(c.Writer.Status() < http.StatusInternalServerError)
+	}
+}
+
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refreshState(time.Now())
+	return b.state
+}
+
+// allow reports whether a request can go through and, if not, how long the
+// client should wait before retrying.
+func (b *CircuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refreshState(now)
+
+	switch b.state {
+	case Open:
+		return false, b.openedAt.Add(b.conf.OpenTimeout).Sub(now)
+	case HalfOpen:
+		if b.probes >= b.conf.HalfOpenMaxRequests {
+			return false, time.Second
+		}
+		b.probes++
+	}
+
+	return true, 0
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refreshState(now)
+
+	switch b.state {
+	case Closed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+
+		if b.requests >= b.conf.MinRequests && float64(b.failures)/float64(b.requests) >= b.conf.FailureRatio {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		if !success {
+			b.setState(Open, now)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.conf.HalfOpenMaxRequests {
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// refreshState moves the circuit to half-open once the open timeout is
+// elapsed and resets closed state counters at the end of each window.
+func (b *CircuitBreaker) refreshState(now time.Time) {
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) >= b.conf.OpenTimeout {
+			b.setState(HalfOpen, now)
+		}
+	case Closed:
+		if now.Sub(b.windowStart) >= b.conf.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+	}
+}
+
+func (b *CircuitBreaker) setState(state State, now time.Time) {
+	log.Warn("circuit breaker state changed",
+		zap.String("circuit", b.name),
+		zap.String("from", b.state.String()),
+		zap.String("to", state.String()),
+	)
+
+	b.state = state
+	switch state {
+	case Open:
+		b.openedAt = now
+	case HalfOpen:
+		b.probes = 0
+		b.successes = 0
+	case Closed:
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+}
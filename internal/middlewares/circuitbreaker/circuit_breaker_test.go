@@ -0,0 +1,137 @@
+package circuitbreaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	breaker := New("test", Config{})
+	assert.Equal(t, defaultFailureRatio, breaker.conf.FailureRatio)
+	assert.Equal(t, defaultMinRequests, breaker.conf.MinRequests)
+	assert.Equal(t, defaultWindow, breaker.conf.Window)
+	assert.Equal(t, defaultOpenTimeout, breaker.conf.OpenTimeout)
+	assert.Equal(t, defaultHalfOpenMaxRequests, breaker.conf.HalfOpenMaxRequests)
+	assert.Equal(t, Closed, breaker.State())
+}
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	type testData struct {
+		name          string
+		conf          Config
+		results       []bool
+		expectedState State
+	}
+
+	var testCases = [...]testData{
+		{
+			name:          "Stays closed below min requests",
+			conf:          Config{FailureRatio: 0.5, MinRequests: 4},
+			results:       []bool{false, false, false},
+			expectedState: Closed,
+		},
+		{
+			name:          "Stays closed below failure ratio",
+			conf:          Config{FailureRatio: 0.5, MinRequests: 4},
+			results:       []bool{true, true, true, false},
+			expectedState: Closed,
+		},
+		{
+			name:          "Opens above failure ratio",
+			conf:          Config{FailureRatio: 0.5, MinRequests: 4},
+			results:       []bool{true, false, true, false},
+			expectedState: Open,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			breaker := New("test", testCase.conf)
+			for _, result := range testCase.results {
+				breaker.record(result)
+			}
+			assert.Equal(t, testCase.expectedState, breaker.State())
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breaker := New("test", Config{
+		FailureRatio:        0.5,
+		MinRequests:         1,
+		OpenTimeout:         50 * time.Millisecond,
+		HalfOpenMaxRequests: 2,
+	})
+
+	breaker.record(false)
+	ok, retryAfter := breaker.allow()
+	assert.False(t, ok)
+	assert.Greater(t, retryAfter, time.Duration(0))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, HalfOpen, breaker.State())
+
+	// Only the configured number of probes is let through.
+	ok, _ = breaker.allow()
+	assert.True(t, ok)
+	ok, _ = breaker.allow()
+	assert.True(t, ok)
+	ok, _ = breaker.allow()
+	assert.False(t, ok)
+
+	breaker.record(true)
+	assert.Equal(t, HalfOpen, breaker.State())
+	breaker.record(true)
+	assert.Equal(t, Closed, breaker.State())
+
+	// A failed probe opens the circuit again.
+	breaker.record(false)
+	time.Sleep(60 * time.Millisecond)
+	ok, _ = breaker.allow()
+	assert.True(t, ok)
+	breaker.record(false)
+	assert.Equal(t, Open, breaker.State())
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	breaker := New("test", Config{
+		FailureRatio: 0.5,
+		MinRequests:  2,
+		Window:       50 * time.Millisecond,
+	})
+
+	// The failure is forgotten once the window is elapsed.
+	breaker.record(false)
+	time.Sleep(60 * time.Millisecond)
+	breaker.record(true)
+	assert.Equal(t, Closed, breaker.State())
+}
+
+func TestCircuitBreakerGuard(t *testing.T) {
+	breaker := New("test", Config{
+		FailureRatio: 0.5,
+		MinRequests:  2,
+		OpenTimeout:  time.Minute,
+	})
+
+	router := gin.New()
+	router.GET("/", breaker.Guard(), func(c *gin.Context) {
+		c.Status(http.StatusBadGateway)
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
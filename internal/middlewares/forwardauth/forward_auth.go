@@ -0,0 +1,159 @@
+package forwardauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Aloe-Corporation/logs"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	log = logs.Get()
+
+	ErrNoURL = errors.New("no authorization service url")
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	// Maximum size of a denial response body returned to the client.
+	maxResponseBodySize = 1 << 20
+)
+
+type Config struct {
+	// Authorization service URL. It receives a GET request carrying the
+	// original method, URI and host in X-Forwarded-Method, X-Forwarded-Uri
+	// and X-Forwarded-Host.
+	URL string `mapstructure:"url"`
+	// Request headers sent to the authorization service.
+	RequestHeaders []string `mapstructure:"request_headers"`
+	// Headers of an allowing response copied to the upstream request. Client
+	// supplied copies of these headers are always removed.
+	ResponseHeaders []string `mapstructure:"response_headers"`
+	// 5s by default.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Let requests through when the authorization service can't be reached,
+	// times out or fails with a 5xx. Requests are rejected with 503
+	// otherwise.
+	FailOpen bool `mapstructure:"fail_open"`
+}
+
+type ForwardAuth struct {
+	url             string
+	requestHeaders  []string
+	responseHeaders []string
+	failOpen        bool
+	client          *http.Client
+}
+
+func New(conf Config) (*ForwardAuth, error) {
+	if conf.URL == "" {
+		return nil, ErrNoURL
+	}
+
+	if _, err := url.ParseRequestURI(conf.URL); err != nil {
+		return nil, fmt.Errorf("invalid authorization service url: %w", err)
+	}
+
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultTimeout
+	}
+
+	return &ForwardAuth{
+		url:             conf.URL,
+		requestHeaders:  conf.RequestHeaders,
+		responseHeaders: conf.ResponseHeaders,
+		failOpen:        conf.FailOpen,
+		client: &http.Client{
+			Timeout: conf.Timeout,
+			// Redirections are returned to the client.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+func (f *ForwardAuth) Guard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range f.responseHeaders {
+			c.Request.Header.Del(name)
+		}
+
+		res, err := f.authorize(c.Request.Context(), c.Request)
+		if err == nil && res.StatusCode >= http.StatusInternalServerError {
+			res.Body.Close()
+			err = fmt.Errorf("authorization service responded %d", res.StatusCode)
+		}
+		if err != nil {
+			log.Error("Forward auth middleware failure", zap.Error(err))
+			if f.failOpen {
+				c.Next()
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, "authorization service unavailable")
+			return
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+			f.deny(c, res)
+			return
+		}
+
+		for _, name := range f.responseHeaders {
+			for _, value := range res.Header.Values(name) {
+				c.Request.Header.Add(name, value)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func (f *ForwardAuth) authorize(ctx context.Context, r *http.Request) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range f.requestHeaders {
+		for _, value := range r.Header.Values(name) {
+			req.Header.Add(name, value)
+		}
+	}
+
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-Host", r.Host)
+
+	return f.client.Do(req)
+}
+
+// deny returns the authorization service response to the client.
+func (f *ForwardAuth) deny(c *gin.Context, res *http.Response) {
+	header := res.Header.Clone()
+	proxy.RemoveHopByHopHeaders(header)
+	header.Del("Content-Length")
+
+	for name, values := range header {
+		c.Writer.Header()[name] = values
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBodySize))
+	if err != nil {
+		log.Error("Forward auth middleware failure", zap.Error(err))
+	}
+
+	c.Status(res.StatusCode)
+	_, _ = c.Writer.Write(body)
+	c.Abort()
+}
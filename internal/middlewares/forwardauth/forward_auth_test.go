@@ -0,0 +1,177 @@
+package forwardauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		conf        Config
+		expectedErr error
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Success case",
+			conf: Config{URL: "http://authz/check"},
+		},
+		{
+			name:        "Fail case: no url",
+			shouldFail:  true,
+			expectedErr: ErrNoURL,
+		},
+		{
+			name:       "Fail case: invalid url",
+			shouldFail: true,
+			conf:       Config{URL: "authz"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			forwardAuth, err := New(testCase.conf)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				if testCase.expectedErr != nil {
+					assert.ErrorIs(t, err, testCase.expectedErr)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, defaultTimeout, forwardAuth.client.Timeout)
+		})
+	}
+}
+
+// launchAuthorizationService allows requests with the `Authorization: allow`
+// header and denies the others. The `X-Fail` header makes it fail or time
+// out.
+func launchAuthorizationService() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Fail") {
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "timeout":
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if r.Header.Get("Authorization") != "allow" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"forbidden"}`))
+			return
+		}
+
+		w.Header().Set("X-User-Id", "user-1")
+		w.Header().Set("X-Forwarded-Request", r.Header.Get("X-Forwarded-Method")+" "+r.Header.Get("X-Forwarded-Uri"))
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestForwardAuthGuard(t *testing.T) {
+	type testData struct {
+		name               string
+		header             http.Header
+		failOpen           bool
+		expectedStatusCode int
+		expectedNext       bool
+		expectedUserID     string
+		expectedBody       string
+		expectedWWWAuth    string
+	}
+
+	server := launchAuthorizationService()
+	defer server.Close()
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: allowed",
+			header:             http.Header{"Authorization": []string{"allow"}, "X-User-Id": []string{"spoofed"}},
+			expectedStatusCode: http.StatusOK,
+			expectedNext:       true,
+			expectedUserID:     "user-1",
+		},
+		{
+			name:               "Success case: fail open on error",
+			header:             http.Header{"Authorization": []string{"deny"}, "X-Fail": []string{"error"}, "X-User-Id": []string{"spoofed"}},
+			failOpen:           true,
+			expectedStatusCode: http.StatusOK,
+			expectedNext:       true,
+		},
+		{
+			name:               "Success case: fail open on timeout",
+			header:             http.Header{"X-Fail": []string{"timeout"}},
+			failOpen:           true,
+			expectedStatusCode: http.StatusOK,
+			expectedNext:       true,
+		},
+		{
+			name:               "Fail case: denied",
+			header:             http.Header{"Authorization": []string{"deny"}},
+			failOpen:           true,
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"forbidden"}`,
+			expectedWWWAuth:    `Bearer realm="api"`,
+		},
+		{
+			name:               "Fail case: fail closed on error",
+			header:             http.Header{"Authorization": []string{"allow"}, "X-Fail": []string{"error"}},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       `"authorization service unavailable"`,
+		},
+		{
+			name:               "Fail case: fail closed on timeout",
+			header:             http.Header{"Authorization": []string{"allow"}, "X-Fail": []string{"timeout"}},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       `"authorization service unavailable"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			forwardAuth, err := New(Config{
+				URL:             server.URL,
+				RequestHeaders:  []string{"Authorization", "X-Fail"},
+				ResponseHeaders: []string{"X-User-Id", "X-Forwarded-Request"},
+				Timeout:         50 * time.Millisecond,
+				FailOpen:        testCase.failOpen,
+			})
+			assert.NoError(t, err)
+
+			next := false
+			w := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(w)
+			router.Use(forwardAuth.Guard())
+			router.GET("/orders/:id", func(c *gin.Context) {
+				next = true
+				assert.Equal(t, testCase.expectedUserID, c.GetHeader("X-User-Id"))
+				if testCase.expectedUserID != "" {
+					assert.Equal(t, "GET /orders/1?full=true", c.GetHeader("X-Forwarded-Request"))
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/orders/1?full=true", nil)
+			req.Header = testCase.header
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+			assert.Equal(t, testCase.expectedNext, next)
+			if testCase.expectedBody != "" {
+				assert.Equal(t, testCase.expectedBody, w.Body.String())
+			}
+			assert.Equal(t, testCase.expectedWWWAuth, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
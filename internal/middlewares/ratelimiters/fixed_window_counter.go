@@ -1,19 +1,15 @@
 package ratelimiters
 
 import (
-	"sync"
 	"time"
-)
 
-type FixedWindowCounterConf struct {
-	Window string `mapstructure:"window"`
-}
+	"go.uber.org/zap"
+)
 
 type fixedWindowCounter struct {
 	window   time.Duration
 	maxCount int
-	counters map[string]*counter
-	mu       sync.Mutex
+	counters *store[counter]
 }
 
 type counter struct {
@@ -21,23 +17,41 @@ type counter struct {
 	count     int
 }
 
+func newFixedWindowCounter(window time.Duration, maxCount int, conf storeConfig) *fixedWindowCounter {
+	return &fixedWindowCounter{
+		window:   window,
+		maxCount: maxCount,
+		counters: newStore[counter](window, conf),
+	}
+}
+
 func (f *fixedWindowCounter) allow(key string) bool {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	window, ok := f.counters[key]
-	if !ok || time.Since(window.timestamp) > f.window {
-		f.counters[key] = &counter{
-			timestamp: time.Now().UTC(),
-			count:     1,
+	return f.counters.update(key, func(window *counter, now time.Time) bool {
+		if now.Sub(window.timestamp) > f.window {
+			*window = counter{
+				timestamp: now,
+				count:     1,
+			}
+			return true
 		}
-		return true
-	}
 
-	if window.count < f.maxCount {
-		window.count++
-		return true
-	}
+		if window.count < f.maxCount {
+			window.count++
+			return true
+		}
+
+		return false
+	})
+}
 
-	return false
+func (f *fixedWindowCounter) stop() {
+	f.counters.close()
+}
+
+func (f *fixedWindowCounter) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("algorithm", AlgorithmFixedWindow),
+		zap.Int("max_count", f.maxCount),
+		zap.Duration("window", f.window),
+	}
 }
@@ -1,7 +1,6 @@
 package ratelimiters
 
 import (
-	"sync"
 	"testing"
 	"time"
 
@@ -9,12 +8,9 @@ import (
 )
 
 func TestFixedWindowCounterAllow(t *testing.T) {
-	limiter := &fixedWindowCounter{
-		window:   2 * time.Second,
-		maxCount: 2,
-		counters: make(map[string]*counter),
-		mu:       sync.Mutex{},
-	}
+	clock := newTestClock()
+	limiter := newFixedWindowCounter(2*time.Second, 2, storeConfig{now: clock.now})
+	defer limiter.stop()
 
 	key := "id"
 
@@ -25,7 +21,12 @@ func TestFixedWindowCounterAllow(t *testing.T) {
 	ok = limiter.allow(key)
 	assert.False(t, ok)
 
-	time.Sleep(2 * time.Second)
+	// The window is still running at its end.
+	clock.advance(2 * time.Second)
+	ok = limiter.allow(key)
+	assert.False(t, ok)
+
+	clock.advance(time.Millisecond)
 	ok = limiter.allow(key)
 	assert.True(t, ok)
 }
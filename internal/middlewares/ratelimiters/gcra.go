@@ -0,0 +1,55 @@
+package ratelimiters
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// gcra implements the generic cell rate algorithm: each key only keeps the
+// theoretical arrival time of its next request, which moves forward by the
+// emission interval on every allowed request. Requests arriving more than
+// burst intervals ahead of it are denied.
+type gcra struct {
+	interval  time.Duration
+	tolerance time.Duration
+	arrivals  *store[time.Time]
+}
+
+func newGCRA(rate float64, burst int, conf storeConfig) *gcra {
+	interval := time.Duration(float64(time.Second) / rate)
+	tolerance := interval * time.Duration(burst)
+	return &gcra{
+		interval:  interval,
+		tolerance: tolerance,
+		arrivals:  newStore[time.Time](tolerance, conf),
+	}
+}
+
+func (g *gcra) allow(key string) bool {
+	return g.arrivals.update(key, func(arrival *time.Time, now time.Time) bool {
+		next := arrival.Add(g.interval)
+		if arrival.Before(now) {
+			next = now.Add(g.interval)
+		}
+
+		if next.Sub(now) > g.tolerance {
+			return false
+		}
+
+		*arrival = next
+		return true
+	})
+}
+
+func (g *gcra) stop() {
+	g.arrivals.close()
+}
+
+func (g *gcra) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("algorithm", AlgorithmGCRA),
+		zap.Float64("rate", float64(time.Second)/float64(g.interval)),
+		zap.Int("burst", int(g.tolerance/g.interval)),
+	}
+}
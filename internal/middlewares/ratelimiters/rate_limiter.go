@@ -1,8 +1,9 @@
 package ratelimiters
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/Aloe-Corporation/logs"
@@ -14,27 +15,121 @@ var (
 	log = logs.Get()
 )
 
+var (
+	ErrUnknownAlgorithm = errors.New("unknown rate limiting algorithm")
+	ErrInvalidRate      = errors.New("rate limit rate and burst must be positive")
+)
+
+// Rate limiting algorithms.
+const (
+	// Counts the requests of fixed windows. Allows up to twice the max count
+	// around window edges.
+	AlgorithmFixedWindow = "fixed_window"
+	// Keeps the timestamps of the requests of the last window.
+	AlgorithmSlidingWindowLog = "sliding_window_log"
+	// Weights the previous window count by its overlap with the sliding
+	// window.
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	// Buckets of burst tokens refilled at the rate.
+	AlgorithmTokenBucket = "token_bucket"
+	// Generic cell rate algorithm, spacing requests at the rate with a burst
+	// tolerance.
+	AlgorithmGCRA = "gcra"
+)
+
 type RateLimiterConfig struct {
-	LimitBy  string        `mapstructure:"limit_by"`
-	Window   time.Duration `mapstructure:"window"`
-	MaxCount int           `mapstructure:"max_count"`
+	LimitBy string `mapstructure:"limit_by"`
+	// `fixed_window` by default.
+	Algorithm string        `mapstructure:"algorithm"`
+	Window    time.Duration `mapstructure:"window"`
+	MaxCount  int           `mapstructure:"max_count"`
+	// Requests per second of the token_bucket and gcra algorithms, max_count
+	// per window by default.
+	Rate float64 `mapstructure:"rate"`
+	// Requests allowed at once by the token_bucket and gcra algorithms,
+	// max_count by default.
+	Burst int `mapstructure:"burst"`
+	// Maximum number of tracked keys, never exceeded. Keys are spread over
+	// up to 64 shards sharing it, a full shard evicts its least recently
+	// seen key. 100000 by default.
+	MaxKeys int `mapstructure:"max_keys"`
+	// Interval between the evictions of the keys whose state expired, one
+	// minute by default.
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+// limiter reports whether a request of the key is allowed, and counts it
+// when it is.
+type limiter interface {
+	allow(key string) bool
+	// stop stops the background eviction of the keys.
+	stop()
+	// fields describes the algorithm and its limit.
+	fields() []zap.Field
 }
 
 type RateLimiter struct {
-	limiter             fixedWindowCounter
+	limiter             limiter
 	retrieveLimitingKey KeyRetriever
 }
 
-func NewRateLimiter(conf RateLimiterConfig) *RateLimiter {
+func NewRateLimiter(conf RateLimiterConfig) (*RateLimiter, error) {
+	limiter, err := newLimiter(conf)
+	if err != nil {
+		return nil, err
+	}
+
 	return &RateLimiter{
-		limiter: fixedWindowCounter{
-			window:   conf.Window,
-			maxCount: conf.MaxCount,
-			counters: make(map[string]*counter),
-			mu:       sync.Mutex{},
-		},
+		limiter:             limiter,
 		retrieveLimitingKey: selectKeyRetriever(conf.LimitBy),
+	}, nil
+}
+
+func newLimiter(conf RateLimiterConfig) (limiter, error) {
+	keys := storeConfig{
+		maxKeys:         conf.MaxKeys,
+		cleanupInterval: conf.CleanupInterval,
 	}
+
+	switch conf.Algorithm {
+	case "", AlgorithmFixedWindow:
+		return newFixedWindowCounter(conf.Window, conf.MaxCount, keys), nil
+	case AlgorithmSlidingWindowLog:
+		return newSlidingWindowLog(conf.Window, conf.MaxCount, keys), nil
+	case AlgorithmSlidingWindowCounter:
+		return newSlidingWindowCounter(conf.Window, conf.MaxCount, keys), nil
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		rate, burst := conf.Rate, conf.Burst
+		if rate == 0 && conf.Window > 0 {
+			rate = float64(conf.MaxCount) / conf.Window.Seconds()
+		}
+
+		if burst == 0 {
+			burst = conf.MaxCount
+		}
+
+		if rate <= 0 || burst <= 0 {
+			return nil, ErrInvalidRate
+		}
+
+		if conf.Algorithm == AlgorithmTokenBucket {
+			return newTokenBucket(rate, burst, keys), nil
+		}
+
+		return newGCRA(rate, burst, keys), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, conf.Algorithm)
+	}
+}
+
+// LogFields describes the limiting algorithm and its effective limit.
+func (r *RateLimiter) LogFields() []zap.Field {
+	return r.limiter.fields()
+}
+
+// Stop stops the background eviction of the tracked keys.
+func (r *RateLimiter) Stop() {
+	r.limiter.stop()
 }
 
 func (r *RateLimiter) Allow() gin.HandlerFunc {
@@ -42,13 +137,13 @@ func (r *RateLimiter) Allow() gin.HandlerFunc {
 		key, err := r.retrieveLimitingKey(c)
 		if err != nil {
 			log.Error("RateLimiter middleware failure", zap.Error(err))
-			c.JSON(http.StatusBadRequest, "Bad Request")
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Bad Request")
 			return
 		}
 
 		if !r.limiter.allow(key) {
 			log.Error("RateLimiter middleware blocking", zap.String("reason", "rate limit exceeded"))
-			c.JSON(http.StatusTooManyRequests, "rate limit exceeded")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, "rate limit exceeded")
 			return
 		}
 
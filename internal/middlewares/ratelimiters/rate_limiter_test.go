@@ -3,7 +3,6 @@ package ratelimiters
 import (
 	"net/http"
 	"net/http/httptest"
-	"sync"
 	"testing"
 	"time"
 
@@ -11,13 +10,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestNewRateLimiter(t *testing.T) {
 	type testData struct {
-		name        string
-		conf        RateLimiterConfig
-		expectedRes *RateLimiter
+		name            string
+		conf            RateLimiterConfig
+		shouldFail      bool
+		expectedErr     error
+		expectedLimiter limiter
 	}
 
 	var testCases = [...]testData{
@@ -28,27 +30,197 @@ func TestNewRateLimiter(t *testing.T) {
 				Window:   2 * time.Second,
 				MaxCount: 2,
 			},
-			expectedRes: &RateLimiter{
-				limiter: fixedWindowCounter{
-					window:   2 * time.Second,
-					maxCount: 2,
-					counters: make(map[string]*counter),
-					mu:       sync.Mutex{},
-				},
-				retrieveLimitingKey: retrieveSubClaim,
+			expectedLimiter: &fixedWindowCounter{
+				window:   2 * time.Second,
+				maxCount: 2,
 			},
 		},
+		{
+			name: "Success case: sliding window log",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmSlidingWindowLog,
+				Window:    2 * time.Second,
+				MaxCount:  2,
+			},
+			expectedLimiter: &slidingWindowLog{
+				window:   2 * time.Second,
+				maxCount: 2,
+			},
+		},
+		{
+			name: "Success case: sliding window counter",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmSlidingWindowCounter,
+				Window:    2 * time.Second,
+				MaxCount:  2,
+			},
+			expectedLimiter: &slidingWindowCounter{
+				window:   2 * time.Second,
+				maxCount: 2,
+			},
+		},
+		{
+			name: "Success case: token bucket",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmTokenBucket,
+				Rate:      5,
+				Burst:     10,
+			},
+			expectedLimiter: &tokenBucket{
+				rate:  5,
+				burst: 10,
+			},
+		},
+		{
+			name: "Success case: token bucket rate from window",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmTokenBucket,
+				Window:    2 * time.Second,
+				MaxCount:  10,
+			},
+			expectedLimiter: &tokenBucket{
+				rate:  5,
+				burst: 10,
+			},
+		},
+		{
+			name: "Success case: gcra",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmGCRA,
+				Rate:      4,
+				Burst:     2,
+			},
+			expectedLimiter: &gcra{
+				interval:  250 * time.Millisecond,
+				tolerance: 500 * time.Millisecond,
+			},
+		},
+		{
+			name: "Fail case: unknown algorithm",
+			conf: RateLimiterConfig{
+				Algorithm: "leaky_bucket",
+				Window:    2 * time.Second,
+				MaxCount:  2,
+			},
+			shouldFail:  true,
+			expectedErr: ErrUnknownAlgorithm,
+		},
+		{
+			name: "Fail case: token bucket without rate",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmTokenBucket,
+				Burst:     2,
+			},
+			shouldFail:  true,
+			expectedErr: ErrInvalidRate,
+		},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			limiter := NewRateLimiter(testCase.conf)
-			assert.Equal(t, testCase.expectedRes.limiter.window, limiter.limiter.window)
-			assert.Equal(t, testCase.expectedRes.limiter.maxCount, limiter.limiter.maxCount)
+			rateLimiter, err := NewRateLimiter(testCase.conf)
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			defer rateLimiter.Stop()
+			assert.Equal(t, testCase.expectedLimiter, withoutStore(rateLimiter.limiter))
 		})
 	}
 }
 
+func TestRateLimiterLogFields(t *testing.T) {
+	type testData struct {
+		name           string
+		conf           RateLimiterConfig
+		expectedFields []zap.Field
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Success case: window algorithm",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmSlidingWindowLog,
+				Window:    time.Minute,
+				MaxCount:  60,
+			},
+			expectedFields: []zap.Field{
+				zap.String("algorithm", AlgorithmSlidingWindowLog),
+				zap.Int("max_count", 60),
+				zap.Duration("window", time.Minute),
+			},
+		},
+		{
+			name: "Success case: default algorithm",
+			conf: RateLimiterConfig{
+				Window:   time.Minute,
+				MaxCount: 60,
+			},
+			expectedFields: []zap.Field{
+				zap.String("algorithm", AlgorithmFixedWindow),
+				zap.Int("max_count", 60),
+				zap.Duration("window", time.Minute),
+			},
+		},
+		{
+			name: "Success case: token bucket",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmTokenBucket,
+				Window:    time.Minute,
+				MaxCount:  120,
+			},
+			expectedFields: []zap.Field{
+				zap.String("algorithm", AlgorithmTokenBucket),
+				zap.Float64("rate", 2),
+				zap.Int("burst", 120),
+			},
+		},
+		{
+			name: "Success case: gcra",
+			conf: RateLimiterConfig{
+				Algorithm: AlgorithmGCRA,
+				Rate:      4,
+				Burst:     8,
+			},
+			expectedFields: []zap.Field{
+				zap.String("algorithm", AlgorithmGCRA),
+				zap.Float64("rate", 4),
+				zap.Int("burst", 8),
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rateLimiter, err := NewRateLimiter(testCase.conf)
+			assert.NoError(t, err)
+			defer rateLimiter.Stop()
+
+			assert.Equal(t, testCase.expectedFields, rateLimiter.LogFields())
+		})
+	}
+}
+
+// withoutStore returns a copy of the limiter settings.
+func withoutStore(l limiter) limiter {
+	switch l := l.(type) {
+	case *fixedWindowCounter:
+		return &fixedWindowCounter{window: l.window, maxCount: l.maxCount}
+	case *slidingWindowLog:
+		return &slidingWindowLog{window: l.window, maxCount: l.maxCount}
+	case *slidingWindowCounter:
+		return &slidingWindowCounter{window: l.window, maxCount: l.maxCount}
+	case *tokenBucket:
+		return &tokenBucket{rate: l.rate, burst: l.burst}
+	case *gcra:
+		return &gcra{interval: l.interval, tolerance: l.tolerance}
+	default:
+		return l
+	}
+}
+
 func TestRateLimiterAllowWithSubClaimRetriever(t *testing.T) {
 	header := http.Header{
 		"Authorization": []string{
@@ -65,14 +237,10 @@ func TestRateLimiterAllowWithSubClaimRetriever(t *testing.T) {
 	}
 
 	rateLimiter := &RateLimiter{
-		limiter: fixedWindowCounter{
-			window:   2 * time.Second,
-			maxCount: 2,
-			counters: make(map[string]*counter),
-			mu:       sync.Mutex{},
-		},
+		limiter:             newFixedWindowCounter(2*time.Second, 2, storeConfig{now: newTestClock().now}),
 		retrieveLimitingKey: retrieveSubClaim,
 	}
+	defer rateLimiter.Stop()
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -103,3 +271,62 @@ func TestRateLimiterAllowWithSubClaimRetriever(t *testing.T) {
 	rateLimiter.Allow()(c)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestRateLimiterAllowAbortsChain(t *testing.T) {
+	algorithms := []string{
+		AlgorithmFixedWindow,
+		AlgorithmSlidingWindowLog,
+		AlgorithmSlidingWindowCounter,
+		AlgorithmTokenBucket,
+		AlgorithmGCRA,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run("Success case: "+algorithm, func(t *testing.T) {
+			rateLimiter, err := NewRateLimiter(RateLimiterConfig{
+				Algorithm: algorithm,
+				Window:    time.Hour,
+				MaxCount:  2,
+			})
+			assert.NoError(t, err)
+			defer rateLimiter.Stop()
+
+			calls := 0
+			router := gin.New()
+			router.GET("/", rateLimiter.Allow(), func(c *gin.Context) {
+				calls++
+				c.Status(http.StatusOK)
+			})
+
+			expectedCodes := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+			for _, expectedCode := range expectedCodes {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+				assert.Equal(t, expectedCode, w.Code)
+			}
+
+			assert.Equal(t, 2, calls)
+		})
+	}
+
+	t.Run("Fail case: key error", func(t *testing.T) {
+		rateLimiter, err := NewRateLimiter(RateLimiterConfig{
+			LimitBy:  "sub_claim",
+			Window:   time.Hour,
+			MaxCount: 2,
+		})
+		assert.NoError(t, err)
+		defer rateLimiter.Stop()
+
+		calls := 0
+		router := gin.New()
+		router.GET("/", rateLimiter.Allow(), func(c *gin.Context) {
+			calls++
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, calls)
+	})
+}
@@ -0,0 +1,64 @@
+package ratelimiters
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slidingWindowCounter approximates a sliding window with the counts of the
+// current and previous fixed windows, the previous count being weighted by
+// its overlap with the sliding window.
+type slidingWindowCounter struct {
+	window   time.Duration
+	maxCount int
+	counters *store[windowCounts]
+}
+
+type windowCounts struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+func newSlidingWindowCounter(window time.Duration, maxCount int, conf storeConfig) *slidingWindowCounter {
+	return &slidingWindowCounter{
+		window:   window,
+		maxCount: maxCount,
+		// The previous window counts until the end of the next one.
+		counters: newStore[windowCounts](2*window, conf),
+	}
+}
+
+func (s *slidingWindowCounter) allow(key string) bool {
+	return s.counters.update(key, func(counts *windowCounts, now time.Time) bool {
+		start := now.Truncate(s.window)
+
+		switch {
+		case start.Equal(counts.start.Add(s.window)):
+			counts.start, counts.previous, counts.current = start, counts.current, 0
+		case start.After(counts.start):
+			counts.start, counts.previous, counts.current = start, 0, 0
+		}
+
+		overlap := 1 - float64(now.Sub(start))/float64(s.window)
+		if float64(counts.previous)*overlap+float64(counts.current) >= float64(s.maxCount) {
+			return false
+		}
+
+		counts.current++
+		return true
+	})
+}
+
+func (s *slidingWindowCounter) stop() {
+	s.counters.close()
+}
+
+func (s *slidingWindowCounter) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("algorithm", AlgorithmSlidingWindowCounter),
+		zap.Int("max_count", s.maxCount),
+		zap.Duration("window", s.window),
+	}
+}
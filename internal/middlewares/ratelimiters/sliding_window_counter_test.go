@@ -0,0 +1,38 @@
+package ratelimiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowCounterAllow(t *testing.T) {
+	clock := newTestClock()
+	window := 500 * time.Millisecond
+	limiter := newSlidingWindowCounter(window, 4, storeConfig{now: clock.now})
+	defer limiter.stop()
+
+	key := "id"
+
+	// Start at the end of a window, so that the count weighs on the next one.
+	clock.advance(window - 100*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		assert.True(t, limiter.allow(key))
+	}
+	assert.False(t, limiter.allow(key))
+
+	// The previous window still counts for 90% of the sliding window, unlike
+	// with fixed windows that would allow 4 more requests.
+	clock.advance(150 * time.Millisecond)
+	assert.True(t, limiter.allow(key))
+	assert.False(t, limiter.allow(key))
+	assert.True(t, limiter.allow("other"))
+
+	// Windows without requests reset the counts.
+	clock.advance(2 * window)
+	for i := 0; i < 4; i++ {
+		assert.True(t, limiter.allow(key))
+	}
+	assert.False(t, limiter.allow(key))
+}
@@ -0,0 +1,53 @@
+package ratelimiters
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slidingWindowLog allows max count requests in any window, at the cost of
+// one timestamp per allowed request.
+type slidingWindowLog struct {
+	window   time.Duration
+	maxCount int
+	logs     *store[[]time.Time]
+}
+
+func newSlidingWindowLog(window time.Duration, maxCount int, conf storeConfig) *slidingWindowLog {
+	return &slidingWindowLog{
+		window:   window,
+		maxCount: maxCount,
+		logs:     newStore[[]time.Time](window, conf),
+	}
+}
+
+func (s *slidingWindowLog) allow(key string) bool {
+	return s.logs.update(key, func(timestamps *[]time.Time, now time.Time) bool {
+		// Timestamps are sorted, drop the ones out of the window.
+		expired := 0
+		for expired < len(*timestamps) && now.Sub((*timestamps)[expired]) >= s.window {
+			expired++
+		}
+		*timestamps = (*timestamps)[expired:]
+
+		if len(*timestamps) >= s.maxCount {
+			return false
+		}
+
+		*timestamps = append(*timestamps, now)
+		return true
+	})
+}
+
+func (s *slidingWindowLog) stop() {
+	s.logs.close()
+}
+
+func (s *slidingWindowLog) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("algorithm", AlgorithmSlidingWindowLog),
+		zap.Int("max_count", s.maxCount),
+		zap.Duration("window", s.window),
+	}
+}
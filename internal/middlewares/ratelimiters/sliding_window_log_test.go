@@ -0,0 +1,27 @@
+package ratelimiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowLogAllow(t *testing.T) {
+	clock := newTestClock()
+	limiter := newSlidingWindowLog(500*time.Millisecond, 2, storeConfig{now: clock.now})
+	defer limiter.stop()
+
+	key := "id"
+
+	assert.True(t, limiter.allow(key))
+	clock.advance(300 * time.Millisecond)
+	assert.True(t, limiter.allow(key))
+	assert.False(t, limiter.allow(key))
+	assert.True(t, limiter.allow("other"))
+
+	// Only the first request left the window.
+	clock.advance(250 * time.Millisecond)
+	assert.True(t, limiter.allow(key))
+	assert.False(t, limiter.allow(key))
+}
@@ -0,0 +1,154 @@
+package ratelimiters
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/lru"
+)
+
+const (
+	storeShards = 64
+
+	defaultMaxKeys         = 100000
+	defaultCleanupInterval = time.Minute
+)
+
+// store keeps the limiting state of the keys. Keys are spread over shards
+// locked independently, each one keeping up to its share of max keys and
+// evicting its least recently seen key when full. The shares add up to max
+// keys, a full shard may evict a key before max keys are tracked. Keys not seen for longer
+// than idle, after which their state is the one of a new key, are evicted in
+// background.
+type store[V any] struct {
+	idle   time.Duration
+	now    func() time.Time
+	seed   maphash.Seed
+	shards []shard[V]
+	stop   chan struct{}
+	once   sync.Once
+}
+
+type storeConfig struct {
+	maxKeys         int
+	cleanupInterval time.Duration
+	// Returns the current time, time.Now when nil.
+	now func() time.Time
+}
+
+type shard[V any] struct {
+	mu      sync.Mutex
+	entries *lru.Cache[string, *storeEntry[V]]
+}
+
+type storeEntry[V any] struct {
+	lastSeen time.Time
+	state    V
+}
+
+func newStore[V any](idle time.Duration, conf storeConfig) *store[V] {
+	maxKeys := conf.maxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	cleanupInterval := conf.cleanupInterval
+	if cleanupInterval <= 0 {
+		cleanupInterval = defaultCleanupInterval
+	}
+
+	now := conf.now
+	if now == nil {
+		now = time.Now
+	}
+
+	s := &store[V]{
+		idle: idle,
+		now:  now,
+		seed: maphash.MakeSeed(),
+		stop: make(chan struct{}),
+	}
+
+	// Shards keep at least one key.
+	s.shards = make([]shard[V], min(storeShards, maxKeys))
+	for i := range s.shards {
+		capacity := maxKeys / len(s.shards)
+		if i < maxKeys%len(s.shards) {
+			capacity++
+		}
+		s.shards[i].entries = lru.New[string, *storeEntry[V]](capacity)
+	}
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.evictIdle(s.now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// update calls fn with the state of the key, the zero value for new keys,
+// under the lock of its shard.
+func (s *store[V]) update(key string, fn func(state *V, now time.Time) bool) bool {
+	shard := &s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := s.now()
+	entry, ok := shard.entries.Get(key)
+	if !ok {
+		entry = &storeEntry[V]{}
+		shard.entries.Add(key, entry)
+	}
+
+	entry.lastSeen = now
+	return fn(&entry.state, now)
+}
+
+// evictIdle removes the keys not seen for longer than idle. Shards are
+// ordered by last use, so only the evicted keys are visited.
+func (s *store[V]) evictIdle(now time.Time) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+
+		shard.mu.Lock()
+		for {
+			key, entry, ok := shard.entries.Oldest()
+			if !ok || now.Sub(entry.lastSeen) < s.idle {
+				break
+			}
+
+			shard.entries.Remove(key)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (s *store[V]) size() int {
+	count := 0
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		count += s.shards[i].entries.Len()
+		s.shards[i].mu.Unlock()
+	}
+
+	return count
+}
+
+// close stops the background eviction.
+func (s *store[V]) close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
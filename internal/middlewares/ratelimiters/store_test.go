@@ -0,0 +1,173 @@
+package ratelimiters
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testClock is a clock only moving forward when advanced.
+type testClock struct {
+	mu      sync.Mutex
+	current time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{current: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.current
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current = c.current.Add(d)
+}
+
+func TestStoreUpdate(t *testing.T) {
+	s := newStore[int](time.Minute, storeConfig{})
+	defer s.close()
+
+	increment := func(count *int, now time.Time) bool {
+		*count++
+		return *count <= 2
+	}
+
+	assert.True(t, s.update("a", increment))
+	assert.True(t, s.update("a", increment))
+	assert.False(t, s.update("a", increment))
+	assert.True(t, s.update("b", increment))
+	assert.Equal(t, 2, s.size())
+}
+
+func TestStoreMaxKeys(t *testing.T) {
+	type testData struct {
+		name           string
+		maxKeys        int
+		expectedShards int
+	}
+
+	var testCases = [...]testData{
+		{
+			name:           "Fewer keys than shards",
+			maxKeys:        10,
+			expectedShards: 10,
+		},
+		{
+			name:           "As many keys as shards",
+			maxKeys:        storeShards,
+			expectedShards: storeShards,
+		},
+		{
+			name:           "Keys not divisible by shards",
+			maxKeys:        100,
+			expectedShards: storeShards,
+		},
+	}
+
+	increment := func(count *int, now time.Time) bool {
+		*count++
+		return true
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := newStore[int](time.Minute, storeConfig{maxKeys: testCase.maxKeys})
+			defer s.close()
+
+			capacity := 0
+			for i := range s.shards {
+				capacity += s.shards[i].entries.Cap()
+			}
+			assert.Len(t, s.shards, testCase.expectedShards)
+			assert.Equal(t, testCase.maxKeys, capacity)
+
+			for i := 0; i < 10*testCase.maxKeys; i++ {
+				s.update(fmt.Sprint(i), increment)
+			}
+			assert.LessOrEqual(t, s.size(), testCase.maxKeys)
+		})
+	}
+}
+
+func TestStoreEvictIdle(t *testing.T) {
+	clock := newTestClock()
+	s := newStore[int](time.Minute, storeConfig{now: clock.now})
+	defer s.close()
+
+	noop := func(count *int, now time.Time) bool {
+		return true
+	}
+
+	s.update("a", noop)
+	clock.advance(10 * time.Second)
+	s.update("b", noop)
+	assert.Equal(t, 2, s.size())
+
+	clock.advance(30 * time.Second)
+	s.evictIdle(clock.now())
+	assert.Equal(t, 2, s.size())
+
+	clock.advance(20 * time.Second)
+	s.evictIdle(clock.now())
+	assert.Equal(t, 1, s.size())
+
+	clock.advance(10 * time.Second)
+	s.evictIdle(clock.now())
+	assert.Equal(t, 0, s.size())
+}
+
+func TestStoreBackgroundEviction(t *testing.T) {
+	clock := newTestClock()
+	s := newStore[int](time.Minute, storeConfig{cleanupInterval: 10 * time.Millisecond, now: clock.now})
+	defer s.close()
+
+	s.update("a", func(count *int, now time.Time) bool {
+		return true
+	})
+	assert.Equal(t, 1, s.size())
+
+	clock.advance(time.Minute)
+
+	assert.Eventually(t, func() bool {
+		return s.size() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	s := newStore[int](time.Minute, storeConfig{})
+	defer s.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.update(fmt.Sprint(j%10), func(count *int, now time.Time) bool {
+					*count++
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := 0; i < 10; i++ {
+		s.update(fmt.Sprint(i), func(count *int, now time.Time) bool {
+			total += *count
+			return true
+		})
+	}
+	assert.Equal(t, 8000, total)
+}
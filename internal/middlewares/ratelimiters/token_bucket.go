@@ -0,0 +1,60 @@
+package ratelimiters
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tokenBucket allows bursts of burst requests, the buckets being refilled
+// with rate tokens per second.
+type tokenBucket struct {
+	rate    float64
+	burst   int
+	buckets *store[bucket]
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, conf storeConfig) *tokenBucket {
+	// Empty buckets are full again after burst / rate seconds.
+	refill := time.Duration(float64(burst) / rate * float64(time.Second))
+	return &tokenBucket{
+		rate:    rate,
+		burst:   burst,
+		buckets: newStore[bucket](refill, conf),
+	}
+}
+
+func (t *tokenBucket) allow(key string) bool {
+	return t.buckets.update(key, func(b *bucket, now time.Time) bool {
+		if b.last.IsZero() {
+			b.tokens = float64(t.burst)
+		} else {
+			b.tokens = min(float64(t.burst), b.tokens+now.Sub(b.last).Seconds()*t.rate)
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			return false
+		}
+
+		b.tokens--
+		return true
+	})
+}
+
+func (t *tokenBucket) stop() {
+	t.buckets.close()
+}
+
+func (t *tokenBucket) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("algorithm", AlgorithmTokenBucket),
+		zap.Float64("rate", t.rate),
+		zap.Int("burst", t.burst),
+	}
+}
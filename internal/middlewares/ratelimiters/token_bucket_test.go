@@ -0,0 +1,34 @@
+package ratelimiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	clock := newTestClock()
+	limiter := newTokenBucket(10, 3, storeConfig{now: clock.now})
+	defer limiter.stop()
+
+	key := "id"
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.allow(key))
+	}
+	assert.False(t, limiter.allow(key))
+	assert.True(t, limiter.allow("other"))
+
+	// One token is refilled every 100ms.
+	clock.advance(150 * time.Millisecond)
+	assert.True(t, limiter.allow(key))
+	assert.False(t, limiter.allow(key))
+
+	// Buckets never hold more than burst tokens.
+	clock.advance(time.Second)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.allow(key))
+	}
+	assert.False(t, limiter.allow(key))
+}
@@ -0,0 +1,203 @@
+// Package policy implements the authorization expressions of endpoints.
+//
+// Expressions are CEL (https://github.com/google/cel-spec) evaluated to a
+// bool, for example:
+//
+//	"admin" in claims.roles || ("orders:write" in claims.scope.split(" ") && claims.tenant == path.tenant)
+//
+// The declared variables are:
+//
+//   - `claims`, `map(string, dyn)`: the token claims.
+//   - `path`, `map(string, string)`: the route parameters.
+//   - `headers`, `map(string, string)`: the request headers, keyed by lower
+//     case name. Values of repeated headers are joined with a comma.
+//   - `method`, `string`: the request method.
+//   - `client_ip`, `string`: the client IP.
+//
+// The CEL standard library is available with the string extensions, such as
+// `split` and `lowerAscii`. Numbers of different types can be compared, JSON
+// claim numbers being doubles.
+//
+// Expressions are compiled with the configuration, the selected path
+// parameters must be declared by the route. An expression failing to
+// evaluate, for instance because it selects a missing claim, denies the
+// request.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/ext"
+)
+
+const (
+	VarClaims   = "claims"
+	VarPath     = "path"
+	VarHeaders  = "headers"
+	VarMethod   = "method"
+	VarClientIP = "client_ip"
+)
+
+var (
+	ErrInvalidExpression = errors.New("invalid policy expression")
+	ErrUnknownPathParam  = errors.New("unknown path parameter")
+	ErrInvalidHeaderName = errors.New("header names must be lower case")
+	ErrNotBool           = errors.New("policy result is not a bool")
+)
+
+var newEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable(VarClaims, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(VarPath, cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable(VarHeaders, cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable(VarMethod, cel.StringType),
+		cel.Variable(VarClientIP, cel.StringType),
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+	)
+})
+
+// Policy is a compiled expression.
+type Policy struct {
+	expression string
+	program    cel.Program
+}
+
+// Input holds the values of the variables of an evaluation.
+type Input struct {
+	Claims     map[string]any
+	PathParams map[string]string
+	Header     http.Header
+	Method     string
+	ClientIP   string
+}
+
+// Compile type checks the expression against the declared variables. Path
+// parameters must be declared by the route path, as `:name` or `*name`.
+func Compile(expression string, routePath string) (*Policy, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	checked, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpression, issues.Err())
+	}
+
+	if !checked.OutputType().IsAssignableType(cel.BoolType) {
+		return nil, fmt.Errorf("%w: %s result", ErrInvalidExpression, checked.OutputType())
+	}
+
+	if err := checkKeys(checked, pathParams(routePath)); err != nil {
+		return nil, err
+	}
+
+	// Regular expressions of the `matches` calls are compiled here.
+	program, err := env.Program(checked, cel.EvalOptions(cel.OptOptimize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpression, err)
+	}
+
+	return &Policy{expression: expression, program: program}, nil
+}
+
+func (p *Policy) String() string {
+	return p.expression
+}
+
+// Evaluate reports whether the input satisfies the policy.
+func (p *Policy) Evaluate(input Input) (bool, error) {
+	claims := input.Claims
+	if claims == nil {
+		claims = map[string]any{}
+	}
+
+	params := input.PathParams
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	headers := make(map[string]string, len(input.Header))
+	for name, values := range input.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	result, _, err := p.program.Eval(map[string]any{
+		VarClaims:   claims,
+		VarPath:     params,
+		VarHeaders:  headers,
+		VarMethod:   input.Method,
+		VarClientIP: input.ClientIP,
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't evaluate policy: %w", err)
+	}
+
+	allowed, ok := result.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrNotBool, result.Type())
+	}
+
+	return bool(allowed), nil
+}
+
+// checkKeys rejects the constant keys selected on `path` that are not route
+// parameters, and the ones selected on `headers` that never match.
+func checkKeys(checked *cel.Ast, params map[string]bool) error {
+	var err error
+	check := func(variable string, key string) {
+		switch {
+		case err != nil:
+		case variable == VarPath && !params[key]:
+			err = fmt.Errorf("%w: %s", ErrUnknownPathParam, key)
+		case variable == VarHeaders && key != strings.ToLower(key):
+			err = fmt.Errorf("%w: %s", ErrInvalidHeaderName, key)
+		}
+	}
+
+	ast.PreOrderVisit(checked.NativeRep().Expr(), ast.NewExprVisitor(func(e ast.Expr) {
+		switch e.Kind() {
+		case ast.SelectKind:
+			sel := e.AsSelect()
+			if sel.Operand().Kind() == ast.IdentKind {
+				check(sel.Operand().AsIdent(), sel.FieldName())
+			}
+		case ast.CallKind:
+			call := e.AsCall()
+			if call.FunctionName() != operators.Index || len(call.Args()) != 2 {
+				return
+			}
+
+			variable, key := call.Args()[0], call.Args()[1]
+			if variable.Kind() != ast.IdentKind || key.Kind() != ast.LiteralKind {
+				return
+			}
+
+			if name, ok := key.AsLiteral().(types.String); ok {
+				check(variable.AsIdent(), string(name))
+			}
+		}
+	}))
+
+	return err
+}
+
+func pathParams(routePath string) map[string]bool {
+	params := map[string]bool{}
+	for _, segment := range strings.Split(routePath, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params[segment[1:]] = true
+		}
+	}
+
+	return params
+}
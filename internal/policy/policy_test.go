@@ -0,0 +1,299 @@
+package policy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		expression  string
+		routePath   string
+		expectedErr error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:       "Success case: boolean operators",
+			expression: `"admin" in claims.roles || ("orders:write" in claims.scope.split(" ") && claims.tenant == path.tenant)`,
+			routePath:  "/tenants/:tenant/orders",
+		},
+		{
+			name:       "Success case: headers, method and client ip",
+			expression: `headers["x-tenant"] == 'acme' && method != "DELETE" && client_ip.startsWith("10.")`,
+		},
+		{
+			name:       "Success case: functions",
+			expression: `has(claims.email) && claims.email.matches("@example\\.com$") && size(claims.roles) > 0`,
+		},
+		{
+			name:       "Success case: catch-all path parameter",
+			expression: `path.file.endsWith(".json")`,
+			routePath:  "/files/*file",
+		},
+		{
+			name:       "Success case: string extensions",
+			expression: `claims.name.lowerAscii() == "john"`,
+		},
+		{
+			name:       "Success case: dynamic regular expression",
+			expression: `claims.email.matches(claims.pattern)`,
+		},
+		{
+			name:        "Fail case: unknown variable",
+			shouldFail:  true,
+			expression:  `user.name == "john"`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: unknown function",
+			shouldFail:  true,
+			expression:  `claims.name.lower() == "john"`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: unknown path parameter",
+			shouldFail:  true,
+			expression:  `path.tenant == "acme"`,
+			routePath:   "/orders/:id",
+			expectedErr: ErrUnknownPathParam,
+		},
+		{
+			name:        "Fail case: unknown indexed path parameter",
+			shouldFail:  true,
+			expression:  `path["tenant"] == "acme"`,
+			routePath:   "/orders/:id",
+			expectedErr: ErrUnknownPathParam,
+		},
+		{
+			name:        "Fail case: upper case header name",
+			shouldFail:  true,
+			expression:  `headers["X-Tenant"] == "acme"`,
+			expectedErr: ErrInvalidHeaderName,
+		},
+		{
+			name:        "Fail case: not a bool",
+			shouldFail:  true,
+			expression:  `method`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: invalid regular expression",
+			shouldFail:  true,
+			expression:  `claims.email.matches("(")`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: wrong argument count",
+			shouldFail:  true,
+			expression:  `claims.name.startsWith("a", "b")`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: unbalanced parentheses",
+			shouldFail:  true,
+			expression:  `(claims.admin == true`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: trailing tokens",
+			shouldFail:  true,
+			expression:  `claims.admin == true true`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: unterminated string",
+			shouldFail:  true,
+			expression:  `claims.name == "john`,
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "Fail case: empty expression",
+			shouldFail:  true,
+			expression:  ``,
+			expectedErr: ErrInvalidExpression,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, err := Compile(testCase.expression, testCase.routePath)
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expression, policy.String())
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	type testData struct {
+		name       string
+		shouldFail bool
+		expression string
+		input      Input
+		expected   bool
+	}
+
+	input := Input{
+		Claims: map[string]any{
+			"sub":    "john",
+			"roles":  []any{"user"},
+			"groups": []string{"staff"},
+			"scope":  "orders:read orders:write",
+			"tenant": "acme",
+			"level":  float64(3),
+			"org":    map[string]any{"name": "acme"},
+		},
+		PathParams: map[string]string{"tenant": "acme"},
+		Header:     http.Header{"X-Tenant": []string{"acme"}, "Accept": []string{"text/html", "application/json"}},
+		Method:     "POST",
+		ClientIP:   "10.0.0.1",
+	}
+
+	var testCases = [...]testData{
+		{
+			name:       "Role or scope and tenant",
+			expression: `"admin" in claims.roles || ("orders:write" in claims.scope.split(" ") && claims.tenant == path.tenant)`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Missing scope",
+			expression: `"admin" in claims.roles || "orders:delete" in claims.scope.split(" ")`,
+			input:      input,
+			expected:   false,
+		},
+		{
+			name:       "String list claim",
+			expression: `"staff" in claims.groups`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Header selected by lower case name",
+			expression: `headers["x-tenant"] == path.tenant`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Repeated header",
+			expression: `headers["accept"] == "text/html,application/json"`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Macro",
+			expression: `claims.roles.exists(role, role.startsWith("us"))`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Method and client ip",
+			expression: `method in ["POST", "PUT"] && client_ip.startsWith("10.")`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Number comparison",
+			expression: `claims.level >= 3 && claims.level < 4`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Nested claim",
+			expression: `claims.org.name == "acme" && "name" in claims.org`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Negation",
+			expression: `!(claims.sub == "jane")`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Has",
+			expression: `has(claims.sub) && !has(claims.email)`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Matches",
+			expression: `claims.sub.matches("^j")`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Size",
+			expression: `size(claims.roles) == 1 && claims.sub.size() == 4`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Error absorbed by or",
+			expression: `claims.missing == "x" || claims.sub == "john"`,
+			input:      input,
+			expected:   true,
+		},
+		{
+			name:       "Error absorbed by and",
+			expression: `claims.sub == "jane" && claims.missing == "x"`,
+			input:      input,
+			expected:   false,
+		},
+		{
+			name:       "Fail case: missing claim",
+			shouldFail: true,
+			expression: `claims.email == "john@example.com"`,
+			input:      input,
+		},
+		{
+			name:       "Fail case: missing header",
+			shouldFail: true,
+			expression: `headers["x-missing"] == "x"`,
+			input:      input,
+		},
+		{
+			name:       "Fail case: not a bool",
+			shouldFail: true,
+			expression: `claims.sub`,
+			input:      input,
+		},
+		{
+			name:       "Fail case: type mismatch",
+			shouldFail: true,
+			expression: `claims.level > "3"`,
+			input:      input,
+		},
+		{
+			name:       "Fail case: no claims",
+			shouldFail: true,
+			expression: `claims.sub == "john"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, err := Compile(testCase.expression, "/tenants/:tenant")
+			assert.NoError(t, err)
+
+			result, err := policy.Evaluate(testCase.input)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.False(t, result)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, result)
+		})
+	}
+}
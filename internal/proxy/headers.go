@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hop-by-hop headers, as defined by RFC 7230 section 6.1. They are meaningful
+// for a single connection and must not be forwarded.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopByHopHeaders removes hop-by-hop headers, including the ones listed
+// in the Connection header.
+func RemoveHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// acceptsTrailers reports whether the client announced it accepts trailers,
+// the only TE value that must be forwarded.
+func acceptsTrailers(header http.Header) bool {
+	for _, value := range header.Values("Te") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(textproto.TrimString(token), "trailers") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// upstreamRequestHeader returns the headers of the request sent to the
+// upstream, the client request headers are left untouched.
+func upstreamRequestHeader(c *gin.Context, sourcePathPrefix string, forwarded *ForwardedHeaders) http.Header {
+	header := c.Request.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	RemoveHopByHopHeaders(header)
+	if acceptsTrailers(c.Request.Header) {
+		header.Set("Te", "trailers")
+	}
+
+	forwarded.apply(header, c, sourcePathPrefix)
+
+	return header
+}
+
+// ForwardedHeadersConfig configures the headers telling the upstream about
+// the client and the original request.
+type ForwardedHeadersConfig struct {
+	XForwardedFor    bool `mapstructure:"x_forwarded_for"`
+	XForwardedProto  bool `mapstructure:"x_forwarded_proto"`
+	XForwardedHost   bool `mapstructure:"x_forwarded_host"`
+	XForwardedPrefix bool `mapstructure:"x_forwarded_prefix"`
+	// RFC 7239 Forwarded header.
+	Forwarded bool `mapstructure:"forwarded"`
+	// IP addresses or CIDR ranges of the proxies in front of the gateway.
+	// Forwarding headers sent by trusted proxies are extended, the ones sent
+	// by other peers are overwritten.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+type ForwardedHeaders struct {
+	conf           ForwardedHeadersConfig
+	trustedProxies []*net.IPNet
+}
+
+func NewForwardedHeaders(conf ForwardedHeadersConfig) (*ForwardedHeaders, error) {
+	trustedProxies := []*net.IPNet{}
+	for _, proxy := range conf.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", proxy)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			trustedProxies = append(trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", proxy, err)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	return &ForwardedHeaders{
+		conf:           conf,
+		trustedProxies: trustedProxies,
+	}, nil
+}
+
+func (f *ForwardedHeaders) isTrusted(ip net.IP) bool {
+	for _, network := range f.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply sets the enabled forwarding headers on the upstream request. Headers
+// that are not enabled are forwarded as is, as are all of them when f is nil.
+func (f *ForwardedHeaders) apply(header http.Header, c *gin.Context, sourcePathPrefix string) {
+	if f == nil {
+		return
+	}
+
+	peer := peerIP(c.Request)
+	trusted := peer != nil && f.isTrusted(peer)
+
+	proto := "http"
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+
+	peerAddress := ""
+	if peer != nil {
+		peerAddress = peer.String()
+	}
+
+	if f.conf.XForwardedFor {
+		if prior := header.Values("X-Forwarded-For"); trusted && len(prior) > 0 {
+			header.Set("X-Forwarded-For", strings.Join(prior, ", ")+", "+peerAddress)
+		} else {
+			header.Set("X-Forwarded-For", peerAddress)
+		}
+	}
+
+	if f.conf.XForwardedProto && !(trusted && header.Get("X-Forwarded-Proto") != "") {
+		header.Set("X-Forwarded-Proto", proto)
+	}
+
+	if f.conf.XForwardedHost && !(trusted && header.Get("X-Forwarded-Host") != "") {
+		header.Set("X-Forwarded-Host", c.Request.Host)
+	}
+
+	if f.conf.XForwardedPrefix {
+		if prior := header.Get("X-Forwarded-Prefix"); trusted && prior != "" {
+			header.Set("X-Forwarded-Prefix", strings.TrimSuffix(prior, "/")+sourcePathPrefix)
+		} else {
+			header.Set("X-Forwarded-Prefix", sourcePathPrefix)
+		}
+	}
+
+	if f.conf.Forwarded {
+		element := fmt.Sprintf("for=%s;host=%s;proto=%s", forwardedNode(peer), quoteForwardedValue(c.Request.Host), proto)
+		if prior := header.Values("Forwarded"); trusted && len(prior) > 0 {
+			header.Set("Forwarded", strings.Join(prior, ", ")+", "+element)
+		} else {
+			header.Set("Forwarded", element)
+		}
+	}
+}
+
+// ClientIP returns the address of the client. When the peer is a trusted
+// proxy, the last untrusted address of X-Forwarded-For is returned.
+func (f *ForwardedHeaders) ClientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if peer == nil {
+		return ""
+	}
+
+	if f == nil || !f.isTrusted(peer) {
+		return peer.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+
+		peer = ip
+		if !f.isTrusted(ip) {
+			break
+		}
+	}
+
+	return peer.String()
+}
+
+func peerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
+// forwardedNode formats an IP address as a RFC 7239 node, IPv6 addresses
+// must be bracketed and quoted.
+func forwardedNode(ip net.IP) string {
+	switch {
+	case ip == nil:
+		return "unknown"
+	case ip.To4() == nil:
+		return `"[` + ip.String() + `]"`
+	default:
+		return ip.String()
+	}
+}
+
+func quoteForwardedValue(value string) string {
+	if strings.ContainsAny(value, `:[]" ,;=`) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	header := http.Header{
+		"Connection":          []string{"Keep-Alive, X-Custom"},
+		"Keep-Alive":          []string{"timeout=5"},
+		"Proxy-Authorization": []string{"Basic xxx"},
+		"Te":                  []string{"trailers"},
+		"Upgrade":             []string{"websocket"},
+		"X-Custom":            []string{"value"},
+		"X-Kept":              []string{"value"},
+	}
+
+	RemoveHopByHopHeaders(header)
+
+	assert.Equal(t, http.Header{"X-Kept": []string{"value"}}, header)
+}
+
+func TestNewForwardedHeaders(t *testing.T) {
+	_, err := NewForwardedHeaders(ForwardedHeadersConfig{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "::1"}})
+	assert.NoError(t, err)
+
+	_, err = NewForwardedHeaders(ForwardedHeadersConfig{TrustedProxies: []string{"invalid"}})
+	assert.Error(t, err)
+
+	_, err = NewForwardedHeaders(ForwardedHeadersConfig{TrustedProxies: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+}
+
+func TestUpstreamRequestHeader(t *testing.T) {
+	all := ForwardedHeadersConfig{
+		XForwardedFor:    true,
+		XForwardedProto:  true,
+		XForwardedHost:   true,
+		XForwardedPrefix: true,
+		Forwarded:        true,
+		TrustedProxies:   []string{"10.0.0.0/8"},
+	}
+
+	type testData struct {
+		name           string
+		conf           *ForwardedHeadersConfig
+		remoteAddr     string
+		tls            bool
+		header         http.Header
+		expectedHeader http.Header
+	}
+
+	var testCases = [...]testData{
+		{
+			name:       "Success case: forwarding headers are sent as is when disabled",
+			conf:       nil,
+			remoteAddr: "203.0.113.1:1234",
+			header: http.Header{
+				"Connection":      []string{"close"},
+				"X-Forwarded-For": []string{"198.51.100.1"},
+			},
+			expectedHeader: http.Header{
+				"X-Forwarded-For": []string{"198.51.100.1"},
+			},
+		},
+		{
+			name:       "Success case: trailers TE is kept",
+			conf:       nil,
+			remoteAddr: "203.0.113.1:1234",
+			header: http.Header{
+				"Te": []string{"gzip, trailers"},
+			},
+			expectedHeader: http.Header{
+				"Te": []string{"trailers"},
+			},
+		},
+		{
+			name:       "Success case: untrusted peer values are overwritten",
+			conf:       &all,
+			remoteAddr: "203.0.113.1:1234",
+			tls:        true,
+			header: http.Header{
+				"X-Forwarded-For":    []string{"198.51.100.1"},
+				"X-Forwarded-Proto":  []string{"http"},
+				"X-Forwarded-Host":   []string{"spoofed"},
+				"X-Forwarded-Prefix": []string{"/spoofed"},
+				"Forwarded":          []string{"for=198.51.100.1"},
+			},
+			expectedHeader: http.Header{
+				"X-Forwarded-For":    []string{"203.0.113.1"},
+				"X-Forwarded-Proto":  []string{"https"},
+				"X-Forwarded-Host":   []string{"gateway.test"},
+				"X-Forwarded-Prefix": []string{"/service"},
+				"Forwarded":          []string{"for=203.0.113.1;host=gateway.test;proto=https"},
+			},
+		},
+		{
+			name:       "Success case: trusted proxy values are kept",
+			conf:       &all,
+			remoteAddr: "10.0.0.2:1234",
+			header: http.Header{
+				"X-Forwarded-For":    []string{"198.51.100.1"},
+				"X-Forwarded-Proto":  []string{"https"},
+				"X-Forwarded-Host":   []string{"example.com"},
+				"X-Forwarded-Prefix": []string{"/api/"},
+				"Forwarded":          []string{"for=198.51.100.1"},
+			},
+			expectedHeader: http.Header{
+				"X-Forwarded-For":    []string{"198.51.100.1, 10.0.0.2"},
+				"X-Forwarded-Proto":  []string{"https"},
+				"X-Forwarded-Host":   []string{"example.com"},
+				"X-Forwarded-Prefix": []string{"/api/service"},
+				"Forwarded":          []string{"for=198.51.100.1, for=10.0.0.2;host=gateway.test;proto=http"},
+			},
+		},
+		{
+			name:       "Success case: IPv6 peer is quoted in Forwarded",
+			conf:       &ForwardedHeadersConfig{Forwarded: true},
+			remoteAddr: "[2001:db8::1]:1234",
+			header:     http.Header{},
+			expectedHeader: http.Header{
+				"Forwarded": []string{`for="[2001:db8::1]";host=gateway.test;proto=http`},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var forwarded *ForwardedHeaders
+			if testCase.conf != nil {
+				var err error
+				forwarded, err = NewForwardedHeaders(*testCase.conf)
+				assert.NoError(t, err)
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "http://gateway.test/service/test", nil)
+			c.Request.RemoteAddr = testCase.remoteAddr
+			c.Request.Header = testCase.header.Clone()
+			if testCase.tls {
+				c.Request.TLS = &tls.ConnectionState{}
+			}
+
+			header := upstreamRequestHeader(c, "/service", forwarded)
+			assert.Equal(t, testCase.expectedHeader, header)
+			assert.Equal(t, testCase.header, c.Request.Header)
+		})
+	}
+}
+
+func TestForwardHopByHopHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Custom") != "" || r.Header.Get("Keep-Alive") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Connection", "X-Internal")
+		w.Header().Set("X-Internal", "value")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/service/test", nil)
+	c.Request.Header.Set("Connection", "X-Custom")
+	c.Request.Header.Set("X-Custom", "value")
+	c.Request.Header.Set("Keep-Alive", "timeout=5")
+
+	Forward("/service", newTestUpstream(t, server.URL), Options{})(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Internal"))
+	assert.Empty(t, w.Header().Get("Keep-Alive"))
+}
+
+func TestClientIP(t *testing.T) {
+	forwarded, err := NewForwardedHeaders(ForwardedHeadersConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	assert.NoError(t, err)
+
+	type testData struct {
+		name       string
+		forwarded  *ForwardedHeaders
+		remoteAddr string
+		xff        string
+		expectedIP string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:       "No trusted proxies",
+			forwarded:  nil,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        "198.51.100.1",
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:       "Untrusted peer",
+			forwarded:  forwarded,
+			remoteAddr: "203.0.113.1:1234",
+			xff:        "198.51.100.1",
+			expectedIP: "203.0.113.1",
+		},
+		{
+			name:       "Trusted proxies are skipped",
+			forwarded:  forwarded,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        "192.0.2.1, 198.51.100.1, 10.0.0.2",
+			expectedIP: "198.51.100.1",
+		},
+		{
+			name:       "Trusted peer without X-Forwarded-For",
+			forwarded:  forwarded,
+			remoteAddr: "10.0.0.1:1234",
+			expectedIP: "10.0.0.1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = testCase.remoteAddr
+			if testCase.xff != "" {
+				req.Header.Set("X-Forwarded-For", testCase.xff)
+			}
+
+			assert.Equal(t, testCase.expectedIP, testCase.forwarded.ClientIP(req))
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
+	"net"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/Aloe-Corporation/logs"
 	"github.com/gin-gonic/gin"
@@ -11,73 +15,203 @@ import (
 )
 
 var (
-	client *http.Client
-	log    = logs.Get()
+	log = logs.Get()
 )
 
-func Init() {
-	client = &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+// Options holds the endpoint specific forwarding settings.
+type Options struct {
+	// Maximum duration of the whole exchange with the upstream, retries
+	// included. No limit when 0.
+	RequestTimeout time.Duration
+	// Optional, disables retries when nil.
+	Retry *RetryPolicy
+	// Optional, upgrade requests are forwarded as regular requests when nil.
+	WebSocket *WebSocket
+	// Optional, the gateway path prefix is stripped from the forwarded path
+	// when nil.
+	Rewrite *Rewriter
+	// Optional, headers are forwarded as is when nil.
+	Headers *HeaderTransformer
+	// Maximum delay before written response data is flushed to the client.
+	// Negative values flush after each write, 0 only flushes at the end of
+	// the response.
+	FlushInterval time.Duration
 }
 
-func Forward(sourcePathPrefix, targetBaseURL string) gin.HandlerFunc {
+func Forward(sourcePathPrefix string, upstream *Upstream, options Options) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		targetURL, err := buildTargetURL(c, sourcePathPrefix, targetBaseURL)
-		if err != nil {
-			log.Error("Forward failure", zap.Error(err))
-			c.AbortWithStatus(http.StatusBadGateway)
+		if options.WebSocket != nil && isUpgradeRequest(c.Request) {
+			options.WebSocket.forward(c, sourcePathPrefix, upstream, options)
 			return
 		}
 
-		if c.Request.URL.RawQuery != "" {
-			targetURL += "?" + c.Request.URL.RawQuery
-		}
-
-		req, err := http.NewRequest(c.Request.Method, targetURL, c.Request.Body)
+		path, err := options.Rewrite.upstreamPath(c, sourcePathPrefix)
 		if err != nil {
 			log.Error("Forward failure", zap.Error(err))
 			c.AbortWithStatus(http.StatusBadGateway)
 			return
 		}
 
-		req.Header = c.Request.Header
+		clientIP := upstream.ForwardedHeaders.ClientIP(c.Request)
 
-		res, err := client.Do(req)
-		if err != nil {
-			log.Error("Forward failure", zap.Error(err))
-			c.AbortWithStatus(http.StatusBadGateway)
-			return
+		ctx := c.Request.Context()
+		if options.RequestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.RequestTimeout)
+			defer cancel()
 		}
-		defer res.Body.Close()
 
-		_, err = io.Copy(c.Writer, res.Body)
-		if err != nil {
-			log.Error("Forward failure", zap.Error(err))
-			c.AbortWithStatus(http.StatusBadGateway)
+		// Requests that may be retried have their body buffered so it can
+		// be replayed, unless it is too large.
+		var body []byte
+		retry := options.Retry.appliesTo(c.Request.Method)
+		if retry && c.Request.Body != nil {
+			body, retry, err = options.Retry.bufferBody(c.Request)
+			if err != nil {
+				log.Error("Forward failure", zap.Error(err))
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+					return
+				}
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+
+			if !retry {
+				log.Debug("request body too large to be replayed, retries disabled",
+					zap.String("upstream", upstream.Name),
+				)
+			}
+		}
+
+		upstream.RetryBudget.recordRequest()
+		for attempt := 1; ; attempt++ {
+			target, err := upstream.Balancer.Next()
+			if err != nil {
+				log.Error("Forward failure", zap.Error(err), zap.String("upstream", upstream.Name))
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+
+			target.Acquire()
+			log.Debug("upstream target selected",
+				zap.String("upstream", upstream.Name),
+				zap.String("target", target.URL),
+				zap.Int("attempt", attempt),
+			)
+
+			req, err := upstream.newRequest(ctx, c, sourcePathPrefix, target.URL+path, body, retry)
+			if err != nil {
+				target.Release()
+				log.Error("Forward failure", zap.Error(err))
+				c.AbortWithStatus(http.StatusBadGateway)
+				return
+			}
+			options.Headers.transformRequest(c, req.Header, clientIP)
+
+			res, err := upstream.Client.Do(req)
+			if err != nil {
+				upstream.report(c.Request.Context(), target, 0, err)
+			} else {
+				upstream.report(c.Request.Context(), target, res.StatusCode, nil)
+			}
+
+			if retry && ctx.Err() == nil && options.Retry.shouldRetry(attempt, res, err) && upstream.RetryBudget.withdraw() {
+				if res != nil {
+					_, _ = io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+				}
+				target.Release()
+
+				backoff := options.Retry.backoff(attempt)
+				log.Warn("retrying upstream request",
+					zap.String("upstream", upstream.Name),
+					zap.String("target", target.URL),
+					zap.Int("attempt", attempt),
+					zap.Duration("backoff", backoff),
+				)
+				if !sleep(ctx, backoff) {
+					// The client went away or the request deadline passed
+					// during the backoff.
+					err := ctx.Err()
+					log.Error("Forward failure", zap.Error(err), zap.String("upstream", upstream.Name))
+					if isTimeout(err) {
+						c.AbortWithStatus(http.StatusGatewayTimeout)
+						return
+					}
+					c.AbortWithStatus(http.StatusBadGateway)
+					return
+				}
+				continue
+			}
+
+			defer target.Release()
+			if err != nil {
+				log.Error("Forward failure", zap.Error(err))
+				if isTimeout(err) {
+					c.AbortWithStatus(http.StatusGatewayTimeout)
+					return
+				}
+				c.AbortWithStatus(http.StatusBadGateway)
+				return
+			}
+			defer res.Body.Close()
+
+			options.Headers.transformResponse(c, res.Header, clientIP)
+
+			// Status and headers are sent before the body, a failure while
+			// streaming it can only interrupt the response.
+			if err := writeResponse(c, res, options.FlushInterval); err != nil {
+				log.Error("Forward failure", zap.Error(err))
+				c.Abort()
+			}
 			return
 		}
+	}
+}
+
+// newRequest builds the request sent to targetURL. When buffered is true,
+// the given body is sent instead of the client request body.
+func (u *Upstream) newRequest(ctx context.Context, c *gin.Context, sourcePathPrefix, targetURL string, body []byte, buffered bool) (*http.Request, error) {
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	var reqBody io.Reader = c.Request.Body
+	if buffered {
+		reqBody = bytes.NewReader(body)
+	}
 
-		c.Status(res.StatusCode)
-		copyResponseHeaders(res, c)
-		c.Writer.WriteHeaderNow()
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, reqBody)
+	if err != nil {
+		return nil, err
 	}
+
+	req.Header = upstreamRequestHeader(c, sourcePathPrefix, u.ForwardedHeaders)
+
+	return req, nil
 }
 
-func buildTargetURL(c *gin.Context, sourcePathPrefix, targetBaseURL string) (string, error) {
-	if !strings.HasPrefix(c.Request.URL.Path, sourcePathPrefix) {
-		return "", ErrUnknownPathPrefix
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
 	}
 
-	return targetBaseURL + strings.TrimPrefix(c.Request.URL.Path, sourcePathPrefix), nil
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 func copyResponseHeaders(res *http.Response, c *gin.Context) {
-	for key, values := range res.Header {
+	header := res.Header.Clone()
+	RemoveHopByHopHeaders(header)
+
+	// Upstream headers replace the ones already set, by the CORS middleware
+	// for instance, all their values being kept.
+	for key, values := range header {
+		c.Writer.Header().Del(key)
 		for _, value := range values {
-			c.Header(key, value)
+			c.Writer.Header().Add(key, value)
 		}
 	}
 }
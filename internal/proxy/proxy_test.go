@@ -2,13 +2,20 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"syscall"
 	"testing"
+	"time"
 
 	// model "github.com/FloRichardAloeCorp/gateway/pkg/structs"
 
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -180,26 +187,362 @@ func TestForward(t *testing.T) {
 
 			server := httptest.NewServer(testCase.handler)
 			defer server.Close()
-			Init()
-			Forward(testCase.sourcePathPrefix, server.URL)(c)
+			Forward(testCase.sourcePathPrefix, newTestUpstream(t, server.URL), Options{})(c)
 			assert.Equal(t, testCase.expectedStatusCode, w.Code)
 		})
 	}
 }
 
+func TestForwardResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "test")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/service/test", nil)
+
+	Forward("/service", newTestUpstream(t, server.URL), Options{})(c)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "test", w.Header().Get("X-Test"))
+	assert.Equal(t, "created", w.Body.String())
+}
+
 func TestForwardInvalidTargetBaseURL(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "http://locahost:8080/service", nil)
 
-	Init()
-	Forward("/service", "unknown")(c)
+	Forward("/service", newTestUpstream(t, "unknown"), Options{})(c)
 	assert.Equal(t, http.StatusBadGateway, w.Code)
 
-	Forward("/service", "\t\n")(c)
+	Forward("/service", newTestUpstream(t, "\t\n"), Options{})(c)
 	assert.Equal(t, http.StatusBadGateway, w.Code)
 }
 
+func TestForwardLoadBalancing(t *testing.T) {
+	hits := map[string]int{}
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+
+	first := newServer("first")
+	defer first.Close()
+	second := newServer("second")
+	defer second.Close()
+
+	handler := Forward("/service", newTestUpstream(t, first.URL, second.URL), Options{})
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/service/test", nil)
+		handler(c)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, 2, hits["first"])
+	assert.Equal(t, 2, hits["second"])
+}
+
+func TestForwardPassiveHealthCheck(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	hits := 0
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	upstream := newTestUpstream(t, failing.URL, healthy.URL)
+	upstream.Health = healthcheck.New("test", healthcheck.Config{
+		Passive: healthcheck.PassiveConfig{
+			Enabled:     true,
+			MaxFailures: 1,
+			Cooldown:    time.Hour,
+		},
+	}, upstream.Balancer.Targets())
+
+	handler := Forward("/service", upstream, Options{})
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/service/test", nil)
+		handler(c)
+	}
+
+	// The failing target is ejected after its first failure.
+	assert.True(t, upstream.Balancer.Targets()[0].Ejected())
+	assert.Equal(t, 3, hits)
+}
+
+func TestUpstreamReport(t *testing.T) {
+	type testData struct {
+		name            string
+		clientCanceled  bool
+		statusCode      int
+		err             error
+		expectedEjected bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "Server error",
+			statusCode:      http.StatusInternalServerError,
+			expectedEjected: true,
+		},
+		{
+			name:            "Connection refused",
+			err:             &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+			expectedEjected: true,
+		},
+		{
+			name:            "Connection closed",
+			err:             io.ErrUnexpectedEOF,
+			expectedEjected: true,
+		},
+		{
+			name:            "Request timeout",
+			err:             context.DeadlineExceeded,
+			expectedEjected: true,
+		},
+		{
+			name:       "Client error status",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name: "Canceled request",
+			err:  context.Canceled,
+		},
+		{
+			name:           "Client gone",
+			clientCanceled: true,
+			err:            &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+		},
+		{
+			name: "Request not sent",
+			err:  errors.New("net/http: invalid header field name"),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newTestUpstream(t, "http://localhost")
+			upstream.Health = healthcheck.New("test", healthcheck.Config{
+				Passive: healthcheck.PassiveConfig{
+					Enabled:     true,
+					MaxFailures: 1,
+					Cooldown:    time.Hour,
+				},
+			}, upstream.Balancer.Targets())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if testCase.clientCanceled {
+				cancel()
+			}
+
+			target := upstream.Balancer.Targets()[0]
+			upstream.report(ctx, target, testCase.statusCode, testCase.err)
+			assert.Equal(t, testCase.expectedEjected, target.Ejected())
+		})
+	}
+}
+
+func TestForwardTimeout(t *testing.T) {
+	type testData struct {
+		name               string
+		timeouts           Timeouts
+		options            Options
+		expectedStatusCode int
+	}
+
+	var testCases = [...]testData{
+		{
+			name:               "Request timeout",
+			options:            Options{RequestTimeout: 10 * time.Millisecond},
+			expectedStatusCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:               "Response header timeout",
+			timeouts:           Timeouts{ResponseHeader: 10 * time.Millisecond},
+			expectedStatusCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:               "No timeout",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/service/test", nil)
+
+			upstream := newTestUpstream(t, server.URL)
+			upstream.Client = NewClient(TransportConfig{}, testCase.timeouts)
+			Forward("/service", upstream, testCase.options)(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+		})
+	}
+}
+
+func TestForwardRetry(t *testing.T) {
+	type testData struct {
+		name               string
+		method             string
+		conf               RetryConfig
+		failures           int
+		expectedStatusCode int
+		expectedAttempts   int
+	}
+
+	var testCases = [...]testData{
+		{
+			name:               "Success after retries",
+			method:             "PUT",
+			conf:               RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			failures:           2,
+			expectedStatusCode: http.StatusOK,
+			expectedAttempts:   3,
+		},
+		{
+			name:               "Max attempts reached",
+			method:             "PUT",
+			conf:               RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+			failures:           5,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedAttempts:   2,
+		},
+		{
+			name:               "Non idempotent method not retried",
+			method:             "POST",
+			conf:               RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			failures:           1,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedAttempts:   1,
+		},
+		{
+			name:               "Non idempotent method retried when enabled",
+			method:             "POST",
+			conf:               RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryNonIdempotent: true},
+			failures:           1,
+			expectedStatusCode: http.StatusOK,
+			expectedAttempts:   2,
+		},
+		{
+			name:               "Body too large to be replayed not retried",
+			method:             "PUT",
+			conf:               RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxReplayBodySize: 2},
+			failures:           1,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedAttempts:   1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != "test" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if attempts <= testCase.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			policy, err := NewRetryPolicy(testCase.conf)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(testCase.method, "/service/test", bytes.NewReader([]byte("test")))
+
+			Forward("/service", newTestUpstream(t, server.URL), Options{Retry: policy})(c)
+			assert.Equal(t, testCase.expectedStatusCode, w.Code)
+			assert.Equal(t, testCase.expectedAttempts, attempts)
+		})
+	}
+}
+
+func TestForwardRetryDeadline(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy, err := NewRetryPolicy(RetryConfig{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/service/test", nil)
+
+	// The deadline passes during the first backoff, no other attempt is made.
+	Forward("/service", newTestUpstream(t, server.URL), Options{Retry: policy, RequestTimeout: 10 * time.Millisecond})(c)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestForwardRetryBudget(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy, err := NewRetryPolicy(RetryConfig{MaxAttempts: 100, InitialBackoff: time.Microsecond})
+	assert.NoError(t, err)
+
+	upstream := newTestUpstream(t, server.URL)
+	upstream.RetryBudget = NewRetryBudget(RetryBudgetConfig{Ratio: 0.1, MinRetriesPerSecond: 1})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/service/test", nil)
+
+	Forward("/service", upstream, Options{Retry: policy})(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	// First attempt plus the ten retries allowed by the budget minimum.
+	assert.Equal(t, 11, attempts)
+}
+
+func TestForwardNoTarget(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/service/test", nil)
+
+	Forward("/service", &Upstream{Balancer: emptyBalancer{}}, Options{})(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
 func TestCopyResponseHeaders(t *testing.T) {
 	response := &http.Response{Header: http.Header{"Test": []string{"value"}}}
 
@@ -209,4 +552,53 @@ func TestCopyResponseHeaders(t *testing.T) {
 	copyResponseHeaders(response, c)
 
 	assert.Equal(t, response.Header, w.Result().Header)
+
+	t.Run("Upstream headers replace the ones already set", func(t *testing.T) {
+		response := &http.Response{Header: http.Header{
+			"Access-Control-Allow-Origin": []string{"https://upstream.example.com"},
+			"Set-Cookie":                  []string{"a=1", "b=2"},
+		}}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Header("Access-Control-Allow-Origin", "https://gateway.example.com")
+		c.Header("Vary", "Origin")
+
+		copyResponseHeaders(response, c)
+
+		assert.Equal(t, http.Header{
+			"Access-Control-Allow-Origin": []string{"https://upstream.example.com"},
+			"Set-Cookie":                  []string{"a=1", "b=2"},
+			"Vary":                        []string{"Origin"},
+		}, w.Result().Header)
+	})
+}
+
+func newTestUpstream(t *testing.T, urls ...string) *Upstream {
+	confs := []loadbalancer.TargetConfig{}
+	for _, url := range urls {
+		confs = append(confs, loadbalancer.TargetConfig{URL: url})
+	}
+
+	targets, err := loadbalancer.NewTargets(confs)
+	assert.NoError(t, err)
+
+	balancer, err := loadbalancer.New(loadbalancer.RoundRobin, targets)
+	assert.NoError(t, err)
+
+	return &Upstream{
+		Name:     "test",
+		Balancer: balancer,
+		Client:   NewClient(TransportConfig{}, Timeouts{}),
+	}
+}
+
+type emptyBalancer struct{}
+
+func (emptyBalancer) Next() (*loadbalancer.Target, error) {
+	return nil, loadbalancer.ErrNoTarget
+}
+
+func (emptyBalancer) Targets() []*loadbalancer.Target {
+	return nil
 }
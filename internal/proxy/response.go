@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeResponse writes the status and headers of the upstream response, then
+// streams its body and forwards its trailers.
+//
+// A negative flush interval flushes after each write, 0 disables periodic
+// flushes. Server-Sent Events and bodies of unknown length are always
+// flushed immediately.
+func writeResponse(c *gin.Context, res *http.Response, flushInterval time.Duration) error {
+	copyResponseHeaders(res, c)
+
+	if len(res.Trailer) > 0 {
+		trailers := make([]string, 0, len(res.Trailer))
+		for key := range res.Trailer {
+			trailers = append(trailers, key)
+		}
+		c.Writer.Header().Add("Trailer", strings.Join(trailers, ", "))
+	}
+
+	c.Status(res.StatusCode)
+	c.Writer.WriteHeaderNow()
+
+	if isStreamingResponse(res) {
+		flushInterval = -1
+	}
+
+	writer := newFlushWriter(c.Writer, flushInterval)
+	_, err := io.Copy(writer, res.Body)
+	writer.stop()
+	if err != nil {
+		return err
+	}
+
+	for key, values := range res.Trailer {
+		for _, value := range values {
+			c.Writer.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+
+	return nil
+}
+
+func isStreamingResponse(res *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream" || res.ContentLength == -1
+}
+
+// flushWriter flushes the written data at most flushInterval after it was
+// written.
+type flushWriter struct {
+	dst           gin.ResponseWriter
+	flushInterval time.Duration
+
+	timer   *time.Timer
+	pending bool
+	mu      sync.Mutex
+}
+
+func newFlushWriter(dst gin.ResponseWriter, flushInterval time.Duration) *flushWriter {
+	return &flushWriter{
+		dst:           dst,
+		flushInterval: flushInterval,
+	}
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.dst.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if w.flushInterval < 0 {
+		w.dst.Flush()
+		return n, nil
+	}
+
+	if w.flushInterval == 0 || w.pending {
+		return n, nil
+	}
+
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.flushInterval, w.delayedFlush)
+	} else {
+		w.timer.Reset(w.flushInterval)
+	}
+	w.pending = true
+
+	return n, nil
+}
+
+func (w *flushWriter) delayedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.pending {
+		return
+	}
+
+	w.dst.Flush()
+	w.pending = false
+}
+
+func (w *flushWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = false
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteResponse(t *testing.T) {
+	res := &http.Response{
+		StatusCode: http.StatusCreated,
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+			"Set-Cookie":   []string{"a=1", "b=2"},
+		},
+		Body:          io.NopCloser(strings.NewReader(`{"id":1}`)),
+		ContentLength: 8,
+		Trailer: http.Header{
+			"Checksum": []string{"abc"},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	err := writeResponse(c, res, 0)
+	assert.NoError(t, err)
+
+	result := w.Result()
+	assert.Equal(t, http.StatusCreated, result.StatusCode)
+	assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"a=1", "b=2"}, result.Header.Values("Set-Cookie"))
+	assert.Equal(t, "Checksum", result.Header.Get("Trailer"))
+	assert.Equal(t, "abc", result.Trailer.Get("Checksum"))
+	assert.Equal(t, `{"id":1}`, w.Body.String())
+}
+
+func TestIsStreamingResponse(t *testing.T) {
+	type testData struct {
+		name        string
+		res         *http.Response
+		expectedRes bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Server-Sent Events",
+			res: &http.Response{
+				Header:        http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}},
+				ContentLength: 10,
+			},
+			expectedRes: true,
+		},
+		{
+			name: "Unknown length",
+			res: &http.Response{
+				Header:        http.Header{"Content-Type": []string{"application/json"}},
+				ContentLength: -1,
+			},
+			expectedRes: true,
+		},
+		{
+			name: "Known length",
+			res: &http.Response{
+				Header:        http.Header{"Content-Type": []string{"application/json"}},
+				ContentLength: 10,
+			},
+			expectedRes: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedRes, isStreamingResponse(testCase.res))
+		})
+	}
+}
+
+func TestFlushWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	writer := newFlushWriter(c.Writer, 20*time.Millisecond)
+	_, err := writer.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.False(t, w.Flushed)
+
+	assert.Eventually(t, func() bool {
+		writer.mu.Lock()
+		defer writer.mu.Unlock()
+		return w.Flushed
+	}, time.Second, 5*time.Millisecond)
+	writer.stop()
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	writer = newFlushWriter(c.Writer, -1)
+	_, err = writer.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.True(t, w.Flushed)
+	writer.stop()
+}
+
+func TestForwardServerSentEvents(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-release
+		_, _ = w.Write([]byte("data: second\n\n"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	router := gin.New()
+	router.GET("/service/events", Forward("/service", newTestUpstream(t, backend.URL), Options{}))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	res, err := http.Get(gateway.URL + "/service/events")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// The first event is received while the upstream response is not over.
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+}
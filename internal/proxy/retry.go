@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	RetryOnConnectionRefused = "connection_refused"
+	RetryOnConnectionReset   = "connection_reset"
+	RetryOnTimeout           = "timeout"
+
+	defaultMaxAttempts       = 3
+	defaultInitialBackoff    = 50 * time.Millisecond
+	defaultMaxBackoff        = time.Second
+	defaultMaxReplayBodySize = 1 << 20
+)
+
+var (
+	ErrUnknownRetryError = errors.New("unknown retry error class")
+
+	defaultRetryOnStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryOnErrors = []string{RetryOnConnectionRefused, RetryOnConnectionReset}
+
+	idempotentMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+		http.MethodPut,
+		http.MethodDelete,
+	}
+)
+
+type RetryConfig struct {
+	// Maximum number of attempts, the first one included. Defaults to 3.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Upstream status codes triggering a retry. Defaults to 502, 503 and 504.
+	RetryOnStatus []int `mapstructure:"retry_on_status"`
+	// Error classes triggering a retry, among connection_refused,
+	// connection_reset and timeout. Defaults to connection_refused and
+	// connection_reset.
+	RetryOnErrors  []string      `mapstructure:"retry_on_errors"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// Allow retrying POST, PATCH and other non idempotent requests.
+	RetryNonIdempotent bool `mapstructure:"retry_non_idempotent"`
+	// Maximum size in bytes of the request bodies buffered to be replayed.
+	// Larger bodies are streamed and their requests are not retried.
+	// Defaults to 1 MiB.
+	MaxReplayBodySize int64 `mapstructure:"max_replay_body_size"`
+}
+
+type RetryPolicy struct {
+	maxAttempts        int
+	retryOnStatus      []int
+	retryOnErrors      []string
+	initialBackoff     time.Duration
+	maxBackoff         time.Duration
+	retryNonIdempotent bool
+	maxReplayBodySize  int64
+}
+
+func NewRetryPolicy(conf RetryConfig) (*RetryPolicy, error) {
+	policy := &RetryPolicy{
+		maxAttempts:        conf.MaxAttempts,
+		retryOnStatus:      conf.RetryOnStatus,
+		retryOnErrors:      conf.RetryOnErrors,
+		initialBackoff:     conf.InitialBackoff,
+		maxBackoff:         conf.MaxBackoff,
+		retryNonIdempotent: conf.RetryNonIdempotent,
+		maxReplayBodySize:  conf.MaxReplayBodySize,
+	}
+
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultMaxAttempts
+	}
+
+	if len(policy.retryOnStatus) == 0 {
+		policy.retryOnStatus = defaultRetryOnStatus
+	}
+
+	if len(policy.retryOnErrors) == 0 {
+		policy.retryOnErrors = defaultRetryOnErrors
+	}
+
+	for _, class := range policy.retryOnErrors {
+		switch class {
+		case RetryOnConnectionRefused, RetryOnConnectionReset, RetryOnTimeout:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRetryError, class)
+		}
+	}
+
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultInitialBackoff
+	}
+
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultMaxBackoff
+	}
+
+	if policy.maxReplayBodySize <= 0 {
+		policy.maxReplayBodySize = defaultMaxReplayBodySize
+	}
+
+	return policy, nil
+}
+
+// appliesTo reports whether requests with the given method can be retried.
+func (p *RetryPolicy) appliesTo(method string) bool {
+	if p == nil || p.maxAttempts <= 1 {
+		return false
+	}
+
+	return p.retryNonIdempotent || slices.Contains(idempotentMethods, method)
+}
+
+// bufferBody reads the request body so it can be replayed. Bodies larger
+// than the replay limit are not buffered, ok is false and the request body
+// is left to be streamed, the part already read included.
+func (p *RetryPolicy) bufferBody(r *http.Request) (body []byte, ok bool, err error) {
+	body, err = io.ReadAll(io.LimitReader(r.Body, p.maxReplayBodySize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > p.maxReplayBodySize {
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		return nil, false, nil
+	}
+
+	return body, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (p *RetryPolicy) shouldRetry(attempt int, res *http.Response, err error) bool {
+	if attempt >= p.maxAttempts {
+		return false
+	}
+
+	if err == nil {
+		return slices.Contains(p.retryOnStatus, res.StatusCode)
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return slices.Contains(p.retryOnErrors, RetryOnConnectionRefused)
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return slices.Contains(p.retryOnErrors, RetryOnConnectionReset)
+	case isTimeout(err):
+		return slices.Contains(p.retryOnErrors, RetryOnTimeout)
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the next attempt: an exponential backoff
+// with full jitter.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.maxBackoff
+	if shift := attempt - 1; shift < 32 {
+		if exp := p.initialBackoff << shift; exp > 0 && exp < p.maxBackoff {
+			backoff = exp
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// sleep waits for the given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBudgetRatio               = 0.2
+	defaultBudgetMinRetriesPerSecond = 10
+
+	budgetBuckets = 10
+)
+
+// RetryBudgetConfig caps the retries of an upstream so a failing service
+// doesn't receive an amplified load.
+type RetryBudgetConfig struct {
+	// Maximum ratio of retries over requests. Defaults to 0.2.
+	Ratio float64 `mapstructure:"ratio"`
+	// Retries always allowed regardless of the ratio. Defaults to 10.
+	MinRetriesPerSecond int `mapstructure:"min_retries_per_second"`
+}
+
+// RetryBudget counts requests and retries over the last ten seconds.
+type RetryBudget struct {
+	ratio               float64
+	minRetriesPerSecond int
+
+	requests [budgetBuckets]int
+	retries  [budgetBuckets]int
+	current  int64
+	mu       sync.Mutex
+}
+
+func NewRetryBudget(conf RetryBudgetConfig) *RetryBudget {
+	if conf.Ratio <= 0 {
+		conf.Ratio = defaultBudgetRatio
+	}
+
+	if conf.MinRetriesPerSecond <= 0 {
+		conf.MinRetriesPerSecond = defaultBudgetMinRetriesPerSecond
+	}
+
+	return &RetryBudget{
+		ratio:               conf.Ratio,
+		minRetriesPerSecond: conf.MinRetriesPerSecond,
+		current:             time.Now().Unix(),
+	}
+}
+
+func (b *RetryBudget) recordRequest() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(time.Now().Unix())
+	b.requests[b.current%budgetBuckets]++
+}
+
+// withdraw records a retry if the budget allows it. A nil budget allows
+// every retry.
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(time.Now().Unix())
+
+	requests, retries := 0, 0
+	for i := 0; i < budgetBuckets; i++ {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+
+	allowed := float64(b.minRetriesPerSecond*budgetBuckets) + b.ratio*float64(requests)
+	if float64(retries+1) > allowed {
+		return false
+	}
+
+	b.retries[b.current%budgetBuckets]++
+	return true
+}
+
+// rotate clears the buckets of the seconds elapsed since the last call.
+func (b *RetryBudget) rotate(now int64) {
+	elapsed := now - b.current
+	if elapsed <= 0 {
+		return
+	}
+
+	if elapsed > budgetBuckets {
+		elapsed = budgetBuckets
+	}
+
+	for i := int64(1); i <= elapsed; i++ {
+		bucket := (b.current + i) % budgetBuckets
+		b.requests[bucket] = 0
+		b.retries[bucket] = 0
+	}
+	b.current = now
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudgetWithdraw(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetConfig{
+		Ratio:               0.5,
+		MinRetriesPerSecond: 1,
+	})
+
+	// The minimum allows one retry per second over the ten seconds window.
+	for i := 0; i < budgetBuckets; i++ {
+		assert.True(t, budget.withdraw())
+	}
+	assert.False(t, budget.withdraw())
+
+	// Each request adds half a retry to the budget.
+	budget.recordRequest()
+	budget.recordRequest()
+	assert.True(t, budget.withdraw())
+	assert.False(t, budget.withdraw())
+
+	var nilBudget *RetryBudget
+	nilBudget.recordRequest()
+	assert.True(t, nilBudget.withdraw())
+}
+
+func TestRetryBudgetRotate(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetConfig{
+		Ratio:               0.5,
+		MinRetriesPerSecond: 1,
+	})
+
+	for i := 0; i < budgetBuckets; i++ {
+		assert.True(t, budget.withdraw())
+	}
+	assert.False(t, budget.withdraw())
+
+	budget.rotate(time.Now().Unix() + budgetBuckets)
+	assert.True(t, budget.withdraw())
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	type testData struct {
+		name           string
+		conf           RetryConfig
+		expectedPolicy *RetryPolicy
+		expectedErr    error
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Defaults",
+			conf: RetryConfig{},
+			expectedPolicy: &RetryPolicy{
+				maxAttempts:       defaultMaxAttempts,
+				retryOnStatus:     defaultRetryOnStatus,
+				retryOnErrors:     defaultRetryOnErrors,
+				initialBackoff:    defaultInitialBackoff,
+				maxBackoff:        defaultMaxBackoff,
+				maxReplayBodySize: defaultMaxReplayBodySize,
+			},
+		},
+		{
+			name: "Custom values",
+			conf: RetryConfig{
+				MaxAttempts:        5,
+				RetryOnStatus:      []int{500},
+				RetryOnErrors:      []string{RetryOnTimeout},
+				InitialBackoff:     time.Millisecond,
+				MaxBackoff:         time.Minute,
+				RetryNonIdempotent: true,
+				MaxReplayBodySize:  1024,
+			},
+			expectedPolicy: &RetryPolicy{
+				maxAttempts:        5,
+				retryOnStatus:      []int{500},
+				retryOnErrors:      []string{RetryOnTimeout},
+				initialBackoff:     time.Millisecond,
+				maxBackoff:         time.Minute,
+				retryNonIdempotent: true,
+				maxReplayBodySize:  1024,
+			},
+		},
+		{
+			name: "Fail case: unknown error class",
+			conf: RetryConfig{
+				RetryOnErrors: []string{"unknown"},
+			},
+			expectedErr: ErrUnknownRetryError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, err := NewRetryPolicy(testCase.conf)
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedPolicy, policy)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyAppliesTo(t *testing.T) {
+	policy, err := NewRetryPolicy(RetryConfig{})
+	assert.NoError(t, err)
+
+	assert.True(t, policy.appliesTo(http.MethodGet))
+	assert.True(t, policy.appliesTo(http.MethodPut))
+	assert.False(t, policy.appliesTo(http.MethodPost))
+	assert.False(t, policy.appliesTo(http.MethodPatch))
+
+	policy, err = NewRetryPolicy(RetryConfig{RetryNonIdempotent: true})
+	assert.NoError(t, err)
+	assert.True(t, policy.appliesTo(http.MethodPost))
+
+	policy, err = NewRetryPolicy(RetryConfig{MaxAttempts: 1})
+	assert.NoError(t, err)
+	assert.False(t, policy.appliesTo(http.MethodGet))
+
+	var nilPolicy *RetryPolicy
+	assert.False(t, nilPolicy.appliesTo(http.MethodGet))
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	type testData struct {
+		name        string
+		attempt     int
+		res         *http.Response
+		err         error
+		expectedRes bool
+	}
+
+	policy, err := NewRetryPolicy(RetryConfig{})
+	assert.NoError(t, err)
+
+	var testCases = [...]testData{
+		{
+			name:        "Retryable status",
+			attempt:     1,
+			res:         &http.Response{StatusCode: http.StatusBadGateway},
+			expectedRes: true,
+		},
+		{
+			name:        "Non retryable status",
+			attempt:     1,
+			res:         &http.Response{StatusCode: http.StatusInternalServerError},
+			expectedRes: false,
+		},
+		{
+			name:        "Max attempts reached",
+			attempt:     3,
+			res:         &http.Response{StatusCode: http.StatusBadGateway},
+			expectedRes: false,
+		},
+		{
+			name:        "Connection refused",
+			attempt:     1,
+			err:         syscall.ECONNREFUSED,
+			expectedRes: true,
+		},
+		{
+			name:        "Connection reset",
+			attempt:     1,
+			err:         syscall.ECONNRESET,
+			expectedRes: true,
+		},
+		{
+			name:        "Timeout not retried by default",
+			attempt:     1,
+			err:         context.DeadlineExceeded,
+			expectedRes: false,
+		},
+		{
+			name:        "Unknown error",
+			attempt:     1,
+			err:         errors.New("unknown"),
+			expectedRes: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedRes, policy.shouldRetry(testCase.attempt, testCase.res, testCase.err))
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy, err := NewRetryPolicy(RetryConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, policy.backoff(1), 10*time.Millisecond)
+		assert.LessOrEqual(t, policy.backoff(2), 20*time.Millisecond)
+		assert.LessOrEqual(t, policy.backoff(10), 40*time.Millisecond)
+		assert.LessOrEqual(t, policy.backoff(100), 40*time.Millisecond)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	assert.True(t, sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, sleep(ctx, time.Hour))
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrConflictingRewrite = errors.New("rewrite path and regex are mutually exclusive")
+	ErrUnknownPathParam   = errors.New("unknown path parameter")
+)
+
+var pathParamPlaceholder = regexp.MustCompile(`{([^{}/]+)}`)
+
+// RewriteConfig configures how the upstream path is built from the client
+// request path. By default, the gateway path prefix is stripped and the rest
+// of the path is forwarded.
+type RewriteConfig struct {
+	// Upstream path template, `{name}` placeholders are replaced by the
+	// value of the `:name` or `*name` path parameter.
+	Path string `mapstructure:"path"`
+	// Regular expression replaced in the forwarded path by Replacement,
+	// which can reference capture groups as `$1` or `${name}`.
+	Regex       string `mapstructure:"regex"`
+	Replacement string `mapstructure:"replacement"`
+	// Keep the gateway path prefix in the forwarded path. Ignored when Path
+	// is set.
+	KeepPrefix bool `mapstructure:"keep_prefix"`
+}
+
+type Rewriter struct {
+	path        string
+	regex       *regexp.Regexp
+	replacement string
+	keepPrefix  bool
+}
+
+// NewRewriter validates the rewrite configuration of the endpoint served on
+// routePath.
+func NewRewriter(conf RewriteConfig, routePath string) (*Rewriter, error) {
+	if conf.Path != "" && conf.Regex != "" {
+		return nil, ErrConflictingRewrite
+	}
+
+	for _, match := range pathParamPlaceholder.FindAllStringSubmatch(conf.Path, -1) {
+		if !hasPathParam(routePath, match[1]) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPathParam, match[1])
+		}
+	}
+
+	rewriter := &Rewriter{
+		path:        conf.Path,
+		replacement: conf.Replacement,
+		keepPrefix:  conf.KeepPrefix,
+	}
+
+	if conf.Regex != "" {
+		regex, err := regexp.Compile(conf.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite regex: %w", err)
+		}
+		rewriter.regex = regex
+	}
+
+	return rewriter, nil
+}
+
+func hasPathParam(routePath, name string) bool {
+	for _, segment := range strings.Split(routePath, "/") {
+		if segment == ":"+name || segment == "*"+name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// upstreamPath returns the path forwarded to the upstream. The prefix is
+// stripped when r is nil.
+func (r *Rewriter) upstreamPath(c *gin.Context, sourcePathPrefix string) (string, error) {
+	if !strings.HasPrefix(c.Request.URL.Path, sourcePathPrefix) {
+		return "", ErrUnknownPathPrefix
+	}
+
+	if r == nil {
+		return strings.TrimPrefix(c.Request.URL.Path, sourcePathPrefix), nil
+	}
+
+	if r.path != "" {
+		return pathParamPlaceholder.ReplaceAllStringFunc(r.path, func(placeholder string) string {
+			return escapePathParam(c.Param(placeholder[1 : len(placeholder)-1]))
+		}), nil
+	}
+
+	path := c.Request.URL.Path
+	if !r.keepPrefix {
+		path = strings.TrimPrefix(path, sourcePathPrefix)
+	}
+
+	if r.regex != nil {
+		path = r.regex.ReplaceAllString(path, r.replacement)
+	}
+
+	return path, nil
+}
+
+// escapePathParam escapes each segment of a path parameter, catch-all
+// parameters keep their slashes.
+func escapePathParam(value string) string {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
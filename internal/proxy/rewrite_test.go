@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRewriter(t *testing.T) {
+	type testData struct {
+		name       string
+		conf       RewriteConfig
+		routePath  string
+		shouldFail bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:      "Success case: path template",
+			conf:      RewriteConfig{Path: "/v2/accounts/{id}/files{path}"},
+			routePath: "/users/:id/*path",
+		},
+		{
+			name:      "Success case: regex",
+			conf:      RewriteConfig{Regex: "^/users/(.*)$", Replacement: "/accounts/$1"},
+			routePath: "/users/:id",
+		},
+		{
+			name:       "Fail case: unknown path parameter",
+			conf:       RewriteConfig{Path: "/v2/accounts/{account}"},
+			routePath:  "/users/:id",
+			shouldFail: true,
+		},
+		{
+			name:       "Fail case: invalid regex",
+			conf:       RewriteConfig{Regex: "("},
+			routePath:  "/users/:id",
+			shouldFail: true,
+		},
+		{
+			name:       "Fail case: path and regex",
+			conf:       RewriteConfig{Path: "/v2", Regex: "^/users"},
+			routePath:  "/users/:id",
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := NewRewriter(testCase.conf, testCase.routePath)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestForwardRewrite(t *testing.T) {
+	type testData struct {
+		name         string
+		conf         *RewriteConfig
+		route        string
+		path         string
+		expectedPath string
+	}
+
+	var testCases = [...]testData{
+		{
+			name:         "Prefix is stripped by default",
+			conf:         nil,
+			route:        "/service/users/:id",
+			path:         "/service/users/42",
+			expectedPath: "/users/42",
+		},
+		{
+			name:         "Prefix is kept",
+			conf:         &RewriteConfig{KeepPrefix: true},
+			route:        "/service/users/:id",
+			path:         "/service/users/42",
+			expectedPath: "/service/users/42",
+		},
+		{
+			name:         "Path template",
+			conf:         &RewriteConfig{Path: "/v2/accounts/{id}/profile"},
+			route:        "/service/users/:id",
+			path:         "/service/users/42",
+			expectedPath: "/v2/accounts/42/profile",
+		},
+		{
+			name:         "Path template with catch-all parameter",
+			conf:         &RewriteConfig{Path: "/v2/accounts/{id}/files{path}"},
+			route:        "/service/users/:id/*path",
+			path:         "/service/users/42/a/b",
+			expectedPath: "/v2/accounts/42/files/a/b",
+		},
+		{
+			name:         "Regex capture groups",
+			conf:         &RewriteConfig{Regex: "^/users/(?P<id>[^/]+)$", Replacement: "/accounts/${id}"},
+			route:        "/service/users/:id",
+			path:         "/service/users/42",
+			expectedPath: "/accounts/42",
+		},
+		{
+			name:         "Regex with prefix kept",
+			conf:         &RewriteConfig{Regex: "^/service/", Replacement: "/internal/", KeepPrefix: true},
+			route:        "/service/users/:id",
+			path:         "/service/users/42",
+			expectedPath: "/internal/users/42",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			receivedPath := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				receivedPath = r.URL.Path
+			}))
+			defer server.Close()
+
+			options := Options{}
+			if testCase.conf != nil {
+				rewriter, err := NewRewriter(*testCase.conf, testCase.route)
+				assert.NoError(t, err)
+				options.Rewrite = rewriter
+			}
+
+			router := gin.New()
+			router.GET(testCase.route, Forward("/service", newTestUpstream(t, server.URL), options))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", testCase.path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, testCase.expectedPath, receivedPath)
+		})
+	}
+}
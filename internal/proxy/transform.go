@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrUnknownTemplateVariable = errors.New("unknown template variable")
+	ErrConflictingRename       = errors.New("conflicting header renames")
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+	// Context key of the request ID, generated when the client doesn't send
+	// one.
+	requestIDKey = "request_id"
+)
+
+// HeaderRulesConfig lists the transformations applied to headers, in this
+// order: remove, rename, set and add.
+//
+// Values are templates, `${path.<name>}`, `${query.<name>}`, `${client_ip}`
+// and `${request_id}` are replaced by the path parameter, the query
+// parameter, the client IP address and the X-Request-Id header, generated
+// when missing. `$$` produces a literal `$`.
+type HeaderRulesConfig struct {
+	Add    map[string]string `mapstructure:"add"`
+	Set    map[string]string `mapstructure:"set"`
+	Remove []string          `mapstructure:"remove"`
+	// New header names by current header names. A header can't be renamed
+	// to a renamed header or to the new name of another header.
+	Rename map[string]string `mapstructure:"rename"`
+}
+
+func (c HeaderRulesConfig) isEmpty() bool {
+	return len(c.Add) == 0 && len(c.Set) == 0 && len(c.Remove) == 0 && len(c.Rename) == 0
+}
+
+type HeadersConfig struct {
+	// Applied to the request sent to the upstream.
+	Request HeaderRulesConfig `mapstructure:"request"`
+	// Applied to the response sent to the client.
+	Response HeaderRulesConfig `mapstructure:"response"`
+}
+
+type HeaderTransformer struct {
+	request  []HeaderRulesConfig
+	response []HeaderRulesConfig
+}
+
+// NewHeaderTransformer validates the header transformations of the endpoint
+// served on routePath, they are applied in the given order. It returns nil
+// when there is nothing to transform.
+func NewHeaderTransformer(routePath string, confs ...HeadersConfig) (*HeaderTransformer, error) {
+	transformer := &HeaderTransformer{}
+	for _, conf := range confs {
+		for _, rules := range []HeaderRulesConfig{conf.Request, conf.Response} {
+			if err := validateRenames(rules.Rename); err != nil {
+				return nil, err
+			}
+
+			for _, templates := range []map[string]string{rules.Add, rules.Set} {
+				for name, template := range templates {
+					if err := validateTemplate(template, routePath); err != nil {
+						return nil, fmt.Errorf("header %s: %w", name, err)
+					}
+				}
+			}
+		}
+
+		if !conf.Request.isEmpty() {
+			transformer.request = append(transformer.request, conf.Request)
+		}
+		if !conf.Response.isEmpty() {
+			transformer.response = append(transformer.response, conf.Response)
+		}
+	}
+
+	if len(transformer.request) == 0 && len(transformer.response) == 0 {
+		return nil, nil
+	}
+
+	return transformer, nil
+}
+
+// validateRenames rejects the renames whose result would depend on the
+// order they are applied in.
+func validateRenames(renames map[string]string) error {
+	sources := map[string]bool{}
+	for name := range renames {
+		name = http.CanonicalHeaderKey(name)
+		if sources[name] {
+			return fmt.Errorf("%w: %s renamed twice", ErrConflictingRename, name)
+		}
+		sources[name] = true
+	}
+
+	targets := map[string]bool{}
+	for name, newName := range renames {
+		name, newName = http.CanonicalHeaderKey(name), http.CanonicalHeaderKey(newName)
+		if name == newName {
+			continue
+		}
+
+		if sources[newName] {
+			return fmt.Errorf("%w: %s renamed to the renamed %s", ErrConflictingRename, name, newName)
+		}
+		if targets[newName] {
+			return fmt.Errorf("%w: several headers renamed to %s", ErrConflictingRename, newName)
+		}
+		targets[newName] = true
+	}
+
+	return nil
+}
+
+func validateTemplate(template, routePath string) error {
+	var err error
+	os.Expand(template, func(variable string) string {
+		switch {
+		case variable == "$", variable == "client_ip", variable == "request_id":
+		case strings.HasPrefix(variable, "query.") && len(variable) > len("query."):
+		case strings.HasPrefix(variable, "path.") && hasPathParam(routePath, strings.TrimPrefix(variable, "path.")):
+		default:
+			err = fmt.Errorf("%w: %s", ErrUnknownTemplateVariable, variable)
+		}
+		return ""
+	})
+
+	return err
+}
+
+func (t *HeaderTransformer) transformRequest(c *gin.Context, header http.Header, clientIP string) {
+	if t == nil {
+		return
+	}
+
+	for _, rules := range t.request {
+		applyHeaderRules(c, header, rules, clientIP)
+	}
+}
+
+func (t *HeaderTransformer) transformResponse(c *gin.Context, header http.Header, clientIP string) {
+	if t == nil {
+		return
+	}
+
+	for _, rules := range t.response {
+		applyHeaderRules(c, header, rules, clientIP)
+	}
+}
+
+func applyHeaderRules(c *gin.Context, header http.Header, rules HeaderRulesConfig, clientIP string) {
+	expand := func(template string) string {
+		return os.Expand(template, func(variable string) string {
+			switch {
+			case variable == "$":
+				return "$"
+			case variable == "client_ip":
+				return clientIP
+			case variable == "request_id":
+				return requestID(c)
+			case strings.HasPrefix(variable, "query."):
+				return c.Query(strings.TrimPrefix(variable, "query."))
+			case strings.HasPrefix(variable, "path."):
+				return c.Param(strings.TrimPrefix(variable, "path."))
+			default:
+				return ""
+			}
+		})
+	}
+
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+
+	for name, newName := range rules.Rename {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		header.Del(name)
+		for _, value := range values {
+			header.Add(newName, value)
+		}
+	}
+
+	for name, template := range rules.Set {
+		header.Set(name, expand(template))
+	}
+
+	for name, template := range rules.Add {
+		header.Add(name, expand(template))
+	}
+}
+
+// requestID returns the X-Request-Id header of the client request. When
+// missing, an ID is generated once per request.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+
+	id := c.Request.Header.Get(requestIDHeader)
+	if id == "" {
+		buf := make([]byte, 16)
+		_, _ = rand.Read(buf)
+		id = hex.EncodeToString(buf)
+	}
+	c.Set(requestIDKey, id)
+
+	return id
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHeaderTransformer(t *testing.T) {
+	type testData struct {
+		name        string
+		confs       []HeadersConfig
+		expectedNil bool
+		shouldFail  bool
+		expectedErr error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:        "Success case: nothing to transform",
+			confs:       []HeadersConfig{{}, {}},
+			expectedNil: true,
+		},
+		{
+			name: "Success case: valid templates",
+			confs: []HeadersConfig{{
+				Request: HeaderRulesConfig{
+					Set: map[string]string{"X-User": "${path.id} ${query.page} ${client_ip} ${request_id} $$"},
+				},
+			}},
+		},
+		{
+			name: "Fail case: unknown path parameter",
+			confs: []HeadersConfig{{
+				Response: HeaderRulesConfig{
+					Add: map[string]string{"X-User": "${path.user}"},
+				},
+			}},
+			shouldFail: true,
+		},
+		{
+			name: "Success case: independent renames",
+			confs: []HeadersConfig{{
+				Request: HeaderRulesConfig{
+					Rename: map[string]string{"X-A": "X-B", "X-C": "X-D", "X-E": "x-e"},
+				},
+			}},
+		},
+		{
+			name: "Fail case: chained renames",
+			confs: []HeadersConfig{{
+				Request: HeaderRulesConfig{
+					Rename: map[string]string{"X-A": "X-B", "X-B": "X-C"},
+				},
+			}},
+			shouldFail:  true,
+			expectedErr: ErrConflictingRename,
+		},
+		{
+			name: "Fail case: colliding renames",
+			confs: []HeadersConfig{{
+				Response: HeaderRulesConfig{
+					Rename: map[string]string{"X-A": "X-C", "X-B": "x-c"},
+				},
+			}},
+			shouldFail:  true,
+			expectedErr: ErrConflictingRename,
+		},
+		{
+			name: "Fail case: header renamed twice",
+			confs: []HeadersConfig{{
+				Request: HeaderRulesConfig{
+					Rename: map[string]string{"X-A": "X-B", "x-a": "X-C"},
+				},
+			}},
+			shouldFail:  true,
+			expectedErr: ErrConflictingRename,
+		},
+		{
+			name: "Fail case: unknown variable",
+			confs: []HeadersConfig{{
+				Request: HeaderRulesConfig{
+					Set: map[string]string{"X-User": "${user}"},
+				},
+			}},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			transformer, err := NewHeaderTransformer("/users/:id", testCase.confs...)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				if testCase.expectedErr != nil {
+					assert.ErrorIs(t, err, testCase.expectedErr)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedNil, transformer == nil)
+		})
+	}
+}
+
+func TestForwardHeaderTransformations(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set("Server", "backend")
+		w.Header().Set("X-Powered-By", "backend")
+		w.Header().Set("X-Internal-Id", "1")
+	}))
+	defer server.Close()
+
+	transformer, err := NewHeaderTransformer("/service/users/:id",
+		HeadersConfig{
+			Request: HeaderRulesConfig{
+				Set:    map[string]string{"X-Api-Key": "secret"},
+				Remove: []string{"Cookie"},
+			},
+			Response: HeaderRulesConfig{
+				Remove: []string{"Server", "X-Powered-By"},
+			},
+		},
+		HeadersConfig{
+			Request: HeaderRulesConfig{
+				Add:    map[string]string{"X-Context": "${path.id}/${query.page}/${client_ip}/${request_id}"},
+				Rename: map[string]string{"X-Client-Token": "X-Token"},
+			},
+			Response: HeaderRulesConfig{
+				Rename: map[string]string{"X-Internal-Id": "X-Id"},
+				Set:    map[string]string{"X-Request-Id": "${request_id}"},
+			},
+		},
+	)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/service/users/:id", Forward("/service", newTestUpstream(t, server.URL), Options{Headers: transformer}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/service/users/42?page=3", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Client-Token", "token")
+	req.Header.Set("X-Request-Id", "abc")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "secret", received.Get("X-Api-Key"))
+	assert.Empty(t, received.Get("Cookie"))
+	assert.Equal(t, "42/3/203.0.113.1/abc", received.Get("X-Context"))
+	assert.Empty(t, received.Get("X-Client-Token"))
+	assert.Equal(t, "token", received.Get("X-Token"))
+
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Empty(t, w.Header().Get("X-Powered-By"))
+	assert.Empty(t, w.Header().Get("X-Internal-Id"))
+	assert.Equal(t, "1", w.Header().Get("X-Id"))
+	assert.Equal(t, "abc", w.Header().Get("X-Request-Id"))
+}
+
+func TestRequestID(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+
+	id := requestID(c)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, requestID(c))
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("X-Request-Id", "abc")
+	assert.Equal(t, "abc", requestID(c))
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// TransportConfig configures the connection pool of an upstream. Zero values
+// fall back to net/http defaults.
+type TransportConfig struct {
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	KeepAlive           time.Duration `mapstructure:"keep_alive"`
+	DisableKeepAlives   bool          `mapstructure:"disable_keep_alives"`
+}
+
+type Timeouts struct {
+	Dial           time.Duration `mapstructure:"dial"`
+	TLSHandshake   time.Duration `mapstructure:"tls_handshake"`
+	ResponseHeader time.Duration `mapstructure:"response_header"`
+	// Maximum duration of the whole exchange with the upstream, body
+	// included. No limit when 0.
+	Request time.Duration `mapstructure:"request"`
+}
+
+// NewClient returns a client using a dedicated transport. The request timeout
+// is not set on the client, it is applied per request by Forward.
+func NewClient(conf TransportConfig, timeouts Timeouts) *http.Client {
+	dialTimeout := timeouts.Dial
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+
+	keepAlive := conf.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
+	}
+
+	tlsHandshakeTimeout := timeouts.TLSHandshake
+	if tlsHandshakeTimeout <= 0 {
+		tlsHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+
+	maxIdleConns := conf.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+
+	idleConnTimeout := conf.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   tlsHandshakeTimeout,
+			ResponseHeaderTimeout: timeouts.ResponseHeader,
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       conf.MaxConnsPerHost,
+			IdleConnTimeout:       idleConnTimeout,
+			DisableKeepAlives:     conf.DisableKeepAlives,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
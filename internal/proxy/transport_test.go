@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	type testData struct {
+		name      string
+		conf      TransportConfig
+		timeouts  Timeouts
+		assertion func(t *testing.T, transport *http.Transport)
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Defaults",
+			assertion: func(t *testing.T, transport *http.Transport) {
+				assert.Equal(t, defaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+				assert.Equal(t, defaultMaxIdleConns, transport.MaxIdleConns)
+				assert.Equal(t, defaultIdleConnTimeout, transport.IdleConnTimeout)
+				assert.Equal(t, time.Duration(0), transport.ResponseHeaderTimeout)
+			},
+		},
+		{
+			name: "Custom values",
+			conf: TransportConfig{
+				MaxIdleConns:        10,
+				MaxIdleConnsPerHost: 5,
+				MaxConnsPerHost:     20,
+				IdleConnTimeout:     time.Minute,
+				DisableKeepAlives:   true,
+			},
+			timeouts: Timeouts{
+				TLSHandshake:   time.Second,
+				ResponseHeader: 2 * time.Second,
+			},
+			assertion: func(t *testing.T, transport *http.Transport) {
+				assert.Equal(t, time.Second, transport.TLSHandshakeTimeout)
+				assert.Equal(t, 2*time.Second, transport.ResponseHeaderTimeout)
+				assert.Equal(t, 10, transport.MaxIdleConns)
+				assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+				assert.Equal(t, 20, transport.MaxConnsPerHost)
+				assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+				assert.True(t, transport.DisableKeepAlives)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := NewClient(testCase.conf, testCase.timeouts)
+			transport, ok := client.Transport.(*http.Transport)
+			assert.True(t, ok)
+			testCase.assertion(t, transport)
+			assert.Equal(t, http.ErrUseLastResponse, client.CheckRedirect(nil, nil))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
+)
+
+// Upstream groups the targets a service forwards requests to.
+type Upstream struct {
+	Name     string
+	Balancer loadbalancer.Balancer
+	Client   *http.Client
+	// Optional, notified of the outcome of every forwarded request.
+	Health *healthcheck.Checker
+	// Optional, retries are not capped when nil.
+	RetryBudget *RetryBudget
+	// Optional, the client forwarding headers are sent as is when nil.
+	ForwardedHeaders *ForwardedHeaders
+}
+
+// report notifies the health checker of the outcome of a request sent to
+// the target. Errors not caused by the target, such as clients going away,
+// are not reported.
+func (u *Upstream) report(clientCtx context.Context, target *loadbalancer.Target, statusCode int, err error) {
+	if u.Health == nil {
+		return
+	}
+
+	if err != nil {
+		if clientCtx.Err() == nil && isTargetFailure(err) {
+			u.Health.ReportFailure(target)
+		}
+		return
+	}
+
+	if statusCode >= 500 {
+		u.Health.ReportFailure(target)
+		return
+	}
+
+	u.Health.ReportSuccess(target)
+}
+
+// isTargetFailure reports whether the error comes from dialing, using the
+// connection of or waiting for the target.
+func isTargetFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		isTimeout(err)
+}
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotUpgradable = errors.New("upstream connection can't be upgraded")
+)
+
+type WebSocketConfig struct {
+	// Duration without traffic in any direction after which the connection
+	// is closed. No limit when 0.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// Maximum number of simultaneous connections. No limit when 0.
+	MaxConnections int `mapstructure:"max_connections"`
+}
+
+// WebSocket proxies HTTP/1.1 upgrade requests of an endpoint.
+type WebSocket struct {
+	idleTimeout    time.Duration
+	maxConnections int64
+	connections    atomic.Int64
+}
+
+func NewWebSocket(conf WebSocketConfig) *WebSocket {
+	return &WebSocket{
+		idleTimeout:    conf.IdleTimeout,
+		maxConnections: int64(conf.MaxConnections),
+	}
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (w *WebSocket) forward(c *gin.Context, sourcePathPrefix string, upstream *Upstream, options Options) {
+	defer w.connections.Add(-1)
+	if count := w.connections.Add(1); w.maxConnections > 0 && count > w.maxConnections {
+		log.Error("Forward failure", zap.String("reason", "too many websocket connections"))
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	path, err := options.Rewrite.upstreamPath(c, sourcePathPrefix)
+	if err != nil {
+		log.Error("Forward failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+
+	target, err := upstream.Balancer.Next()
+	if err != nil {
+		log.Error("Forward failure", zap.Error(err), zap.String("upstream", upstream.Name))
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	target.Acquire()
+	defer target.Release()
+
+	req, err := upstream.newRequest(c.Request.Context(), c, sourcePathPrefix, target.URL+path, nil, false)
+	if err != nil {
+		log.Error("Forward failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+
+	// Upgrade headers are hop-by-hop, they are restored to request the
+	// upgrade from the upstream.
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", c.Request.Header.Get("Upgrade"))
+
+	clientIP := upstream.ForwardedHeaders.ClientIP(c.Request)
+	options.Headers.transformRequest(c, req.Header, clientIP)
+
+	res, err := upstream.Client.Do(req)
+	if err != nil {
+		upstream.report(c.Request.Context(), target, 0, err)
+		log.Error("Forward failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	upstream.report(c.Request.Context(), target, res.StatusCode, nil)
+	options.Headers.transformResponse(c, res.Header, clientIP)
+
+	// The upstream refused the upgrade, its response is forwarded as is.
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		if err := writeResponse(c, res, 0); err != nil {
+			log.Error("Forward failure", zap.Error(err))
+			c.Abort()
+		}
+		return
+	}
+
+	backConn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		log.Error("Forward failure", zap.Error(ErrNotUpgradable))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	defer backConn.Close()
+
+	clientConn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		log.Error("Forward failure", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	res.Body = nil
+	if err := res.Write(brw); err != nil {
+		log.Error("Forward failure", zap.Error(err))
+		return
+	}
+	if err := brw.Flush(); err != nil {
+		log.Error("Forward failure", zap.Error(err))
+		return
+	}
+
+	log.Debug("websocket connection opened",
+		zap.String("upstream", upstream.Name),
+		zap.String("target", target.URL),
+	)
+
+	closeAll := func() {
+		clientConn.Close()
+		backConn.Close()
+	}
+
+	var touch func()
+	if w.idleTimeout > 0 {
+		timer := time.AfterFunc(w.idleTimeout, closeAll)
+		defer timer.Stop()
+		touch = func() { timer.Reset(w.idleTimeout) }
+	} else {
+		touch = func() {}
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer closeAll()
+		pipe(backConn, brw, touch)
+	}()
+	go func() {
+		defer wg.Done()
+		defer closeAll()
+		pipe(clientConn, backConn, touch)
+	}()
+	wg.Wait()
+
+	log.Debug("websocket connection closed",
+		zap.String("upstream", upstream.Name),
+		zap.String("target", target.URL),
+	)
+}
+
+// pipe copies src to dst until an error occurs, calling activity after each
+// successful read.
+func pipe(dst io.Writer, src io.Reader, activity func()) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			activity()
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
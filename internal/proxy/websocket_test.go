@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUpgradeRequest(t *testing.T) {
+	type testData struct {
+		name        string
+		header      http.Header
+		expectedRes bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Upgrade request",
+			header: http.Header{
+				"Connection": []string{"Upgrade"},
+				"Upgrade":    []string{"websocket"},
+			},
+			expectedRes: true,
+		},
+		{
+			name: "Upgrade among connection tokens",
+			header: http.Header{
+				"Connection": []string{"keep-alive, upgrade"},
+				"Upgrade":    []string{"websocket"},
+			},
+			expectedRes: true,
+		},
+		{
+			name: "Missing upgrade header",
+			header: http.Header{
+				"Connection": []string{"Upgrade"},
+			},
+			expectedRes: false,
+		},
+		{
+			name: "Missing connection header",
+			header: http.Header{
+				"Upgrade": []string{"websocket"},
+			},
+			expectedRes: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header = testCase.header
+			assert.Equal(t, testCase.expectedRes, isUpgradeRequest(req))
+		})
+	}
+}
+
+func TestForwardWebSocket(t *testing.T) {
+	backend := newEchoUpgradeServer()
+	defer backend.Close()
+
+	gateway := newTestGateway(t, backend.URL, WebSocketConfig{})
+	defer gateway.Close()
+
+	conn, reader := dialUpgrade(t, gateway.URL, http.StatusSwitchingProtocols)
+	defer conn.Close()
+
+	_, err := conn.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(reader, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestForwardWebSocketRefused(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer backend.Close()
+
+	gateway := newTestGateway(t, backend.URL, WebSocketConfig{})
+	defer gateway.Close()
+
+	conn, _ := dialUpgrade(t, gateway.URL, http.StatusForbidden)
+	conn.Close()
+}
+
+func TestForwardWebSocketIdleTimeout(t *testing.T) {
+	backend := newEchoUpgradeServer()
+	defer backend.Close()
+
+	gateway := newTestGateway(t, backend.URL, WebSocketConfig{IdleTimeout: 50 * time.Millisecond})
+	defer gateway.Close()
+
+	conn, reader := dialUpgrade(t, gateway.URL, http.StatusSwitchingProtocols)
+	defer conn.Close()
+
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err := reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestForwardWebSocketMaxConnections(t *testing.T) {
+	backend := newEchoUpgradeServer()
+	defer backend.Close()
+
+	gateway := newTestGateway(t, backend.URL, WebSocketConfig{MaxConnections: 1})
+	defer gateway.Close()
+
+	first, _ := dialUpgrade(t, gateway.URL, http.StatusSwitchingProtocols)
+	defer first.Close()
+
+	second, _ := dialUpgrade(t, gateway.URL, http.StatusServiceUnavailable)
+	second.Close()
+}
+
+func newTestGateway(t *testing.T, backendURL string, conf WebSocketConfig) *httptest.Server {
+	router := gin.New()
+	router.GET("/service/ws", Forward("/service", newTestUpstream(t, backendURL), Options{
+		WebSocket: NewWebSocket(conf),
+	}))
+
+	return httptest.NewServer(router)
+}
+
+// newEchoUpgradeServer accepts every upgrade and echoes received bytes.
+func newEchoUpgradeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		_ = brw.Flush()
+		_, _ = io.Copy(conn, brw)
+	}))
+}
+
+func dialUpgrade(t *testing.T, serverURL string, expectedStatusCode int) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	assert.NoError(t, err)
+
+	_, err = conn.Write([]byte("GET /service/ws HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedStatusCode, res.StatusCode)
+
+	return conn, reader
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrUnknownClientAuth = errors.New("unknown client auth policy")
+	ErrInvalidClientCA   = errors.New("no certificate found in client CA bundle")
+)
+
+// Client certificate policies, see tls.ClientAuthType.
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"
+	ClientAuthRequire          = "require"
+	ClientAuthVerifyIfGiven    = "verify_if_given"
+	ClientAuthRequireAndVerify = "require_and_verify"
+)
+
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// PEM bundles of the CAs verifying client certificates.
+	ClientCAFiles []string `mapstructure:"client_ca_files"`
+	// Client certificate policy, one of none, request, require,
+	// verify_if_given or require_and_verify. Defaults to verify_if_given
+	// when client CAs are set, none otherwise.
+	ClientAuth string `mapstructure:"client_auth"`
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:             tls.NoClientCert,
+	ClientAuthRequest:          tls.RequestClientCert,
+	ClientAuthRequire:          tls.RequireAnyClientCert,
+	ClientAuthVerifyIfGiven:    tls.VerifyClientCertIfGiven,
+	ClientAuthRequireAndVerify: tls.RequireAndVerifyClientCert,
+}
+
+// NewTLSConfig loads the server certificate and the client CA bundles.
+func NewTLSConfig(conf TLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load server certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	clientAuth := conf.ClientAuth
+	if clientAuth == "" {
+		clientAuth = ClientAuthNone
+		if len(conf.ClientCAFiles) > 0 {
+			clientAuth = ClientAuthVerifyIfGiven
+		}
+	}
+
+	clientAuthType, ok := clientAuthTypes[clientAuth]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownClientAuth, clientAuth)
+	}
+	tlsConfig.ClientAuth = clientAuthType
+
+	if len(conf.ClientCAFiles) > 0 {
+		pool := x509.NewCertPool()
+		for _, path := range conf.ClientCAFiles {
+			bundle, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("can't read client CA bundle: %w", err)
+			}
+
+			if !pool.AppendCertsFromPEM(bundle) {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidClientCA, path)
+			}
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := test.NewCertificateAuthority("test-ca")
+	serverCert := test.NewCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "gateway"},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	invalidCAFile := filepath.Join(dir, "invalid.crt")
+	assert.NoError(t, os.WriteFile(certFile, serverCert.CertPEM, 0600))
+	assert.NoError(t, os.WriteFile(keyFile, serverCert.KeyPEM, 0600))
+	assert.NoError(t, os.WriteFile(caFile, ca.CertPEM, 0600))
+	assert.NoError(t, os.WriteFile(invalidCAFile, []byte("invalid"), 0600))
+
+	type testData struct {
+		name               string
+		conf               TLSConfig
+		expectedClientAuth tls.ClientAuthType
+		expectedClientCAs  bool
+		shouldFail         bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Success case: no client certificates",
+			conf: TLSConfig{
+				CertFile: certFile,
+				KeyFile:  keyFile,
+			},
+			expectedClientAuth: tls.NoClientCert,
+		},
+		{
+			name: "Success case: client CAs default to verify if given",
+			conf: TLSConfig{
+				CertFile:      certFile,
+				KeyFile:       keyFile,
+				ClientCAFiles: []string{caFile},
+			},
+			expectedClientAuth: tls.VerifyClientCertIfGiven,
+			expectedClientCAs:  true,
+		},
+		{
+			name: "Success case: client certificates required",
+			conf: TLSConfig{
+				CertFile:      certFile,
+				KeyFile:       keyFile,
+				ClientCAFiles: []string{caFile},
+				ClientAuth:    ClientAuthRequireAndVerify,
+			},
+			expectedClientAuth: tls.RequireAndVerifyClientCert,
+			expectedClientCAs:  true,
+		},
+		{
+			name: "Fail case: missing certificate",
+			conf: TLSConfig{
+				CertFile: filepath.Join(dir, "missing.crt"),
+				KeyFile:  keyFile,
+			},
+			shouldFail: true,
+		},
+		{
+			name: "Fail case: invalid client CA bundle",
+			conf: TLSConfig{
+				CertFile:      certFile,
+				KeyFile:       keyFile,
+				ClientCAFiles: []string{invalidCAFile},
+			},
+			shouldFail: true,
+		},
+		{
+			name: "Fail case: unknown client auth",
+			conf: TLSConfig{
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+				ClientAuth: "unknown",
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tlsConfig, err := NewTLSConfig(testCase.conf)
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, tlsConfig.Certificates, 1)
+			assert.Equal(t, testCase.expectedClientAuth, tlsConfig.ClientAuth)
+			assert.Equal(t, testCase.expectedClientCAs, tlsConfig.ClientCAs != nil)
+		})
+	}
+}
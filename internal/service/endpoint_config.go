@@ -2,15 +2,29 @@ package service
 
 import (
 	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/forwardauth"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
 )
 
 type EndpointConfiguration struct {
-	Method        string             `mapstructure:"method"`
-	Path          string             `mapstructure:"path"`
-	Auth          *EndpointAuth      `mapstructure:"auth,omitempty"`
-	RateLimit     *EndpointRateLimit `mapstructure:"rate_limit,omitempty"`
-	MaxBodySize   *int64             `mapstructure:"max_body_size,omitempty"`
-	MaxHeaderSize *int               `mapstructure:"max_header_size,omitempty"`
+	Method         string                  `mapstructure:"method"`
+	Path           string                  `mapstructure:"path"`
+	Auth           *EndpointAuth           `mapstructure:"auth,omitempty"`
+	RateLimit      *EndpointRateLimit      `mapstructure:"rate_limit,omitempty"`
+	CircuitBreaker *EndpointCircuitBreaker `mapstructure:"circuit_breaker,omitempty"`
+	MaxBodySize    *int64                  `mapstructure:"max_body_size,omitempty"`
+	MaxHeaderSize  *int                    `mapstructure:"max_header_size,omitempty"`
+	Timeouts       *EndpointTimeouts       `mapstructure:"timeouts,omitempty"`
+	Retry          *EndpointRetry          `mapstructure:"retry,omitempty"`
+	WebSocket      *EndpointWebSocket      `mapstructure:"websocket,omitempty"`
+	FlushInterval  *time.Duration          `mapstructure:"flush_interval,omitempty"`
+	Rewrite        *proxy.RewriteConfig    `mapstructure:"rewrite,omitempty"`
+	// Applied after the service header transformations.
+	Headers *proxy.HeadersConfig `mapstructure:"headers,omitempty"`
+	// Authorization service consulted after the auth middleware.
+	ForwardAuth *forwardauth.Config `mapstructure:"forward_auth,omitempty"`
 }
 
 type EndpointAuth struct {
@@ -22,13 +36,76 @@ type EndpointAuth struct {
 	Enabled            bool     `mapstructure:"enabled"`
 	AuthorizedRoles    []string `mapstructure:"authorized_roles"`
 	RequiredPermission []string `mapstructure:"required_permissions"`
+	// `any` or `all` of the roles and permissions, override the match modes
+	// of the claim checkers.
+	AuthorizedRolesMatch     string `mapstructure:"authorized_roles_match"`
+	RequiredPermissionsMatch string `mapstructure:"required_permissions_match"`
+	// Names of the providers accepted by the endpoint, overrides the service
+	// providers.
+	Providers []string `mapstructure:"providers"`
+	// Authentication modes accepted by the endpoint, overrides the service
+	// modes.
+	Modes []string `mapstructure:"modes"`
+	// Issuers, audiences and authorized parties required from the tokens,
+	// override the service ones.
+	Issuers           []string `mapstructure:"issuers"`
+	Audiences         []string `mapstructure:"audiences"`
+	AuthorizedParties []string `mapstructure:"authorized_parties"`
+	// Client certificates accepted by the mtls mode, overrides the
+	// middleware allow list.
+	AllowedCertificates *auth.CertificateAllowList `mapstructure:"allowed_certificates"`
+	// Optional CEL expression over the token claims, path parameters,
+	// headers, method and client IP, that must evaluate to true. Compiled
+	// with the service and checked after the roles and permissions.
+	Policy string `mapstructure:"policy"`
 }
 
 type EndpointRateLimit struct {
-	Enabled  bool           `mapstructure:"enabled"`
-	LimitBy  *string        `mapstructure:"limit_by"`
-	Window   *time.Duration `mapstructure:"window"`
-	MaxCount *int           `mapstructure:"max_count"`
+	Enabled   bool           `mapstructure:"enabled"`
+	LimitBy   *string        `mapstructure:"limit_by"`
+	Algorithm *string        `mapstructure:"algorithm"`
+	Window    *time.Duration `mapstructure:"window"`
+	MaxCount  *int           `mapstructure:"max_count"`
+	Rate      *float64       `mapstructure:"rate"`
+	Burst     *int           `mapstructure:"burst"`
+	// Maximum number of keys tracked by the endpoint rate limiter, never
+	// exceeded. Keys are spread over up to 64 shards sharing it, a full
+	// shard evicts its least recently seen key.
+	MaxKeys         *int           `mapstructure:"max_keys"`
+	CleanupInterval *time.Duration `mapstructure:"cleanup_interval"`
+}
+
+type EndpointCircuitBreaker struct {
+	// Enable/disable a circuit breaker dedicated to the endpoint.
+	//
+	// When the endpoint doesn't configure a circuit breaker, the service one
+	// is used.
+	Enabled             bool           `mapstructure:"enabled"`
+	FailureRatio        *float64       `mapstructure:"failure_ratio"`
+	MinRequests         *int           `mapstructure:"min_requests"`
+	Window              *time.Duration `mapstructure:"window"`
+	OpenTimeout         *time.Duration `mapstructure:"open_timeout"`
+	HalfOpenMaxRequests *int           `mapstructure:"half_open_max_requests"`
+}
+
+// EndpointTimeouts overrides the service timeouts. Endpoints overriding
+// connection level timeouts get a dedicated transport.
+type EndpointTimeouts struct {
+	Dial           *time.Duration `mapstructure:"dial"`
+	TLSHandshake   *time.Duration `mapstructure:"tls_handshake"`
+	ResponseHeader *time.Duration `mapstructure:"response_header"`
+	Request        *time.Duration `mapstructure:"request"`
+}
+
+type EndpointRetry struct {
+	Enabled           bool `mapstructure:"enabled"`
+	proxy.RetryConfig `mapstructure:",squash"`
+}
+
+type EndpointWebSocket struct {
+	// Enable/disable the proxying of HTTP/1.1 upgrade requests.
+	Enabled               bool `mapstructure:"enabled"`
+	proxy.WebSocketConfig `mapstructure:",squash"`
 }
 
 func (e *EndpointConfiguration) MergeFromServiceConfiguration(conf Config) {
@@ -40,13 +117,22 @@ func (e *EndpointConfiguration) MergeFromServiceConfiguration(conf Config) {
 		e.MaxHeaderSize = &conf.Middlewares.MaxHeaderSize
 	}
 
+	if e.FlushInterval == nil && conf.FlushInterval != 0 {
+		e.FlushInterval = &conf.FlushInterval
+	}
+
 	// Injecting whole server rate limit config
 	if e.RateLimit == nil && conf.Middlewares.RateLimit.Enabled {
 		e.RateLimit = &EndpointRateLimit{
-			Enabled:  true,
-			LimitBy:  &conf.Middlewares.RateLimit.LimitBy,
-			Window:   &conf.Middlewares.RateLimit.Window,
-			MaxCount: &conf.Middlewares.RateLimit.MaxCount,
+			Enabled:         true,
+			LimitBy:         &conf.Middlewares.RateLimit.LimitBy,
+			Algorithm:       &conf.Middlewares.RateLimit.Algorithm,
+			Window:          &conf.Middlewares.RateLimit.Window,
+			MaxCount:        &conf.Middlewares.RateLimit.MaxCount,
+			Rate:            &conf.Middlewares.RateLimit.Rate,
+			Burst:           &conf.Middlewares.RateLimit.Burst,
+			MaxKeys:         &conf.Middlewares.RateLimit.MaxKeys,
+			CleanupInterval: &conf.Middlewares.RateLimit.CleanupInterval,
 		}
 	}
 
@@ -57,6 +143,10 @@ func (e *EndpointConfiguration) MergeFromServiceConfiguration(conf Config) {
 			e.RateLimit.LimitBy = &conf.Middlewares.RateLimit.LimitBy
 		}
 
+		if e.RateLimit.Algorithm == nil {
+			e.RateLimit.Algorithm = &conf.Middlewares.RateLimit.Algorithm
+		}
+
 		if e.RateLimit.Window == nil {
 			e.RateLimit.Window = &conf.Middlewares.RateLimit.Window
 		}
@@ -64,6 +154,66 @@ func (e *EndpointConfiguration) MergeFromServiceConfiguration(conf Config) {
 		if e.RateLimit.MaxCount == nil {
 			e.RateLimit.MaxCount = &conf.Middlewares.RateLimit.MaxCount
 		}
+
+		if e.RateLimit.Rate == nil {
+			e.RateLimit.Rate = &conf.Middlewares.RateLimit.Rate
+		}
+
+		if e.RateLimit.Burst == nil {
+			e.RateLimit.Burst = &conf.Middlewares.RateLimit.Burst
+		}
+
+		if e.RateLimit.MaxKeys == nil {
+			e.RateLimit.MaxKeys = &conf.Middlewares.RateLimit.MaxKeys
+		}
+
+		if e.RateLimit.CleanupInterval == nil {
+			e.RateLimit.CleanupInterval = &conf.Middlewares.RateLimit.CleanupInterval
+		}
+	}
+
+	// Endpoint specifies a dedicated circuit breaker. Inject missing values
+	// from service configuration.
+	if e.CircuitBreaker != nil && e.CircuitBreaker.Enabled {
+		if e.CircuitBreaker.FailureRatio == nil {
+			e.CircuitBreaker.FailureRatio = &conf.Middlewares.CircuitBreaker.FailureRatio
+		}
+
+		if e.CircuitBreaker.MinRequests == nil {
+			e.CircuitBreaker.MinRequests = &conf.Middlewares.CircuitBreaker.MinRequests
+		}
+
+		if e.CircuitBreaker.Window == nil {
+			e.CircuitBreaker.Window = &conf.Middlewares.CircuitBreaker.Window
+		}
+
+		if e.CircuitBreaker.OpenTimeout == nil {
+			e.CircuitBreaker.OpenTimeout = &conf.Middlewares.CircuitBreaker.OpenTimeout
+		}
+
+		if e.CircuitBreaker.HalfOpenMaxRequests == nil {
+			e.CircuitBreaker.HalfOpenMaxRequests = &conf.Middlewares.CircuitBreaker.HalfOpenMaxRequests
+		}
+	}
+
+	// Endpoint overrides some timeouts. Inject missing values from service
+	// configuration.
+	if e.Timeouts != nil {
+		if e.Timeouts.Dial == nil {
+			e.Timeouts.Dial = &conf.Timeouts.Dial
+		}
+
+		if e.Timeouts.TLSHandshake == nil {
+			e.Timeouts.TLSHandshake = &conf.Timeouts.TLSHandshake
+		}
+
+		if e.Timeouts.ResponseHeader == nil {
+			e.Timeouts.ResponseHeader = &conf.Timeouts.ResponseHeader
+		}
+
+		if e.Timeouts.Request == nil {
+			e.Timeouts.Request = &conf.Timeouts.Request
+		}
 	}
 
 	if e.Auth == nil && conf.Middlewares.Auth.Enabled {
@@ -71,6 +221,31 @@ func (e *EndpointConfiguration) MergeFromServiceConfiguration(conf Config) {
 			Enabled:            true,
 			AuthorizedRoles:    conf.Middlewares.Auth.AuthMiddlewareConfig.AuthorizedRoles.Values,
 			RequiredPermission: conf.Middlewares.Auth.AuthMiddlewareConfig.RequiredPermissions.Values,
+			Providers:          conf.Middlewares.Auth.Providers,
+			Modes:              conf.Middlewares.Auth.Modes,
+			Issuers:            conf.Middlewares.Auth.Issuers,
+			Audiences:          conf.Middlewares.Auth.Audiences,
+			AuthorizedParties:  conf.Middlewares.Auth.AuthorizedParties,
 		}
 	}
+
+	if e.Auth != nil && e.Auth.Providers == nil {
+		e.Auth.Providers = conf.Middlewares.Auth.Providers
+	}
+
+	if e.Auth != nil && e.Auth.Modes == nil {
+		e.Auth.Modes = conf.Middlewares.Auth.Modes
+	}
+
+	if e.Auth != nil && e.Auth.Issuers == nil {
+		e.Auth.Issuers = conf.Middlewares.Auth.Issuers
+	}
+
+	if e.Auth != nil && e.Auth.Audiences == nil {
+		e.Auth.Audiences = conf.Middlewares.Auth.Audiences
+	}
+
+	if e.Auth != nil && e.Auth.AuthorizedParties == nil {
+		e.Auth.AuthorizedParties = conf.Middlewares.Auth.AuthorizedParties
+	}
 }
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/circuitbreaker"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/ratelimiters"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -164,10 +166,16 @@ func TestEndpointConfigurationMergeFromServiceConfigurationRateLimit(t *testing.
 			},
 			expectedResult: EndpointConfiguration{
 				RateLimit: &EndpointRateLimit{
-					Enabled:  true,
-					LimitBy:  stringP("sub_claim"),
-					Window:   &oneHourDuration,
-					MaxCount: intP(10),
+					Enabled:   true,
+					LimitBy:   stringP("sub_claim"),
+					Algorithm: stringP(""),
+					Window:    &oneHourDuration,
+					MaxCount:  intP(10),
+					Rate:      float64P(0),
+					Burst:     intP(0),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
 				},
 			},
 		},
@@ -195,10 +203,16 @@ func TestEndpointConfigurationMergeFromServiceConfigurationRateLimit(t *testing.
 			},
 			expectedResult: EndpointConfiguration{
 				RateLimit: &EndpointRateLimit{
-					Enabled:  true,
-					LimitBy:  stringP(""),
-					Window:   &twoHourDuration,
-					MaxCount: intP(14),
+					Enabled:   true,
+					LimitBy:   stringP(""),
+					Algorithm: stringP(""),
+					Window:    &twoHourDuration,
+					MaxCount:  intP(14),
+					Rate:      float64P(0),
+					Burst:     intP(0),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
 				},
 			},
 		},
@@ -226,10 +240,16 @@ func TestEndpointConfigurationMergeFromServiceConfigurationRateLimit(t *testing.
 			},
 			expectedResult: EndpointConfiguration{
 				RateLimit: &EndpointRateLimit{
-					Enabled:  true,
-					LimitBy:  stringP("sub_claim"),
-					Window:   &twoHourDuration,
-					MaxCount: intP(14),
+					Enabled:   true,
+					LimitBy:   stringP("sub_claim"),
+					Algorithm: stringP(""),
+					Window:    &twoHourDuration,
+					MaxCount:  intP(14),
+					Rate:      float64P(0),
+					Burst:     intP(0),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
 				},
 			},
 		},
@@ -257,10 +277,16 @@ func TestEndpointConfigurationMergeFromServiceConfigurationRateLimit(t *testing.
 			},
 			expectedResult: EndpointConfiguration{
 				RateLimit: &EndpointRateLimit{
-					Enabled:  true,
-					LimitBy:  stringP(""),
-					Window:   &oneHourDuration,
-					MaxCount: intP(14),
+					Enabled:   true,
+					LimitBy:   stringP(""),
+					Algorithm: stringP(""),
+					Window:    &oneHourDuration,
+					MaxCount:  intP(14),
+					Rate:      float64P(0),
+					Burst:     intP(0),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
 				},
 			},
 		},
@@ -288,10 +314,54 @@ func TestEndpointConfigurationMergeFromServiceConfigurationRateLimit(t *testing.
 			},
 			expectedResult: EndpointConfiguration{
 				RateLimit: &EndpointRateLimit{
-					Enabled:  true,
-					LimitBy:  stringP(""),
-					Window:   &twoHourDuration,
-					MaxCount: intP(10),
+					Enabled:   true,
+					LimitBy:   stringP(""),
+					Algorithm: stringP(""),
+					Window:    &twoHourDuration,
+					MaxCount:  intP(10),
+					Rate:      float64P(0),
+					Burst:     intP(0),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
+				},
+			},
+		},
+		{
+			name: "Rate limit algorithm overridden by endpoint",
+			conf: Config{
+				Middlewares: ServiceMiddlewares{
+					RateLimit: ServiceRateLimitConfig{
+						Enabled: true,
+						RateLimiterConfig: ratelimiters.RateLimiterConfig{
+							LimitBy:   "sub_claim",
+							Algorithm: ratelimiters.AlgorithmSlidingWindowLog,
+							Window:    oneHourDuration,
+							MaxCount:  10,
+						},
+					},
+				},
+			},
+			enpointConfig: EndpointConfiguration{
+				RateLimit: &EndpointRateLimit{
+					Enabled:   true,
+					Algorithm: stringP(ratelimiters.AlgorithmTokenBucket),
+					Rate:      float64P(2),
+					Burst:     intP(5),
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				RateLimit: &EndpointRateLimit{
+					Enabled:   true,
+					LimitBy:   stringP("sub_claim"),
+					Algorithm: stringP(ratelimiters.AlgorithmTokenBucket),
+					Window:    &oneHourDuration,
+					MaxCount:  intP(10),
+					Rate:      float64P(2),
+					Burst:     intP(5),
+
+					MaxKeys:         intP(0),
+					CleanupInterval: durationP(0),
 				},
 			},
 		},
@@ -352,6 +422,291 @@ func TestEndpointConfigurationMergeFromServiceConfigurationAuth(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Service providers and modes merged",
+			conf: Config{
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled:   true,
+						Providers: []string{"staff"},
+						Modes:     []string{"bearer", "api_key"},
+					},
+				},
+			},
+			enpointConfig: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled: true,
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:   true,
+					Providers: []string{"staff"},
+					Modes:     []string{"bearer", "api_key"},
+				},
+			},
+		},
+		{
+			name: "Service token requirements merged",
+			conf: Config{
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled:           true,
+						Issuers:           []string{"https://idp.example.com"},
+						Audiences:         []string{"orders"},
+						AuthorizedParties: []string{"web"},
+					},
+				},
+			},
+			enpointConfig: EndpointConfiguration{
+				Auth: nil,
+			},
+			expectedResult: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:           true,
+					Issuers:           []string{"https://idp.example.com"},
+					Audiences:         []string{"orders"},
+					AuthorizedParties: []string{"web"},
+				},
+			},
+		},
+		{
+			name: "Endpoint token requirements kept",
+			conf: Config{
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled:   true,
+						Issuers:   []string{"https://idp.example.com"},
+						Audiences: []string{"orders"},
+					},
+				},
+			},
+			enpointConfig: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:   true,
+					Audiences: []string{"orders-admin"},
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:   true,
+					Issuers:   []string{"https://idp.example.com"},
+					Audiences: []string{"orders-admin"},
+				},
+			},
+		},
+		{
+			name: "Endpoint providers kept",
+			conf: Config{
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled:   true,
+						Providers: []string{"staff"},
+					},
+				},
+			},
+			enpointConfig: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:   true,
+					Providers: []string{"customers"},
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				Auth: &EndpointAuth{
+					Enabled:   true,
+					Providers: []string{"customers"},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.enpointConfig.MergeFromServiceConfiguration(testCase.conf)
+			assert.Equal(t, testCase.expectedResult, testCase.enpointConfig)
+		})
+	}
+}
+
+func TestEndpointConfigurationMergeFromServiceConfigurationFlushInterval(t *testing.T) {
+	type testData struct {
+		name           string
+		conf           Config
+		enpointConfig  EndpointConfiguration
+		expectedResult EndpointConfiguration
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Flush interval well merged",
+			conf: Config{
+				FlushInterval: time.Second,
+			},
+			enpointConfig: EndpointConfiguration{
+				FlushInterval: nil,
+			},
+			expectedResult: EndpointConfiguration{
+				FlushInterval: durationP(time.Second),
+			},
+		},
+		{
+			name: "Service flush interval overriden by endpoint config",
+			conf: Config{
+				FlushInterval: time.Second,
+			},
+			enpointConfig: EndpointConfiguration{
+				FlushInterval: durationP(-1),
+			},
+			expectedResult: EndpointConfiguration{
+				FlushInterval: durationP(-1),
+			},
+		},
+		{
+			name: "No flush interval",
+			conf: Config{},
+			enpointConfig: EndpointConfiguration{
+				FlushInterval: nil,
+			},
+			expectedResult: EndpointConfiguration{
+				FlushInterval: nil,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.enpointConfig.MergeFromServiceConfiguration(testCase.conf)
+			assert.Equal(t, testCase.expectedResult, testCase.enpointConfig)
+		})
+	}
+}
+
+func TestEndpointConfigurationMergeFromServiceConfigurationCircuitBreaker(t *testing.T) {
+	type testData struct {
+		name           string
+		conf           Config
+		enpointConfig  EndpointConfiguration
+		expectedResult EndpointConfiguration
+	}
+
+	serviceConf := Config{
+		Middlewares: ServiceMiddlewares{
+			CircuitBreaker: ServiceCircuitBreakerConfig{
+				Enabled: true,
+				Config: circuitbreaker.Config{
+					FailureRatio:        0.5,
+					MinRequests:         10,
+					Window:              time.Minute,
+					OpenTimeout:         time.Second,
+					HalfOpenMaxRequests: 2,
+				},
+			},
+		},
+	}
+
+	minute := time.Minute
+	second := time.Second
+
+	var testCases = [...]testData{
+		{
+			name: "Service circuit breaker is not copied to the endpoint",
+			conf: serviceConf,
+			enpointConfig: EndpointConfiguration{
+				CircuitBreaker: nil,
+			},
+			expectedResult: EndpointConfiguration{
+				CircuitBreaker: nil,
+			},
+		},
+		{
+			name: "Missing endpoint values are merged",
+			conf: serviceConf,
+			enpointConfig: EndpointConfiguration{
+				CircuitBreaker: &EndpointCircuitBreaker{
+					Enabled:      true,
+					FailureRatio: float64P(0.2),
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				CircuitBreaker: &EndpointCircuitBreaker{
+					Enabled:             true,
+					FailureRatio:        float64P(0.2),
+					MinRequests:         intP(10),
+					Window:              &minute,
+					OpenTimeout:         &second,
+					HalfOpenMaxRequests: intP(2),
+				},
+			},
+		},
+		{
+			name: "Disabled endpoint circuit breaker is left untouched",
+			conf: serviceConf,
+			enpointConfig: EndpointConfiguration{
+				CircuitBreaker: &EndpointCircuitBreaker{
+					Enabled: false,
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				CircuitBreaker: &EndpointCircuitBreaker{
+					Enabled: false,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.enpointConfig.MergeFromServiceConfiguration(testCase.conf)
+			assert.Equal(t, testCase.expectedResult, testCase.enpointConfig)
+		})
+	}
+}
+
+func TestEndpointConfigurationMergeFromServiceConfigurationTimeouts(t *testing.T) {
+	type testData struct {
+		name           string
+		conf           Config
+		enpointConfig  EndpointConfiguration
+		expectedResult EndpointConfiguration
+	}
+
+	serviceConf := Config{
+		Timeouts: proxy.Timeouts{
+			Dial:           time.Second,
+			TLSHandshake:   2 * time.Second,
+			ResponseHeader: 3 * time.Second,
+			Request:        4 * time.Second,
+		},
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Service timeouts are not copied to the endpoint",
+			conf: serviceConf,
+			enpointConfig: EndpointConfiguration{
+				Timeouts: nil,
+			},
+			expectedResult: EndpointConfiguration{
+				Timeouts: nil,
+			},
+		},
+		{
+			name: "Missing endpoint timeouts are merged",
+			conf: serviceConf,
+			enpointConfig: EndpointConfiguration{
+				Timeouts: &EndpointTimeouts{
+					Request: durationP(time.Minute),
+				},
+			},
+			expectedResult: EndpointConfiguration{
+				Timeouts: &EndpointTimeouts{
+					Dial:           durationP(time.Second),
+					TLSHandshake:   durationP(2 * time.Second),
+					ResponseHeader: durationP(3 * time.Second),
+					Request:        durationP(time.Minute),
+				},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -373,3 +728,11 @@ func intP(i int) *int {
 func stringP(s string) *string {
 	return &s
 }
+
+func float64P(f float64) *float64 {
+	return &f
+}
+
+func durationP(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler serves the health of the targets of every given service.
+func HealthHandler(services []*Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses := []healthcheck.ServiceStatus{}
+		for _, service := range services {
+			statuses = append(statuses, service.Health())
+		}
+
+		c.JSON(http.StatusOK, statuses)
+	}
+}
+
+// ReadinessHandler responds 503 while the auth providers of a service are
+// not discovered, listing them by service.
+func ReadinessHandler(services []*Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notReady := map[string][]string{}
+		for _, service := range services {
+			if providers := service.NotReadyProviders(); len(providers) > 0 {
+				notReady[service.name] = providers
+			}
+		}
+
+		if len(notReady) > 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "providers": notReady})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ready": true})
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	instance, err := New(Config{
+		Name:       "TestService",
+		PathPrefix: "/api",
+		BaseURL:    "http://localhost:8080",
+	})
+	assert.NoError(t, err)
+
+	instance.upstream.Balancer.Targets()[0].SetHealthy(false)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	HealthHandler([]*Service{instance})(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	statuses := []healthcheck.ServiceStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &statuses))
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "TestService", statuses[0].Name)
+	assert.Equal(t, "http://localhost:8080", statuses[0].Targets[0].URL)
+	assert.False(t, statuses[0].Targets[0].Healthy)
+}
+
+func TestReadinessHandler(t *testing.T) {
+	type testData struct {
+		name               string
+		auth               ServiceAuthConfig
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	provider := test.LaunchTestProvider()
+	defer provider.Close()
+
+	var testCases = [...]testData{
+		{
+			name:               "Success case: auth disabled",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"ready":true}`,
+		},
+		{
+			name: "Success case: provider discovered",
+			auth: ServiceAuthConfig{
+				Enabled: true,
+				AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+					ProviderURL: provider.URL,
+					ClientID:    "myapp",
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"ready":true}`,
+		},
+		{
+			name: "Fail case: provider not discovered",
+			auth: ServiceAuthConfig{
+				Enabled: true,
+				AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+					ProviderURL: "invalid",
+					ClientID:    "myapp",
+				},
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       `{"ready":false,"providers":{"TestService":["default"]}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					Auth: testCase.auth,
+				},
+			})
+			assert.NoError(t, err)
+			defer instance.Stop()
+
+			// Providers are discovered in background.
+			var w *httptest.ResponseRecorder
+			assert.Eventually(t, func() bool {
+				w = httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				ReadinessHandler([]*Service{instance})(c)
+				return w.Code == testCase.expectedStatusCode
+			}, time.Second, 10*time.Millisecond)
+			assert.JSONEq(t, testCase.expectedBody, w.Body.String())
+		})
+	}
+}
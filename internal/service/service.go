@@ -4,11 +4,16 @@ import (
 	"fmt"
 
 	"github.com/Aloe-Corporation/logs"
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/bodysizelimiter"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/circuitbreaker"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/forwardauth"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/headersizelimiter"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/ratelimiters"
 
+	"github.com/FloRichardAloeCorp/gateway/internal/policy"
 	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -18,28 +23,68 @@ var log = logs.Get()
 
 type Service struct {
 	name              string
-	baseURL           string
+	upstream          *proxy.Upstream
 	gatewayPathPrefix string
 
-	authMiddleware auth.AuthMiddleware
-	authEnabled    bool
+	authMiddleware  auth.AuthMiddleware
+	authEnabled     bool
+	identityHeaders []string
 
 	maxBodySize   int64
 	maxHeaderSize int
 
+	transport proxy.TransportConfig
+	timeouts  proxy.Timeouts
+	headers   proxy.HeadersConfig
+
+	// Endpoint rate limiters, stopped with the service.
+	rateLimiters []*ratelimiters.RateLimiter
+
+	// Shared by the endpoints that don't configure their own circuit breaker.
+	circuitBreaker *circuitbreaker.CircuitBreaker
+
 	endpoints []EndpointConfiguration
 }
 
 func New(conf Config) (*Service, error) {
+	targets, err := loadbalancer.NewTargets(conf.targets())
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", conf.Name, err)
+	}
+
+	balancer, err := loadbalancer.New(conf.LoadBalancing, targets)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", conf.Name, err)
+	}
+
+	var forwardedHeaders *proxy.ForwardedHeaders
+	if conf.ForwardedHeaders != nil {
+		forwardedHeaders, err = proxy.NewForwardedHeaders(*conf.ForwardedHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", conf.Name, err)
+		}
+	}
+
 	service := &Service{
-		name:              conf.Name,
-		baseURL:           conf.BaseURL,
+		name: conf.Name,
+		upstream: &proxy.Upstream{
+			Name:             conf.Name,
+			Balancer:         balancer,
+			Client:           proxy.NewClient(conf.Transport, conf.Timeouts),
+			RetryBudget:      proxy.NewRetryBudget(conf.RetryBudget),
+			ForwardedHeaders: forwardedHeaders,
+		},
 		gatewayPathPrefix: conf.PathPrefix,
 
-		authEnabled: conf.Middlewares.Auth.Enabled,
+		authEnabled:     conf.Middlewares.Auth.Enabled,
+		identityHeaders: auth.IdentityHeaders(conf.Middlewares.Auth.AuthMiddlewareConfig),
 
 		maxBodySize:   conf.Middlewares.MaxBodySize,
 		maxHeaderSize: conf.Middlewares.MaxHeaderSize,
+
+		transport: conf.Transport,
+		timeouts:  conf.Timeouts,
+		headers:   conf.Headers,
 	}
 
 	mergedEndpoints := []EndpointConfiguration{}
@@ -49,6 +94,10 @@ func New(conf Config) (*Service, error) {
 	}
 	service.endpoints = mergedEndpoints
 
+	if conf.Middlewares.CircuitBreaker.Enabled {
+		service.circuitBreaker = circuitbreaker.New(conf.Name, conf.Middlewares.CircuitBreaker.Config)
+	}
+
 	if service.authEnabled {
 		authMiddleware, err := auth.NewAuthMiddleware(conf.Middlewares.Auth.AuthMiddlewareConfig)
 		if err != nil {
@@ -58,25 +107,189 @@ func New(conf Config) (*Service, error) {
 		service.authMiddleware = *authMiddleware
 	}
 
+	// Started once nothing else can fail, the probes would leak otherwise.
+	if conf.HealthCheck.Active.Enabled || conf.HealthCheck.Passive.Enabled {
+		service.upstream.Health = healthcheck.New(conf.Name, conf.HealthCheck, targets)
+		service.upstream.Health.Start()
+		log.Info("health checks enabled",
+			zap.String("service", conf.Name),
+			zap.Bool("active", conf.HealthCheck.Active.Enabled),
+			zap.Bool("passive", conf.HealthCheck.Passive.Enabled),
+		)
+	}
+
 	return service, nil
 }
 
-func (s *Service) AttachEndpoints(router *gin.Engine) {
+func (s *Service) AttachEndpoints(router *gin.Engine) error {
+	if s.authEnabled {
+		s.authMiddleware.AttachSessionRoutes(router.Group(s.gatewayPathPrefix))
+	}
+
 	for _, endpoint := range s.endpoints {
-		middlewares := s.buildMiddlewaresChain(endpoint)
+		middlewares, err := s.buildMiddlewaresChain(endpoint)
+		if err != nil {
+			return fmt.Errorf("service %s, endpoint %s %s: %w", s.name, endpoint.Method, endpoint.Path, err)
+		}
+
+		upstream, options, err := s.buildForwarding(endpoint)
+		if err != nil {
+			return fmt.Errorf("service %s, endpoint %s %s: %w", s.name, endpoint.Method, endpoint.Path, err)
+		}
 
 		handlers := []gin.HandlerFunc{}
 		handlers = append(handlers, middlewares...)
-		handlers = append(handlers, proxy.Forward(s.gatewayPathPrefix, s.baseURL))
+		handlers = append(handlers, proxy.Forward(s.gatewayPathPrefix, upstream, options))
 
 		router.Handle(endpoint.Method, s.gatewayPathPrefix+endpoint.Path, handlers...)
 	}
+
+	return nil
 }
 
-func (s *Service) buildMiddlewaresChain(endpoint EndpointConfiguration) []gin.HandlerFunc {
+// buildForwarding returns the upstream and options used to forward requests
+// of the endpoint. The service upstream is shared unless the endpoint
+// overrides connection level timeouts.
+func (s *Service) buildForwarding(endpoint EndpointConfiguration) (*proxy.Upstream, proxy.Options, error) {
+	options := proxy.Options{
+		RequestTimeout: s.timeouts.Request,
+	}
+
+	if endpoint.FlushInterval != nil {
+		options.FlushInterval = *endpoint.FlushInterval
+	}
+
+	if endpoint.Rewrite != nil {
+		rewriter, err := proxy.NewRewriter(*endpoint.Rewrite, endpoint.Path)
+		if err != nil {
+			return nil, proxy.Options{}, err
+		}
+
+		options.Rewrite = rewriter
+	}
+
+	headers := []proxy.HeadersConfig{s.headers}
+	if endpoint.Headers != nil {
+		headers = append(headers, *endpoint.Headers)
+	}
+
+	transformer, err := proxy.NewHeaderTransformer(endpoint.Path, headers...)
+	if err != nil {
+		return nil, proxy.Options{}, err
+	}
+	options.Headers = transformer
+
+	if endpoint.Retry != nil && endpoint.Retry.Enabled {
+		policy, err := proxy.NewRetryPolicy(endpoint.Retry.RetryConfig)
+		if err != nil {
+			return nil, proxy.Options{}, err
+		}
+
+		options.Retry = policy
+		log.Info("retry policy enabled",
+			zap.String("service", s.name),
+			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+		)
+	}
+
+	if endpoint.WebSocket != nil && endpoint.WebSocket.Enabled {
+		options.WebSocket = proxy.NewWebSocket(endpoint.WebSocket.WebSocketConfig)
+		log.Info("websocket proxying enabled",
+			zap.String("service", s.name),
+			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+		)
+	}
+
+	if endpoint.Timeouts == nil {
+		return s.upstream, options, nil
+	}
+
+	timeouts := proxy.Timeouts{
+		Dial:           *endpoint.Timeouts.Dial,
+		TLSHandshake:   *endpoint.Timeouts.TLSHandshake,
+		ResponseHeader: *endpoint.Timeouts.ResponseHeader,
+		Request:        *endpoint.Timeouts.Request,
+	}
+	options.RequestTimeout = timeouts.Request
+
+	if timeouts.Dial == s.timeouts.Dial &&
+		timeouts.TLSHandshake == s.timeouts.TLSHandshake &&
+		timeouts.ResponseHeader == s.timeouts.ResponseHeader {
+		return s.upstream, options, nil
+	}
+
+	upstream := *s.upstream
+	upstream.Client = proxy.NewClient(s.transport, timeouts)
+	log.Info("dedicated upstream transport enabled",
+		zap.String("service", s.name),
+		zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+	)
+
+	return &upstream, options, nil
+}
+
+// Stop stops the background health checks, auth provider discoveries and
+// rate limiter evictions of the service.
+func (s *Service) Stop() {
+	if s.upstream.Health != nil {
+		s.upstream.Health.Stop()
+	}
+
+	if s.authEnabled {
+		s.authMiddleware.Stop()
+	}
+
+	for _, limiter := range s.rateLimiters {
+		limiter.Stop()
+	}
+}
+
+// Health returns the current health of the service targets.
+func (s *Service) Health() healthcheck.ServiceStatus {
+	return healthcheck.Status(s.name, s.upstream.Balancer.Targets())
+}
+
+// NotReadyProviders returns the auth providers of the service whose
+// discovery has not succeeded yet.
+func (s *Service) NotReadyProviders() []string {
+	if !s.authEnabled {
+		return nil
+	}
+
+	return s.authMiddleware.NotReadyProviders()
+}
+
+func (s *Service) buildMiddlewaresChain(endpoint EndpointConfiguration) ([]gin.HandlerFunc, error) {
 	handlers := []gin.HandlerFunc{}
 	if s.authEnabled && endpoint.Auth.Enabled {
-		handlers = append(handlers, s.authMiddleware.Guard(endpoint.Auth.AuthorizedRoles, endpoint.Auth.RequiredPermission))
+		var endpointPolicy *policy.Policy
+		if endpoint.Auth.Policy != "" {
+			var err error
+			endpointPolicy, err = policy.Compile(endpoint.Auth.Policy, endpoint.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		guard, err := s.authMiddleware.Guard(auth.Rules{
+			AcceptedRoles:       endpoint.Auth.AuthorizedRoles,
+			AcceptedPermissions: endpoint.Auth.RequiredPermission,
+			RolesMatch:          endpoint.Auth.AuthorizedRolesMatch,
+			PermissionsMatch:    endpoint.Auth.RequiredPermissionsMatch,
+			Providers:           endpoint.Auth.Providers,
+			Modes:               endpoint.Auth.Modes,
+			AllowedCertificates: endpoint.Auth.AllowedCertificates,
+			Issuers:             endpoint.Auth.Issuers,
+			Audiences:           endpoint.Auth.Audiences,
+			AuthorizedParties:   endpoint.Auth.AuthorizedParties,
+			Policy:              endpointPolicy,
+			ClientIP:            s.upstream.ForwardedHeaders.ClientIP,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, guard)
 		log.Info("authorization middleware enabled",
 			zap.String("service", s.name),
 			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
@@ -86,6 +299,24 @@ func (s *Service) buildMiddlewaresChain(endpoint EndpointConfiguration) []gin.Ha
 			zap.String("service", s.name),
 			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
 		)
+
+		if len(s.identityHeaders) > 0 {
+			handlers = append(handlers, auth.StripIdentityHeaders(s.identityHeaders))
+		}
+	}
+
+	if endpoint.ForwardAuth != nil {
+		forwardAuth, err := forwardauth.New(*endpoint.ForwardAuth)
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, forwardAuth.Guard())
+		log.Info("forward auth middleware enabled",
+			zap.String("url", endpoint.ForwardAuth.URL),
+			zap.String("service", s.name),
+			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+		)
 	}
 
 	if endpoint.MaxBodySize != nil {
@@ -107,18 +338,48 @@ func (s *Service) buildMiddlewaresChain(endpoint EndpointConfiguration) []gin.Ha
 	}
 
 	if endpoint.RateLimit != nil && endpoint.RateLimit.Enabled {
-		limiter := ratelimiters.NewRateLimiter(ratelimiters.RateLimiterConfig{
-			LimitBy:  *endpoint.RateLimit.LimitBy,
-			Window:   *endpoint.RateLimit.Window,
-			MaxCount: *endpoint.RateLimit.MaxCount,
+		limiter, err := ratelimiters.NewRateLimiter(ratelimiters.RateLimiterConfig{
+			LimitBy:         *endpoint.RateLimit.LimitBy,
+			Algorithm:       *endpoint.RateLimit.Algorithm,
+			Window:          *endpoint.RateLimit.Window,
+			MaxCount:        *endpoint.RateLimit.MaxCount,
+			Rate:            *endpoint.RateLimit.Rate,
+			Burst:           *endpoint.RateLimit.Burst,
+			MaxKeys:         *endpoint.RateLimit.MaxKeys,
+			CleanupInterval: *endpoint.RateLimit.CleanupInterval,
 		})
+		if err != nil {
+			return nil, err
+		}
+
+		s.rateLimiters = append(s.rateLimiters, limiter)
 		handlers = append(handlers, limiter.Allow())
-		log.Info("rate limiter middleware enabled",
-			zap.String("limit", fmt.Sprintf("%d requests every %s", *endpoint.RateLimit.MaxCount, endpoint.RateLimit.Window.String())),
+		log.Info("rate limiter middleware enabled", append(limiter.LogFields(),
+			zap.String("service", s.name),
+			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+		)...)
+	}
+
+	if endpoint.CircuitBreaker != nil && endpoint.CircuitBreaker.Enabled {
+		breaker := circuitbreaker.New(s.name+" "+endpoint.Method+" "+endpoint.Path, circuitbreaker.Config{
+			FailureRatio:        *endpoint.CircuitBreaker.FailureRatio,
+			MinRequests:         *endpoint.CircuitBreaker.MinRequests,
+			Window:              *endpoint.CircuitBreaker.Window,
+			OpenTimeout:         *endpoint.CircuitBreaker.OpenTimeout,
+			HalfOpenMaxRequests: *endpoint.CircuitBreaker.HalfOpenMaxRequests,
+		})
+		handlers = append(handlers, breaker.Guard())
+		log.Info("endpoint circuit breaker middleware enabled",
+			zap.String("service", s.name),
+			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
+		)
+	} else if endpoint.CircuitBreaker == nil && s.circuitBreaker != nil {
+		handlers = append(handlers, s.circuitBreaker.Guard())
+		log.Info("service circuit breaker middleware enabled",
 			zap.String("service", s.name),
 			zap.String("endpoint", endpoint.Method+" "+endpoint.Path),
 		)
 	}
 
-	return handlers
+	return handlers, nil
 }
@@ -1,30 +1,72 @@
 package service
 
 import (
+	"time"
+
+	"github.com/FloRichardAloeCorp/gateway/internal/healthcheck"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/circuitbreaker"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/ratelimiters"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
 )
 
 type Config struct {
-	Name        string                  `mapstructure:"name"`
-	PathPrefix  string                  `mapstructure:"path_prefix"`
-	BaseURL     string                  `mapstructure:"base_url"`
+	Name       string `mapstructure:"name"`
+	PathPrefix string `mapstructure:"path_prefix"`
+	// Shorthand for a single target. When set, it is added to Targets.
+	BaseURL string                      `mapstructure:"base_url"`
+	Targets []loadbalancer.TargetConfig `mapstructure:"targets"`
+	// Strategy used to pick a target, one of round_robin (default),
+	// weighted_round_robin, least_outstanding_requests or random_two_choices.
+	LoadBalancing string                  `mapstructure:"load_balancing"`
+	HealthCheck   healthcheck.Config      `mapstructure:"health_check"`
+	Transport     proxy.TransportConfig   `mapstructure:"transport"`
+	Timeouts      proxy.Timeouts          `mapstructure:"timeouts"`
+	RetryBudget   proxy.RetryBudgetConfig `mapstructure:"retry_budget"`
+	// Maximum delay before response data is flushed to the client. Negative
+	// values flush after each write.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// Overrides `server.forwarded_headers` for the service.
+	ForwardedHeaders *proxy.ForwardedHeadersConfig `mapstructure:"forwarded_headers"`
+	// Header transformations applied on every endpoint.
+	Headers     proxy.HeadersConfig     `mapstructure:"headers"`
 	Middlewares ServiceMiddlewares      `mapstructure:"middlewares"`
 	Endpoints   []EndpointConfiguration `mapstructure:"endpoints"`
 }
 
+func (c Config) targets() []loadbalancer.TargetConfig {
+	if c.BaseURL == "" {
+		return c.Targets
+	}
+
+	return append([]loadbalancer.TargetConfig{{URL: c.BaseURL}}, c.Targets...)
+}
+
 type ServiceMiddlewares struct {
-	Auth          ServiceAuthConfig      `mapstructure:"auth"`
-	MaxBodySize   int64                  `mapstructure:"max_body_size"`
-	MaxHeaderSize int                    `mapstructure:"max_header_size"`
-	RateLimit     ServiceRateLimitConfig `mapstructure:"rate_limit"`
+	Auth           ServiceAuthConfig           `mapstructure:"auth"`
+	MaxBodySize    int64                       `mapstructure:"max_body_size"`
+	MaxHeaderSize  int                         `mapstructure:"max_header_size"`
+	RateLimit      ServiceRateLimitConfig      `mapstructure:"rate_limit"`
+	CircuitBreaker ServiceCircuitBreakerConfig `mapstructure:"circuit_breaker"`
 }
 
 type ServiceAuthConfig struct {
 	// Enable/disable auth middleware on all endpoints.
 	//
 	// `middlewares.auth` must be configured to use auth middleware.
-	Enabled              bool                      `mapstructure:"enabled"`
+	Enabled bool `mapstructure:"enabled"`
+	// Names of the providers accepted by the service endpoints, all
+	// providers when empty.
+	Providers []string `mapstructure:"providers"`
+	// Authentication modes accepted by the service endpoints, bearer or
+	// api_key. Only bearer tokens are accepted when empty.
+	Modes []string `mapstructure:"modes"`
+	// Issuers, audiences and authorized parties required from the tokens
+	// by the service endpoints, override the provider ones when not empty.
+	Issuers              []string                  `mapstructure:"issuers"`
+	Audiences            []string                  `mapstructure:"audiences"`
+	AuthorizedParties    []string                  `mapstructure:"authorized_parties"`
 	AuthMiddlewareConfig auth.AuthMiddlewareConfig `mapstructure:",omitempty"`
 }
 
@@ -32,3 +74,11 @@ type ServiceRateLimitConfig struct {
 	Enabled                        bool `mapstructure:"enabled"`
 	ratelimiters.RateLimiterConfig `mapstructure:",squash"`
 }
+
+type ServiceCircuitBreakerConfig struct {
+	// Enable/disable a circuit breaker shared by all endpoints of the service.
+	//
+	// Endpoints configuring their own circuit breaker get a dedicated one.
+	Enabled               bool `mapstructure:"enabled"`
+	circuitbreaker.Config `mapstructure:",squash"`
+}
@@ -1,11 +1,19 @@
 package service
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	// model "github.com/FloRichardAloeCorp/gateway/pkg/structs"
+	"github.com/FloRichardAloeCorp/gateway/internal/loadbalancer"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/auth"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/circuitbreaker"
+	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/forwardauth"
 	"github.com/FloRichardAloeCorp/gateway/internal/middlewares/ratelimiters"
+	"github.com/FloRichardAloeCorp/gateway/internal/policy"
+	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
 	"github.com/FloRichardAloeCorp/gateway/internal/test"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +24,7 @@ func TestNew(t *testing.T) {
 		name            string
 		conf            Config
 		expectedService *Service
+		expectedTargets []string
 		shouldFail      bool
 	}
 
@@ -46,7 +55,6 @@ func TestNew(t *testing.T) {
 			},
 			expectedService: &Service{
 				name:              "TestService",
-				baseURL:           "http://localhost:8080",
 				gatewayPathPrefix: "/api",
 				authMiddleware:    auth.AuthMiddleware{},
 				authEnabled:       true,
@@ -62,21 +70,67 @@ func TestNew(t *testing.T) {
 					},
 				},
 			},
-			shouldFail: false,
+			expectedTargets: []string{"http://localhost:8080"},
+			shouldFail:      false,
 		},
 		{
-			name: "Fail case: invalid provider url",
+			name: "Success case: multiple targets",
+			conf: Config{
+				Name:          "TestService",
+				PathPrefix:    "/api",
+				BaseURL:       "http://localhost:8080",
+				LoadBalancing: loadbalancer.WeightedRoundRobin,
+				Targets: []loadbalancer.TargetConfig{
+					{URL: "http://localhost:8081", Weight: 2},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+					},
+				},
+			},
+			expectedService: &Service{
+				name:              "TestService",
+				gatewayPathPrefix: "/api",
+				endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+					},
+				},
+			},
+			expectedTargets: []string{"http://localhost:8080", "http://localhost:8081"},
+			shouldFail:      false,
+		},
+		{
+			name: "Fail case: no target",
+			conf: Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+			},
+			shouldFail: true,
+		},
+		{
+			name: "Fail case: unknown load balancing strategy",
+			conf: Config{
+				Name:          "TestService",
+				PathPrefix:    "/api",
+				BaseURL:       "http://localhost:8080",
+				LoadBalancing: "unknown",
+			},
+			shouldFail: true,
+		},
+		{
+			name: "Fail case: no authentication mode",
 			conf: Config{
 				Name:       "TestService",
 				PathPrefix: "/api",
 				BaseURL:    "http://localhost:8080",
 				Middlewares: ServiceMiddlewares{
 					Auth: ServiceAuthConfig{
-						Enabled: true,
-						AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
-							ProviderURL: "http://invalid.com",
-							ClientID:    "myapp",
-						},
+						Enabled:              true,
+						AuthMiddlewareConfig: auth.AuthMiddlewareConfig{},
 					},
 				},
 				Endpoints: []EndpointConfiguration{
@@ -98,7 +152,11 @@ func TestNew(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, testCase.expectedService.name, service.name)
-				assert.Equal(t, testCase.expectedService.baseURL, service.baseURL)
+				targets := []string{}
+				for _, target := range service.upstream.Balancer.Targets() {
+					targets = append(targets, target.URL)
+				}
+				assert.Equal(t, testCase.expectedTargets, targets)
 				assert.Equal(t, testCase.expectedService.gatewayPathPrefix, service.gatewayPathPrefix)
 				assert.Equal(t, testCase.expectedService.authEnabled, service.authEnabled)
 				assert.Equal(t, testCase.expectedService.maxBodySize, service.maxBodySize)
@@ -134,7 +192,8 @@ func TestServiceAttachEndpoints(t *testing.T) {
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			testCase.service.AttachEndpoints(testCase.router)
+			err := testCase.service.AttachEndpoints(testCase.router)
+			assert.NoError(t, err)
 			for _, route := range testCase.router.Routes() {
 				assert.Equal(t, testCase.service.endpoints[0].Method, route.Method)
 				assert.Equal(t, testCase.service.gatewayPathPrefix+testCase.service.endpoints[0].Path, route.Path)
@@ -143,6 +202,103 @@ func TestServiceAttachEndpoints(t *testing.T) {
 	}
 }
 
+func TestServiceAttachEndpointsSession(t *testing.T) {
+	provider := test.LaunchTestProvider()
+
+	instance, err := New(Config{
+		Name:       "TestService",
+		PathPrefix: "/api",
+		BaseURL:    "http://localhost:8080",
+		Middlewares: ServiceMiddlewares{
+			Auth: ServiceAuthConfig{
+				Enabled: true,
+				AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+					ProviderURL: provider.URL,
+					ClientID:    "myapp",
+					Session: &auth.SessionConfig{
+						RedirectURL:  "https://app.example.com/api/auth/callback",
+						CookieSecret: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+					},
+				},
+			},
+		},
+		Endpoints: []EndpointConfiguration{
+			{
+				Method: "GET",
+				Path:   "/orders",
+				Auth: &EndpointAuth{
+					Enabled: true,
+					Modes:   []string{auth.ModeSession},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	router := gin.New()
+	assert.NoError(t, instance.AttachEndpoints(router))
+
+	paths := []string{}
+	for _, route := range router.Routes() {
+		paths = append(paths, route.Method+" "+route.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"GET /api/auth/login",
+		"GET /api/auth/callback",
+		"GET /api/auth/logout",
+		"GET /api/orders",
+	}, paths)
+}
+
+func TestServiceUnguardedEndpointIdentityHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Received-Identity", r.Header.Get("X-Client-Identity"))
+		w.Header().Set("X-Received-User", r.Header.Get("X-User-Id"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	instance, err := New(Config{
+		Name:       "TestService",
+		PathPrefix: "/api",
+		BaseURL:    upstream.URL,
+		Middlewares: ServiceMiddlewares{
+			Auth: ServiceAuthConfig{
+				Enabled: true,
+				AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+					ForwardedClaims: []auth.ForwardedClaimConfig{
+						{Claim: "sub", Header: "X-User-Id"},
+					},
+					ClientCertificates: &auth.ClientCertificateConfig{
+						IdentityHeader: "X-Client-Identity",
+					},
+				},
+			},
+		},
+		Endpoints: []EndpointConfiguration{
+			{
+				Method: "GET",
+				Path:   "/public",
+				Auth:   &EndpointAuth{Enabled: false},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	router := gin.New()
+	assert.NoError(t, instance.AttachEndpoints(router))
+
+	req := httptest.NewRequest("GET", "/api/public", nil)
+	req.Header.Set("X-Client-Identity", "spiffe://example.org/admin")
+	req.Header.Set("X-User-Id", "admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Received-Identity"))
+	assert.Empty(t, w.Header().Get("X-Received-User"))
+}
+
 func TestServiceBuildMiddlewaresChain(t *testing.T) {
 	type testData struct {
 		name                     string
@@ -177,15 +333,108 @@ func TestServiceBuildMiddlewaresChain(t *testing.T) {
 							MaxCount: 5,
 						},
 					},
+					CircuitBreaker: ServiceCircuitBreakerConfig{
+						Enabled: true,
+					},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+					},
+				},
+			},
+			expectedMiddelwaresCount: 5,
+		},
+		{
+			name: "Endpoint circuit breaker",
+			serviceConf: Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					CircuitBreaker: ServiceCircuitBreakerConfig{
+						Enabled: false,
+						Config: circuitbreaker.Config{
+							MinRequests: 2,
+						},
+					},
 				},
 				Endpoints: []EndpointConfiguration{
 					{
 						Method: "GET",
 						Path:   "/test",
+						CircuitBreaker: &EndpointCircuitBreaker{
+							Enabled: true,
+						},
 					},
 				},
 			},
-			expectedMiddelwaresCount: 4,
+			expectedMiddelwaresCount: 1,
+		},
+		{
+			name: "Endpoint disables service circuit breaker",
+			serviceConf: Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					CircuitBreaker: ServiceCircuitBreakerConfig{
+						Enabled: true,
+					},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+						CircuitBreaker: &EndpointCircuitBreaker{
+							Enabled: false,
+						},
+					},
+				},
+			},
+			expectedMiddelwaresCount: 0,
+		},
+		{
+			name: "Forwarded claims stripped on unprotected endpoint",
+			serviceConf: Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled: false,
+						AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+							ForwardedClaims: []auth.ForwardedClaimConfig{
+								{Claim: "sub", Header: "X-User-Id"},
+							},
+						},
+					},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+					},
+				},
+			},
+			expectedMiddelwaresCount: 1,
+		},
+		{
+			name: "Forward auth on endpoint",
+			serviceConf: Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Endpoints: []EndpointConfiguration{
+					{
+						Method:      "GET",
+						Path:        "/test",
+						ForwardAuth: &forwardauth.Config{URL: "http://authz/check"},
+					},
+				},
+			},
+			expectedMiddelwaresCount: 1,
 		},
 		{
 			name: "All middlewares deactivated",
@@ -214,8 +463,463 @@ func TestServiceBuildMiddlewaresChain(t *testing.T) {
 			instance, err := New(testCase.serviceConf)
 			assert.NoError(t, err)
 
-			middlewares := instance.buildMiddlewaresChain(instance.endpoints[0])
+			middlewares, err := instance.buildMiddlewaresChain(instance.endpoints[0])
+			assert.NoError(t, err)
 			assert.Equal(t, testCase.expectedMiddelwaresCount, len(middlewares))
 		})
 	}
 }
+
+func TestServiceBuildMiddlewaresChainPolicy(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		policy      string
+		expectedErr error
+	}
+
+	provider := test.LaunchTestProvider()
+
+	var testCases = [...]testData{
+		{
+			name:   "Success case: valid policy",
+			policy: `"admin" in claims.roles || claims.tenant == path.tenant`,
+		},
+		{
+			name:        "Fail case: unknown path parameter",
+			shouldFail:  true,
+			policy:      `claims.org == path.org`,
+			expectedErr: policy.ErrUnknownPathParam,
+		},
+		{
+			name:        "Fail case: invalid expression",
+			shouldFail:  true,
+			policy:      `claims.tenant ==`,
+			expectedErr: policy.ErrInvalidExpression,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					Auth: ServiceAuthConfig{
+						Enabled: true,
+						AuthMiddlewareConfig: auth.AuthMiddlewareConfig{
+							ProviderURL: provider.URL,
+							ClientID:    "myapp",
+						},
+					},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/tenants/:tenant",
+						Auth: &EndpointAuth{
+							Enabled: true,
+							Policy:  testCase.policy,
+						},
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			middlewares, err := instance.buildMiddlewaresChain(instance.endpoints[0])
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, middlewares, 1)
+		})
+	}
+}
+
+func TestServiceBuildMiddlewaresChainRateLimit(t *testing.T) {
+	type testData struct {
+		name        string
+		shouldFail  bool
+		algorithm   string
+		expectedErr error
+	}
+
+	var testCases = [...]testData{
+		{
+			name:      "Success case: sliding window counter",
+			algorithm: ratelimiters.AlgorithmSlidingWindowCounter,
+		},
+		{
+			name:      "Success case: gcra",
+			algorithm: ratelimiters.AlgorithmGCRA,
+		},
+		{
+			name:        "Fail case: unknown algorithm",
+			shouldFail:  true,
+			algorithm:   "leaky_bucket",
+			expectedErr: ratelimiters.ErrUnknownAlgorithm,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Middlewares: ServiceMiddlewares{
+					RateLimit: ServiceRateLimitConfig{
+						Enabled: true,
+						RateLimiterConfig: ratelimiters.RateLimiterConfig{
+							Window:   time.Minute,
+							MaxCount: 60,
+						},
+					},
+				},
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+						RateLimit: &EndpointRateLimit{
+							Enabled:   true,
+							Algorithm: stringP(testCase.algorithm),
+						},
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			middlewares, err := instance.buildMiddlewaresChain(instance.endpoints[0])
+			if testCase.shouldFail {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, middlewares, 1)
+			assert.Len(t, instance.rateLimiters, 1)
+			instance.Stop()
+		})
+	}
+}
+
+func TestServiceBuildForwarding(t *testing.T) {
+	type testData struct {
+		name                   string
+		endpoint               EndpointConfiguration
+		expectedSharedUpstream bool
+		expectedOptions        proxy.Options
+	}
+
+	serviceConf := Config{
+		Name:       "TestService",
+		PathPrefix: "/api",
+		BaseURL:    "http://localhost:8080",
+		Timeouts: proxy.Timeouts{
+			Dial:    time.Second,
+			Request: time.Minute,
+		},
+	}
+
+	var testCases = [...]testData{
+		{
+			name: "Service timeouts",
+			endpoint: EndpointConfiguration{
+				Method: "GET",
+				Path:   "/test",
+			},
+			expectedSharedUpstream: true,
+			expectedOptions:        proxy.Options{RequestTimeout: time.Minute},
+		},
+		{
+			name: "Endpoint request timeout",
+			endpoint: EndpointConfiguration{
+				Method: "GET",
+				Path:   "/test",
+				Timeouts: &EndpointTimeouts{
+					Request: durationP(time.Second),
+				},
+			},
+			expectedSharedUpstream: true,
+			expectedOptions:        proxy.Options{RequestTimeout: time.Second},
+		},
+		{
+			name: "Endpoint flush interval",
+			endpoint: EndpointConfiguration{
+				Method:        "GET",
+				Path:          "/test",
+				FlushInterval: durationP(-1),
+			},
+			expectedSharedUpstream: true,
+			expectedOptions:        proxy.Options{RequestTimeout: time.Minute, FlushInterval: -1},
+		},
+		{
+			name: "Endpoint dial timeout",
+			endpoint: EndpointConfiguration{
+				Method: "GET",
+				Path:   "/test",
+				Timeouts: &EndpointTimeouts{
+					Dial: durationP(2 * time.Second),
+				},
+			},
+			expectedSharedUpstream: false,
+			expectedOptions:        proxy.Options{RequestTimeout: time.Minute},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			conf := serviceConf
+			conf.Endpoints = []EndpointConfiguration{testCase.endpoint}
+			instance, err := New(conf)
+			assert.NoError(t, err)
+
+			upstream, options, err := instance.buildForwarding(instance.endpoints[0])
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedOptions, options)
+			assert.Equal(t, testCase.expectedSharedUpstream, upstream == instance.upstream)
+			assert.Equal(t, testCase.expectedSharedUpstream, upstream.Client == instance.upstream.Client)
+			assert.Equal(t, instance.upstream.Balancer, upstream.Balancer)
+		})
+	}
+}
+
+func TestServiceBuildForwardingRetry(t *testing.T) {
+	type testData struct {
+		name          string
+		retry         *EndpointRetry
+		expectedRetry bool
+		shouldFail    bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:          "No retry",
+			retry:         nil,
+			expectedRetry: false,
+		},
+		{
+			name:          "Retry disabled",
+			retry:         &EndpointRetry{Enabled: false},
+			expectedRetry: false,
+		},
+		{
+			name:          "Retry enabled",
+			retry:         &EndpointRetry{Enabled: true},
+			expectedRetry: true,
+		},
+		{
+			name: "Fail case: invalid retry configuration",
+			retry: &EndpointRetry{
+				Enabled: true,
+				RetryConfig: proxy.RetryConfig{
+					RetryOnErrors: []string{"unknown"},
+				},
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Endpoints: []EndpointConfiguration{
+					{
+						Method: "GET",
+						Path:   "/test",
+						Retry:  testCase.retry,
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			_, options, err := instance.buildForwarding(instance.endpoints[0])
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Error(t, instance.AttachEndpoints(gin.New()))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedRetry, options.Retry != nil)
+			}
+		})
+	}
+}
+
+func TestServiceBuildForwardingWebSocket(t *testing.T) {
+	type testData struct {
+		name              string
+		websocket         *EndpointWebSocket
+		expectedWebSocket bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:              "No websocket",
+			websocket:         nil,
+			expectedWebSocket: false,
+		},
+		{
+			name:              "Websocket disabled",
+			websocket:         &EndpointWebSocket{Enabled: false},
+			expectedWebSocket: false,
+		},
+		{
+			name: "Websocket enabled",
+			websocket: &EndpointWebSocket{
+				Enabled: true,
+				WebSocketConfig: proxy.WebSocketConfig{
+					IdleTimeout:    time.Minute,
+					MaxConnections: 10,
+				},
+			},
+			expectedWebSocket: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Endpoints: []EndpointConfiguration{
+					{
+						Method:    "GET",
+						Path:      "/ws",
+						WebSocket: testCase.websocket,
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			_, options, err := instance.buildForwarding(instance.endpoints[0])
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedWebSocket, options.WebSocket != nil)
+		})
+	}
+}
+
+func TestServiceBuildForwardingRewrite(t *testing.T) {
+	type testData struct {
+		name            string
+		rewrite         *proxy.RewriteConfig
+		expectedRewrite bool
+		shouldFail      bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "No rewrite",
+			rewrite:         nil,
+			expectedRewrite: false,
+		},
+		{
+			name:            "Rewrite path template",
+			rewrite:         &proxy.RewriteConfig{Path: "/v2/accounts/{id}/profile"},
+			expectedRewrite: true,
+		},
+		{
+			name:       "Fail case: unknown path parameter",
+			rewrite:    &proxy.RewriteConfig{Path: "/v2/accounts/{account}"},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Endpoints: []EndpointConfiguration{
+					{
+						Method:  "GET",
+						Path:    "/users/:id",
+						Rewrite: testCase.rewrite,
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			_, options, err := instance.buildForwarding(instance.endpoints[0])
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Error(t, instance.AttachEndpoints(gin.New()))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedRewrite, options.Rewrite != nil)
+			}
+		})
+	}
+}
+
+func TestServiceBuildForwardingHeaders(t *testing.T) {
+	type testData struct {
+		name            string
+		serviceHeaders  proxy.HeadersConfig
+		endpointHeaders *proxy.HeadersConfig
+		expectedHeaders bool
+		shouldFail      bool
+	}
+
+	var testCases = [...]testData{
+		{
+			name:            "No header transformations",
+			expectedHeaders: false,
+		},
+		{
+			name: "Service header transformations",
+			serviceHeaders: proxy.HeadersConfig{
+				Response: proxy.HeaderRulesConfig{Remove: []string{"Server"}},
+			},
+			expectedHeaders: true,
+		},
+		{
+			name: "Endpoint header transformations",
+			endpointHeaders: &proxy.HeadersConfig{
+				Request: proxy.HeaderRulesConfig{Set: map[string]string{"X-User-Id": "${path.id}"}},
+			},
+			expectedHeaders: true,
+		},
+		{
+			name: "Fail case: invalid template",
+			endpointHeaders: &proxy.HeadersConfig{
+				Request: proxy.HeaderRulesConfig{Set: map[string]string{"X-User-Id": "${path.user}"}},
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			instance, err := New(Config{
+				Name:       "TestService",
+				PathPrefix: "/api",
+				BaseURL:    "http://localhost:8080",
+				Headers:    testCase.serviceHeaders,
+				Endpoints: []EndpointConfiguration{
+					{
+						Method:  "GET",
+						Path:    "/users/:id",
+						Headers: testCase.endpointHeaders,
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			_, options, err := instance.buildForwarding(instance.endpoints[0])
+			if testCase.shouldFail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedHeaders, options.Headers != nil)
+			}
+		})
+	}
+}
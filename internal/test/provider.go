@@ -1,29 +1,57 @@
 package test
 
 import (
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func LaunchTestProvider() *httptest.Server {
+// Lifetime of the access tokens issued by the test provider token endpoint.
+const TokenLifetime = time.Hour
+
+// authorizationRequest is an authorization code waiting to be exchanged.
+type authorizationRequest struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+}
+
+// LaunchTestProvider serves an OIDC provider signing tokens with
+// RS256PrivateKey. Middlewares are run before every provider endpoint.
+//
+// The authorization endpoint approves every request, its codes are
+// exchanged with PKCE on the token endpoint. Refresh tokens are rotated,
+// each of them can be used once.
+func LaunchTestProvider(middlewares ...gin.HandlerFunc) *httptest.Server {
 	baseURL := ""
 
+	mu := sync.Mutex{}
+	codes := map[string]authorizationRequest{}
+	refreshTokens := map[string]string{}
+
 	router := gin.New()
+	router.Use(middlewares...)
 	router.GET("/.well-known/openid-configuration", func(c *gin.Context) {
 		type providerJSON struct {
 			Issuer        string   `json:"issuer"`
 			AuthURL       string   `json:"authorization_endpoint"`
 			TokenURL      string   `json:"token_endpoint"`
 			DeviceAuthURL string   `json:"device_authorization_endpoint"`
+			EndSessionURL string   `json:"end_session_endpoint"`
 			JWKSURL       string   `json:"jwks_uri"`
 			UserInfoURL   string   `json:"userinfo_endpoint"`
+			Introspection string   `json:"introspection_endpoint"`
 			Algorithms    []string `json:"id_token_signing_alg_values_supported"`
 		}
 
@@ -32,8 +60,10 @@ func LaunchTestProvider() *httptest.Server {
 			AuthURL:       baseURL + "/auth",
 			TokenURL:      baseURL + "/token",
 			DeviceAuthURL: baseURL + "/device/auth",
+			EndSessionURL: baseURL + "/logout",
 			JWKSURL:       baseURL + "/jwks",
 			UserInfoURL:   baseURL + "/user_info",
+			Introspection: baseURL + "/introspect",
 			Algorithms: []string{
 				"RS256",
 			},
@@ -88,9 +118,114 @@ func LaunchTestProvider() *httptest.Server {
 		c.JSON(http.StatusOK, &response)
 	})
 
+	// Tokens signed by NewToken are active, their claims are returned.
+	router.POST("/introspect", func(c *gin.Context) {
+		token, err := jwt.Parse(c.PostForm("token"), func(token *jwt.Token) (any, error) {
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(RS256PublicKey))
+		})
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+		claims["active"] = true
+		c.JSON(http.StatusOK, claims)
+	})
+
+	router.GET("/auth", func(c *gin.Context) {
+		if c.Query("response_type") != "code" || c.Query("code_challenge_method") != "S256" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		code := randomString()
+		mu.Lock()
+		codes[code] = authorizationRequest{
+			clientID:      c.Query("client_id"),
+			redirectURI:   c.Query("redirect_uri"),
+			codeChallenge: c.Query("code_challenge"),
+		}
+		mu.Unlock()
+
+		redirect, err := url.Parse(c.Query("redirect_uri"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		query := redirect.Query()
+		query.Set("code", code)
+		query.Set("state", c.Query("state"))
+		redirect.RawQuery = query.Encode()
+		c.Redirect(http.StatusFound, redirect.String())
+	})
+
+	router.POST("/token", func(c *gin.Context) {
+		clientID, _, ok := c.Request.BasicAuth()
+		if !ok {
+			clientID = c.PostForm("client_id")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch c.PostForm("grant_type") {
+		case "authorization_code":
+			request, ok := codes[c.PostForm("code")]
+			delete(codes, c.PostForm("code"))
+
+			challenge := sha256.Sum256([]byte(c.PostForm("code_verifier")))
+			if !ok || request.clientID != clientID || request.redirectURI != c.PostForm("redirect_uri") ||
+				request.codeChallenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			owner, ok := refreshTokens[c.PostForm("refresh_token")]
+			delete(refreshTokens, c.PostForm("refresh_token"))
+
+			if !ok || owner != clientID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss": baseURL,
+			"sub": "user",
+			"aud": jwt.ClaimStrings{clientID},
+			"iat": jwt.NewNumericDate(time.Now()),
+			"exp": jwt.NewNumericDate(time.Now().Add(TokenLifetime)),
+		}
+
+		refreshToken := randomString()
+		refreshTokens[refreshToken] = clientID
+
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  NewToken(claims),
+			"token_type":    "Bearer",
+			"expires_in":    int(TokenLifetime.Seconds()),
+			"refresh_token": refreshToken,
+			"id_token":      NewToken(claims),
+		})
+	})
+
 	jwt.New(jwt.SigningMethodRS256)
 
 	server := httptest.NewServer(router)
 	baseURL = server.URL
 	return server
 }
+
+func randomString() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -11,7 +11,7 @@ import (
 
 	"github.com/Aloe-Corporation/logs"
 	"github.com/FloRichardAloeCorp/gateway/internal/configuration"
-	"github.com/FloRichardAloeCorp/gateway/internal/proxy"
+	"github.com/FloRichardAloeCorp/gateway/internal/server"
 	"github.com/FloRichardAloeCorp/gateway/internal/service"
 	"github.com/gin-contrib/cors"
 	ginzap "github.com/gin-contrib/zap"
@@ -25,6 +25,8 @@ const (
 	PREFIX_ENV          = "GATEWAY"
 	ENV_CONFIG          = PREFIX_ENV + "_CONFIG"
 	DEFAULT_PATH_CONFIG = "/config/"
+
+	DEFAULT_READ_HEADER_TIMEOUT = 10 * time.Second
 )
 
 func main() {
@@ -39,10 +41,6 @@ func main() {
 	}
 	log.Info("configuration loaded")
 
-	log.Info("proxy package initialization...")
-	proxy.Init()
-	log.Info("proxy package initialized")
-
 	router := gin.New()
 	router.Use(ginzap.RecoveryWithZap(log, true))
 	router.Use(ginzap.Ginzap(log, time.RFC3339, true))
@@ -56,32 +54,73 @@ func main() {
 	}))
 
 	log.Info("Creating endpoints...")
+	services := []*service.Service{}
 	for _, serviceConf := range config.Services {
 		service, err := service.New(serviceConf)
 		if err != nil {
 			panic(err)
 		}
-		service.AttachEndpoints(router)
+		if err := service.AttachEndpoints(router); err != nil {
+			panic(err)
+		}
+		services = append(services, service)
 	}
 	log.Info("endpoints created")
 
+	if config.Server.HealthPath != "" {
+		router.GET(config.Server.HealthPath, service.HealthHandler(services))
+		log.Info("health endpoint enabled", zap.String("path", config.Server.HealthPath))
+	}
+
+	if config.Server.ReadinessPath != "" {
+		router.GET(config.Server.ReadinessPath, service.ReadinessHandler(services))
+		log.Info("readiness endpoint enabled", zap.String("path", config.Server.ReadinessPath))
+	}
+
+	readHeaderTimeout := config.Server.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = DEFAULT_READ_HEADER_TIMEOUT
+	}
+
 	addrGin := ":" + strconv.Itoa(config.Server.Port)
 	srv := &http.Server{
-		ReadHeaderTimeout: time.Millisecond,
+		ReadHeaderTimeout: readHeaderTimeout,
 		Addr:              addrGin,
 		Handler:           router,
 	}
 
-	go RunGin(addrGin, router)
+	if config.Server.TLS.Enabled {
+		tlsConfig, err := server.NewTLSConfig(config.Server.TLS)
+		if err != nil {
+			panic(err)
+		}
+
+		srv.TLSConfig = tlsConfig
+		go RunGinTLS(srv)
+	} else {
+		go RunGin(srv)
+	}
 
 	WaitSignalShutdown(srv)
+	for _, service := range services {
+		service.Stop()
+	}
+}
+
+func RunGin(srv *http.Server) {
+	log.Info("REST API listening on : "+srv.Addr,
+		zap.String("package", "main"))
+
+	log.Error(srv.ListenAndServe().Error(),
+		zap.String("package", "main"))
 }
 
-func RunGin(addr string, engine *gin.Engine) {
-	log.Info("REST API listening on : "+addr,
+func RunGinTLS(srv *http.Server) {
+	log.Info("REST API listening with TLS on : "+srv.Addr,
 		zap.String("package", "main"))
 
-	log.Error(engine.Run(addr).Error(),
+	// Certificates are already loaded in the server TLS configuration.
+	log.Error(srv.ListenAndServeTLS("", "").Error(),
 		zap.String("package", "main"))
 }
 